@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	database "alert-service/database/sqlc"
+	"alert-service/internal/api"
+	"alert-service/internal/service"
+	"alert-service/internal/types"
+
+	"github.com/aead/chacha20poly1305"
+)
+
+// apiConfig is the config of the api command
+type apiConfig struct {
+	ListenAddr string `env:"API_LISTEN_ADDR" default:":3000"`
+	// apply pending migrations before starting instead of only checking the schema
+	MigrateOnStart    bool          `env:"MIGRATE_ON_START" default:"false"`
+	RedisAddress      string        `env:"REDIS_ADDRESS" required:"true"`
+	TokenSymmetricKey string        `env:"TOKEN_SYMMETRIC_KEY" required:"true" secret:"true"`
+	TokenDuration     time.Duration `env:"TOKEN_DURATION" default:"1h"`
+	// security notices go to email-service through kafka, without an address they are only logged and
+	// dead letters cannot be replayed
+	KafkaAddress     string `env:"KAFKA_ADDRESS"`
+	KafkaNoticeTopic string `env:"KAFKA_NOTICE_TOPIC" default:"security-notices"`
+	// exchanges the watchers read, alerts can only fire on these or their consensus
+	FeedSources []string `env:"FEED_SOURCES" default:"binance"`
+
+	Postgres   database.PoolConfig
+	RateLimits api.RateLimitConfig
+	Login      service.LoginConfig
+	TOTP       service.TOTPConfig
+	Token      service.TokenConfig
+	OIDC       service.OIDCConfig
+}
+
+func (c *apiConfig) Validate() error {
+	if len(c.TokenSymmetricKey) != chacha20poly1305.KeySize {
+		return fmt.Errorf("TOKEN_SYMMETRIC_KEY must be %d characters", chacha20poly1305.KeySize)
+	}
+	if c.TokenDuration <= 0 {
+		return errors.New("TOKEN_DURATION must be positive")
+	}
+	if c.Token.Format == service.TokenFormatPublic && c.Token.RotationOverlap < c.TokenDuration {
+		return errors.New("TOKEN_ROTATION_OVERLAP must be at least TOKEN_DURATION")
+	}
+	sources, err := types.ParseSources(c.FeedSources)
+	if err != nil {
+		return err
+	}
+	c.FeedSources = sources
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	database "alert-service/database/sqlc"
+	"alert-service/internal/api"
+	"alert-service/internal/cache"
+	"alert-service/internal/health"
+	"alert-service/internal/service"
+	"config"
+	"migrations"
+
+	"github.com/go-playground/validator"
+	"golang.org/x/sync/errgroup"
+)
+
+func main() {
+	var cfg apiConfig
+	args, err := config.Load(&cfg, os.Args[1:])
+	if errors.Is(err, config.ErrPrinted) {
+		return
+	}
+	if err != nil {
+		log.Fatal("Error reading config:", err)
+	}
+
+	// graceful shutdown
+	mainCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// initializing postgres database
+	postgres, err := database.NewPostresDB(mainCtx, cfg.Postgres)
+	if err != nil {
+		log.Fatal("Error connecting to database:", err)
+	}
+	defer postgres.Close()
+
+	// refuse to run against a schema this build does not know
+	err = migrations.Ensure(mainCtx, postgres.Pool, cfg.MigrateOnStart)
+	if err != nil {
+		log.Fatal("Error checking database schema:", err)
+	}
+
+	// subcommands that only need postgres run instead of the service
+	if len(args) > 0 && args[0] == "backtest" {
+		err := service.BacktestCommand(mainCtx, service.NewBacktester(postgres), args[1:], os.Stdout)
+		if err != nil {
+			log.Fatal("Error running backtest:", err)
+		}
+		return
+	}
+
+	// initializing token maker
+	token, err := service.NewTokenMaker(cfg.Token, cfg.TokenSymmetricKey)
+	if err != nil {
+		log.Fatal("Error creating token maker:", err)
+	}
+
+	// initializing validator
+	validator := validator.New()
+
+	// initializing redis
+	redis, err := cache.NewRedis(cfg.RedisAddress)
+	if err != nil {
+		log.Fatal("Error connecting to redis:", err)
+	}
+
+	// initializing security notices
+	notifier := service.NewLogNotifier()
+	if cfg.KafkaAddress != "" {
+		notifier, err = service.NewKafkaNotifier([]string{cfg.KafkaAddress}, cfg.KafkaNoticeTopic)
+		if err != nil {
+			log.Fatal("Error setting up kafka:", err)
+		}
+	}
+
+	// initializing auth service, totp secrets are sealed with a key derived from the token key
+	authSvc := service.NewAuthSvc(postgres, redis, notifier, token, cfg.TokenDuration, cfg.Login, cfg.TOTP, cfg.OIDC, []byte(cfg.TokenSymmetricKey))
+
+	// initializing admin service, dead letters can only be replayed with kafka
+	var republisher service.Republisher
+	if cfg.KafkaAddress != "" {
+		republisher, err = service.NewKafkaRepublisher([]string{cfg.KafkaAddress})
+		if err != nil {
+			log.Fatal("Error setting up kafka:", err)
+		}
+	}
+	adminSvc := service.NewAdminSvc(postgres, redis, republisher)
+
+	// initializing alert service, page cursors are signed with a key derived from the token key
+	alertSvc := service.NewAlertService(redis, postgres, []byte(cfg.TokenSymmetricKey), cfg.FeedSources)
+
+	// initializing market service
+	marketSvc := service.NewMarketService(postgres, redis)
+
+	// initializing backtester
+	backtester := service.NewBacktester(postgres)
+
+	// the api is ready once it can reach its stores
+	checks := health.Checks{
+		"postgres": postgres.Ping,
+		"redis":    redis.Ping,
+	}
+
+	// initializing api
+	server := api.NewAPI(cfg.ListenAddr, token, authSvc, adminSvc, validator, alertSvc, marketSvc, backtester, redis, checks, cfg.RateLimits).Run(mainCtx)
+
+	g, gCtx := errgroup.WithContext(mainCtx)
+	g.Go(func() error {
+		log.Println("starting server on", cfg.ListenAddr)
+		err := server.ListenAndServe()
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	})
+	g.Go(func() error {
+		<-gCtx.Done()
+		log.Println("shutting down server...")
+		return server.Shutdown(context.Background())
+	})
+
+	if err := g.Wait(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,6 @@
+package main
+
+// migrateConfig is the config of the migrate command
+type migrateConfig struct {
+	PostgresAddress string `env:"POSTGRES_ADDRESS" required:"true"`
+}
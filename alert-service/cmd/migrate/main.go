@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"config"
+	"migrations"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func main() {
+	var cfg migrateConfig
+	args, err := config.Load(&cfg, os.Args[1:])
+	if errors.Is(err, config.ErrPrinted) {
+		return
+	}
+	if err != nil {
+		log.Fatal("Error reading config:", err)
+	}
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, "usage: migrate [flags] <command>\n\n"+migrations.Usage)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// the schema is built into the binary, every service runs against the same one
+	embedded, err := migrations.Embedded()
+	if err != nil {
+		log.Fatal("Error loading migrations:", err)
+	}
+
+	conn, err := pgx.Connect(ctx, cfg.PostgresAddress)
+	if err != nil {
+		log.Fatal("Error connecting to database:", err)
+	}
+	defer conn.Close(context.Background())
+
+	err = migrations.Command(ctx, migrations.NewMigrator(conn, embedded), args, os.Stdout)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	database "alert-service/database/sqlc"
+	"alert-service/internal/watcher"
+)
+
+// watcherConfig is the config of the watcher command
+type watcherConfig struct {
+	// health and metrics endpoints, the watcher serves no api
+	HealthAddr string `env:"WATCHER_HEALTH_ADDR" default:":3001"`
+	// apply pending migrations before starting instead of only checking the schema
+	MigrateOnStart bool   `env:"MIGRATE_ON_START" default:"false"`
+	RedisAddress   string `env:"REDIS_ADDRESS" required:"true"`
+	KafkaAddress   string `env:"KAFKA_ADDRESS" required:"true"`
+	KafkaTopic     string `env:"KAFKA_TOPIC" required:"true"`
+
+	// how often alerts are compared against the market and tickers are published for the api
+	CompareInterval time.Duration `env:"WATCHER_COMPARE_INTERVAL" default:"100ms"`
+	TickerInterval  time.Duration `env:"WATCHER_TICKER_INTERVAL" default:"500ms"`
+
+	Postgres  database.PoolConfig
+	Feed      watcher.FeedConfig
+	Guard     watcher.GuardConfig
+	Consensus watcher.ConsensusConfig
+	Shard     watcher.ShardConfig
+}
+
+// Validate turns the lag check off when replaying, recorded event times are in the past
+func (c *watcherConfig) Validate() error {
+	if c.CompareInterval <= 0 || c.TickerInterval <= 0 {
+		return errors.New("WATCHER_COMPARE_INTERVAL and WATCHER_TICKER_INTERVAL must be positive")
+	}
+	if c.Feed.ReplayFile != "" {
+		c.Guard.MaxLag = 0
+	}
+	return nil
+}
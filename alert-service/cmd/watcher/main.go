@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	database "alert-service/database/sqlc"
+	"alert-service/internal/cache"
+	"alert-service/internal/health"
+	"alert-service/internal/types"
+	"alert-service/internal/watcher"
+	"config"
+	"migrations"
+
+	"github.com/go-chi/chi"
+	"golang.org/x/sync/errgroup"
+)
+
+func main() {
+	var cfg watcherConfig
+	_, err := config.Load(&cfg, os.Args[1:])
+	if errors.Is(err, config.ErrPrinted) {
+		return
+	}
+	if err != nil {
+		log.Fatal("Error reading config:", err)
+	}
+
+	// graceful shutdown
+	mainCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// initializing postgres database
+	postgres, err := database.NewPostresDB(mainCtx, cfg.Postgres)
+	if err != nil {
+		log.Fatal("Error connecting to database:", err)
+	}
+	defer postgres.Close()
+
+	// refuse to run against a schema this build does not know
+	err = migrations.Ensure(mainCtx, postgres.Pool, cfg.MigrateOnStart)
+	if err != nil {
+		log.Fatal("Error checking database schema:", err)
+	}
+
+	// initializing redis
+	redis, err := cache.NewRedis(cfg.RedisAddress)
+	if err != nil {
+		log.Fatal("Error connecting to redis:", err)
+	}
+
+	// initializing kafka producer
+	kafkaProducer, err := watcher.NewKafkaProducer([]string{cfg.KafkaAddress}, cfg.KafkaTopic)
+	if err != nil {
+		log.Fatal("Error setting up kafka:", err)
+	}
+
+	// initializing pair sharding across watcher instances
+	shards := watcher.NewShardCoordinator(cfg.Shard, redis, types.SupportedCurrencies)
+
+	// runs a crypto watcher over the pairs this instance holds the leases of
+	watch := func(ctx context.Context, pairs []types.Currency) error {
+		// live exchange streams or a recorded replay
+		feed, err := watcher.NewFeed(ctx, cfg.Feed, pairs)
+		if err != nil {
+			return fmt.Errorf("setting up market data feed: %w", err)
+		}
+
+		cryptoWatcher, err := watcher.NewCryptoWatcher(feed, watcher.WatcherConfig{
+			Instance:        cfg.Shard.Instance,
+			Sources:         cfg.Feed.Sources,
+			Currencies:      pairs,
+			Guard:           cfg.Guard,
+			Consensus:       cfg.Consensus,
+			CompareInterval: cfg.CompareInterval,
+			TickerInterval:  cfg.TickerInterval,
+			PerTrade:        cfg.Feed.ReplayFile != "",
+		}, redis, postgres, kafkaProducer)
+		if err != nil {
+			feed.Close()
+			return fmt.Errorf("creating crypto watcher: %w", err)
+		}
+		defer cryptoWatcher.Close()
+
+		return cryptoWatcher.Run(ctx)
+	}
+
+	// health and metrics only, the api serves the watcher's view of the market from redis
+	mux := chi.NewRouter()
+	health.Mount(mux, health.Checks{
+		"postgres": postgres.Ping,
+		"redis":    redis.Ping,
+	})
+	mux.Handle("/debug/vars", expvar.Handler())
+	server := &http.Server{
+		Addr:    cfg.HealthAddr,
+		Handler: mux,
+	}
+
+	g, gCtx := errgroup.WithContext(mainCtx)
+	g.Go(func() error {
+		log.Println("starting crypto watcher", cfg.Shard.Instance, "...")
+		err := shards.Run(gCtx, watch)
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		return err
+	})
+	g.Go(func() error {
+		log.Println("starting health server on", cfg.HealthAddr)
+		err := server.ListenAndServe()
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	})
+	g.Go(func() error {
+		<-gCtx.Done()
+		log.Println("shutting down watcher...")
+		return server.Shutdown(context.Background())
+	})
+
+	if err := g.Wait(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,11 @@
+-- name: CreateAlertEvent :exec
+INSERT INTO "AlertEvents" (
+  alert_id, type, price, detail
+) VALUES (
+  $1, $2, $3, $4
+);
+
+-- name: GetAlertEvents :many
+SELECT * FROM "AlertEvents"
+WHERE "alert_id" = $1
+ORDER BY "id";
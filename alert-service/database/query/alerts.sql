@@ -1,8 +1,16 @@
 -- name: CreateAlert :one
 INSERT INTO "Alerts" (
-  user_id, crypto, price, direction
+  user_id, crypto, price, direction, source
 ) VALUES (
-  $1, $2, $3, $4
+  $1, $2, $3, $4, $5
+)
+RETURNING *;
+
+-- name: CreateExpressionAlert :one
+INSERT INTO "Alerts" (
+  user_id, crypto, price, direction, expression, source
+) VALUES (
+  $1, '', 0, false, $2, $3
 )
 RETURNING *;
 
@@ -10,17 +18,49 @@ RETURNING *;
 SELECT * FROM "Alerts" 
 WHERE "id" = $1;
 
--- name: GetAllAlerts :many
-SELECT * FROM "Alerts" 
-WHERE "user_id" = $1
-LIMIT $2
-OFFSET $3;
+-- name: GetAlertForUpdate :one
+SELECT * FROM "Alerts"
+WHERE "id" = $1
+FOR UPDATE;
 
--- name: GetAlertsByStatus :many
-SELECT * FROM "Alerts" 
-WHERE "user_id" = $1 AND "status" = $2
-LIMIT $3
-OFFSET $4;
+-- name: GetAlertUsage :one
+-- alerts count against a plan until they are completed or deleted, except_id leaves out an alert being updated
+SELECT
+  count(*) AS active_alerts,
+  COALESCE(array_agg(DISTINCT "crypto") FILTER (WHERE "crypto" <> ''), '{}')::varchar[] AS pairs,
+  COALESCE(array_agg(DISTINCT "expression") FILTER (WHERE "expression" <> ''), '{}')::varchar[] AS expressions
+FROM "Alerts"
+WHERE "user_id" = @user_id AND "status" IN ('created', 'triggered') AND "id" <> @except_id;
+
+-- name: ListAlertsByCreatedAt :many
+SELECT * FROM "Alerts"
+WHERE "user_id" = @user_id
+  AND (@crypto::varchar = '' OR "crypto" = @crypto)
+  AND (cardinality(@statuses::varchar[]) = 0 OR "status" = ANY(@statuses::varchar[]))
+  AND "created_at" >= @created_from AND "created_at" < @created_to
+  AND (@after_id::bigint = 0 OR ("created_at", "id") < (@after_created_at::timestamptz, @after_id))
+ORDER BY "created_at" DESC, "id" DESC
+LIMIT @max_rows;
+
+-- name: ListAlertsByPrice :many
+SELECT * FROM "Alerts"
+WHERE "user_id" = @user_id
+  AND (@crypto::varchar = '' OR "crypto" = @crypto)
+  AND (cardinality(@statuses::varchar[]) = 0 OR "status" = ANY(@statuses::varchar[]))
+  AND "created_at" >= @created_from AND "created_at" < @created_to
+  AND (@after_id::bigint = 0 OR ("price", "id") > (@after_price::float, @after_id))
+ORDER BY "price", "id"
+LIMIT @max_rows;
+
+-- name: ListAlertsByPair :many
+SELECT * FROM "Alerts"
+WHERE "user_id" = @user_id
+  AND (@crypto::varchar = '' OR "crypto" = @crypto)
+  AND (cardinality(@statuses::varchar[]) = 0 OR "status" = ANY(@statuses::varchar[]))
+  AND "created_at" >= @created_from AND "created_at" < @created_to
+  AND (@after_id::bigint = 0 OR ("crypto", "id") > (@after_crypto::varchar, @after_id))
+ORDER BY "crypto", "id"
+LIMIT @max_rows;
 
 -- name: UpdateAlert :one
 UPDATE "Alerts" SET
@@ -33,4 +73,50 @@ RETURNING *;
 -- name: UpdateAlertStatus :exec
 UPDATE "Alerts" SET
   status = $2
-WHERE "id" = $1;
\ No newline at end of file
+WHERE "id" = $1;
+
+-- name: TriggerAlert :one
+UPDATE "Alerts" SET
+  status = 'triggered'
+WHERE "id" = $1 AND "status" = 'created'
+RETURNING *;
+
+-- name: ExportAlerts :many
+SELECT * FROM "Alerts"
+WHERE "user_id" = @user_id AND "status" <> 'deleted' AND "id" > @after_id
+ORDER BY "id"
+LIMIT @max_rows;
+
+-- name: ImportAlert :one
+INSERT INTO "Alerts" (
+  user_id, crypto, price, direction, expression, source
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+)
+ON CONFLICT ("user_id", "crypto", "price", "direction", "expression", "source") DO NOTHING
+RETURNING *;
+
+-- name: UpsertAlert :one
+-- a matching alert is returned as it is, an import never changes the status of an alert
+INSERT INTO "Alerts" (
+  user_id, crypto, price, direction, expression, source
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+)
+ON CONFLICT ("user_id", "crypto", "price", "direction", "expression", "source") DO UPDATE SET
+  status = "Alerts".status
+RETURNING *, (xmax = 0)::boolean AS inserted;
+
+-- name: ListWatchedAlerts :many
+-- the alerts the redis index should hold, every one still waiting to fire
+SELECT * FROM "Alerts"
+WHERE "status" = 'created'
+ORDER BY "id";
+
+-- name: LockAlertIndex :exec
+-- held by a rebuild of the redis index until it commits, transactions writing the index wait for it
+SELECT pg_advisory_xact_lock(72101);
+
+-- name: ShareAlertIndex :exec
+-- held by transactions writing the redis index until they commit, a rebuild waits for all of them
+SELECT pg_advisory_xact_lock_shared(72101);
@@ -0,0 +1,27 @@
+-- name: CreateApiKey :one
+INSERT INTO "ApiKeys" (
+  user_id, name, prefix, key_hash, scopes, expires_at
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+)
+RETURNING *;
+
+-- name: GetApiKeyByHash :one
+SELECT * FROM "ApiKeys"
+WHERE key_hash = $1;
+
+-- name: ListApiKeys :many
+SELECT * FROM "ApiKeys"
+WHERE user_id = $1
+ORDER BY id;
+
+-- name: RevokeApiKey :execrows
+UPDATE "ApiKeys" SET
+  revoked = true
+WHERE id = $1 AND user_id = $2 AND NOT revoked;
+
+-- name: TouchApiKey :exec
+-- last_used_at is kept to the minute so busy bots do not write on every request
+UPDATE "ApiKeys" SET
+  last_used_at = now()
+WHERE id = $1 AND last_used_at < now() - interval '1 minute';
@@ -0,0 +1,13 @@
+-- name: CreateAuditEntry :exec
+INSERT INTO "AuditLog" (
+  admin_id, action, target, detail
+) VALUES (
+  $1, $2, $3, $4
+);
+
+-- name: ListAuditLog :many
+-- newest first, a page continues below the last id of the one before
+SELECT * FROM "AuditLog"
+WHERE (@before_id::bigint = 0 OR "id" < @before_id)
+ORDER BY "id" DESC
+LIMIT @max_rows;
@@ -0,0 +1,25 @@
+-- name: UpsertCandles :batchexec
+INSERT INTO "Candles" (
+  pair, interval, open_time, open, high, low, close, volume, trades
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8, $9
+)
+ON CONFLICT ("pair", "interval", "open_time") DO UPDATE SET
+  high = GREATEST("Candles".high, EXCLUDED.high),
+  low = LEAST("Candles".low, EXCLUDED.low),
+  close = EXCLUDED.close,
+  volume = "Candles".volume + EXCLUDED.volume,
+  trades = "Candles".trades + EXCLUDED.trades;
+
+-- name: GetCandleBefore :one
+SELECT * FROM "Candles"
+WHERE "pair" = $1 AND "interval" = $2 AND "open_time" <= $3
+ORDER BY "open_time" DESC
+LIMIT 1;
+
+-- name: GetCandles :many
+SELECT * FROM "Candles"
+WHERE "pair" = @pair AND "interval" = @interval
+  AND "open_time" >= @from_time AND "open_time" < @to_time
+ORDER BY "open_time"
+LIMIT @max_rows;
\ No newline at end of file
@@ -0,0 +1,20 @@
+-- name: ListDeadLetters :many
+-- letters not replayed yet, oldest first
+SELECT * FROM "DeadLetters"
+WHERE "replayed_at" = 'epoch' AND "id" > @after_id
+ORDER BY "id"
+LIMIT @max_rows;
+
+-- name: GetDeadLettersForReplay :many
+-- every pending letter when no ids are given, letters another admin is replaying are skipped
+SELECT * FROM "DeadLetters"
+WHERE "replayed_at" = 'epoch'
+  AND (cardinality(@ids::bigint[]) = 0 OR "id" = ANY(@ids::bigint[]))
+ORDER BY "id"
+LIMIT @max_rows
+FOR UPDATE SKIP LOCKED;
+
+-- name: MarkDeadLetterReplayed :exec
+UPDATE "DeadLetters" SET
+  replayed_at = now()
+WHERE "id" = $1;
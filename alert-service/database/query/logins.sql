@@ -0,0 +1,17 @@
+-- name: GetKnownLogin :one
+-- how many places the user logged in from, and from how many of them with this ip or device
+SELECT
+  count(*) AS logins,
+  count(*) FILTER (WHERE "ip" = $2) AS from_ip,
+  count(*) FILTER (WHERE "user_agent" = $3) AS from_device
+FROM "UserLogins"
+WHERE "user_id" = $1;
+
+-- name: RecordLogin :exec
+INSERT INTO "UserLogins" (
+  user_id, ip, user_agent
+) VALUES (
+  $1, $2, $3
+)
+ON CONFLICT ("user_id", "ip", "user_agent") DO UPDATE SET
+  last_seen_at = now();
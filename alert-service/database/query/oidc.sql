@@ -0,0 +1,11 @@
+-- name: CreateOidcIdentity :one
+INSERT INTO "OidcIdentities" (
+  user_id, issuer, subject, email
+) VALUES (
+  $1, $2, $3, $4
+)
+RETURNING *;
+
+-- name: GetOidcIdentity :one
+SELECT * FROM "OidcIdentities"
+WHERE issuer = $1 AND subject = $2;
@@ -0,0 +1,11 @@
+-- name: GetUserPlan :one
+SELECT p.* FROM "Plans" p
+INNER JOIN "Users" u ON u.plan = p.name
+WHERE u.id = $1;
+
+-- name: GetUserPlanForUpdate :one
+-- locks the user so alerts created at the same time are counted against the plan one after the other
+SELECT p.* FROM "Plans" p
+INNER JOIN "Users" u ON u.plan = p.name
+WHERE u.id = $1
+FOR UPDATE OF u;
@@ -0,0 +1,33 @@
+-- name: CreateRecoveryCode :exec
+INSERT INTO "RecoveryCodes" (
+  user_id, code_hash
+) VALUES (
+  $1, $2
+);
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM "RecoveryCodes"
+WHERE user_id = $1;
+
+-- name: EnableTOTP :exec
+-- the step of the confirming code counts as used
+UPDATE "Users" SET
+  totp_enabled = true,
+  totp_last_step = $2
+WHERE id = $1;
+
+-- name: SetTOTPSecret :execrows
+-- a new secret only replaces one that was never confirmed
+UPDATE "Users" SET
+  totp_secret = $2
+WHERE id = $1 AND NOT totp_enabled;
+
+-- name: UseRecoveryCode :execrows
+DELETE FROM "RecoveryCodes"
+WHERE user_id = $1 AND code_hash = $2;
+
+-- name: UseTOTPStep :execrows
+-- takes the step of an accepted code, a step at or before the last one is a replay
+UPDATE "Users" SET
+  totp_last_step = $2
+WHERE id = $1 AND totp_last_step < $2;
@@ -13,4 +13,43 @@ limit 1;
 
 -- name: GetUserByEmail :one
 select * from "Users"
-where email = $1;
\ No newline at end of file
+where lower(email) = lower(@email);
+
+-- name: GetUserForUpdate :one
+-- locks the user so attempts to log in at the same time are counted one after the other
+select * from "Users"
+where id = $1
+for update;
+
+-- name: RecordLoginFailure :one
+UPDATE "Users" SET
+  failed_logins = failed_logins + 1
+WHERE id = $1
+RETURNING failed_logins;
+
+-- name: ReleaseLoginAttempt :one
+-- an attempt counts as failed until its credential checks out, then it is taken back with the hold it
+-- put on the account
+UPDATE "Users" SET
+  failed_logins = greatest(failed_logins - 1, 0),
+  locked_until = 'epoch'
+WHERE id = $1
+RETURNING failed_logins;
+
+-- name: LockUser :exec
+UPDATE "Users" SET
+  locked_until = $2
+WHERE id = $1;
+
+-- name: UnlockUser :execrows
+UPDATE "Users" SET
+  failed_logins = 0,
+  locked_until = 'epoch'
+WHERE id = $1;
+
+-- name: SearchUsers :many
+-- users whose email contains the query, a page at a time in id order
+SELECT * FROM "Users"
+WHERE strpos(lower("email"), lower(@query::varchar)) > 0 AND "id" > @after_id
+ORDER BY "id"
+LIMIT @max_rows;
@@ -7,15 +7,16 @@ package database
 
 import (
 	"context"
+	"time"
 )
 
 const createAlert = `-- name: CreateAlert :one
 INSERT INTO "Alerts" (
-  user_id, crypto, price, direction
+  user_id, crypto, price, direction, source
 ) VALUES (
-  $1, $2, $3, $4
+  $1, $2, $3, $4, $5
 )
-RETURNING id, user_id, crypto, price, direction, status, created_at
+RETURNING id, user_id, crypto, price, direction, status, created_at, expression, source
 `
 
 type CreateAlertParams struct {
@@ -23,6 +24,7 @@ type CreateAlertParams struct {
 	Crypto    string  `json:"crypto"`
 	Price     float64 `json:"price"`
 	Direction bool    `json:"direction"`
+	Source    string  `json:"source"`
 }
 
 func (q *Queries) CreateAlert(ctx context.Context, arg CreateAlertParams) (Alert, error) {
@@ -31,6 +33,7 @@ func (q *Queries) CreateAlert(ctx context.Context, arg CreateAlertParams) (Alert
 		arg.Crypto,
 		arg.Price,
 		arg.Direction,
+		arg.Source,
 	)
 	var i Alert
 	err := row.Scan(
@@ -41,12 +44,89 @@ func (q *Queries) CreateAlert(ctx context.Context, arg CreateAlertParams) (Alert
 		&i.Direction,
 		&i.Status,
 		&i.CreatedAt,
+		&i.Expression,
+		&i.Source,
 	)
 	return i, err
 }
 
+const createExpressionAlert = `-- name: CreateExpressionAlert :one
+INSERT INTO "Alerts" (
+  user_id, crypto, price, direction, expression, source
+) VALUES (
+  $1, '', 0, false, $2, $3
+)
+RETURNING id, user_id, crypto, price, direction, status, created_at, expression, source
+`
+
+type CreateExpressionAlertParams struct {
+	UserID     int64  `json:"user_id"`
+	Expression string `json:"expression"`
+	Source     string `json:"source"`
+}
+
+func (q *Queries) CreateExpressionAlert(ctx context.Context, arg CreateExpressionAlertParams) (Alert, error) {
+	row := q.db.QueryRow(ctx, createExpressionAlert, arg.UserID, arg.Expression, arg.Source)
+	var i Alert
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Crypto,
+		&i.Price,
+		&i.Direction,
+		&i.Status,
+		&i.CreatedAt,
+		&i.Expression,
+		&i.Source,
+	)
+	return i, err
+}
+
+const exportAlerts = `-- name: ExportAlerts :many
+SELECT id, user_id, crypto, price, direction, status, created_at, expression, source FROM "Alerts"
+WHERE "user_id" = $1 AND "status" <> 'deleted' AND "id" > $2
+ORDER BY "id"
+LIMIT $3
+`
+
+type ExportAlertsParams struct {
+	UserID  int64 `json:"user_id"`
+	AfterID int64 `json:"after_id"`
+	MaxRows int32 `json:"max_rows"`
+}
+
+func (q *Queries) ExportAlerts(ctx context.Context, arg ExportAlertsParams) ([]Alert, error) {
+	rows, err := q.db.Query(ctx, exportAlerts, arg.UserID, arg.AfterID, arg.MaxRows)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Alert
+	for rows.Next() {
+		var i Alert
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Crypto,
+			&i.Price,
+			&i.Direction,
+			&i.Status,
+			&i.CreatedAt,
+			&i.Expression,
+			&i.Source,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getAlertByID = `-- name: GetAlertByID :one
-SELECT id, user_id, crypto, price, direction, status, created_at FROM "Alerts" 
+SELECT id, user_id, crypto, price, direction, status, created_at, expression, source FROM "Alerts" 
 WHERE "id" = $1
 `
 
@@ -61,30 +141,199 @@ func (q *Queries) GetAlertByID(ctx context.Context, id int64) (Alert, error) {
 		&i.Direction,
 		&i.Status,
 		&i.CreatedAt,
+		&i.Expression,
+		&i.Source,
 	)
 	return i, err
 }
 
-const getAlertsByStatus = `-- name: GetAlertsByStatus :many
-SELECT id, user_id, crypto, price, direction, status, created_at FROM "Alerts" 
-WHERE "user_id" = $1 AND "status" = $2
-LIMIT $3
-OFFSET $4
+const getAlertForUpdate = `-- name: GetAlertForUpdate :one
+SELECT id, user_id, crypto, price, direction, status, created_at, expression, source FROM "Alerts"
+WHERE "id" = $1
+FOR UPDATE
 `
 
-type GetAlertsByStatusParams struct {
-	UserID int64  `json:"user_id"`
-	Status string `json:"status"`
-	Limit  int32  `json:"limit"`
-	Offset int32  `json:"offset"`
+func (q *Queries) GetAlertForUpdate(ctx context.Context, id int64) (Alert, error) {
+	row := q.db.QueryRow(ctx, getAlertForUpdate, id)
+	var i Alert
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Crypto,
+		&i.Price,
+		&i.Direction,
+		&i.Status,
+		&i.CreatedAt,
+		&i.Expression,
+		&i.Source,
+	)
+	return i, err
+}
+
+const getAlertUsage = `-- name: GetAlertUsage :one
+SELECT
+  count(*) AS active_alerts,
+  COALESCE(array_agg(DISTINCT "crypto") FILTER (WHERE "crypto" <> ''), '{}')::varchar[] AS pairs,
+  COALESCE(array_agg(DISTINCT "expression") FILTER (WHERE "expression" <> ''), '{}')::varchar[] AS expressions
+FROM "Alerts"
+WHERE "user_id" = $1 AND "status" IN ('created', 'triggered') AND "id" <> $2
+`
+
+type GetAlertUsageParams struct {
+	UserID   int64 `json:"user_id"`
+	ExceptID int64 `json:"except_id"`
+}
+
+type GetAlertUsageRow struct {
+	ActiveAlerts int64    `json:"active_alerts"`
+	Pairs        []string `json:"pairs"`
+	Expressions  []string `json:"expressions"`
+}
+
+// alerts count against a plan until they are completed or deleted, except_id leaves out an alert being updated
+func (q *Queries) GetAlertUsage(ctx context.Context, arg GetAlertUsageParams) (GetAlertUsageRow, error) {
+	row := q.db.QueryRow(ctx, getAlertUsage, arg.UserID, arg.ExceptID)
+	var i GetAlertUsageRow
+	err := row.Scan(&i.ActiveAlerts, &i.Pairs, &i.Expressions)
+	return i, err
+}
+
+const importAlert = `-- name: ImportAlert :one
+INSERT INTO "Alerts" (
+  user_id, crypto, price, direction, expression, source
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+)
+ON CONFLICT ("user_id", "crypto", "price", "direction", "expression", "source") DO NOTHING
+RETURNING id, user_id, crypto, price, direction, status, created_at, expression, source
+`
+
+type ImportAlertParams struct {
+	UserID     int64   `json:"user_id"`
+	Crypto     string  `json:"crypto"`
+	Price      float64 `json:"price"`
+	Direction  bool    `json:"direction"`
+	Expression string  `json:"expression"`
+	Source     string  `json:"source"`
+}
+
+func (q *Queries) ImportAlert(ctx context.Context, arg ImportAlertParams) (Alert, error) {
+	row := q.db.QueryRow(ctx, importAlert,
+		arg.UserID,
+		arg.Crypto,
+		arg.Price,
+		arg.Direction,
+		arg.Expression,
+		arg.Source,
+	)
+	var i Alert
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Crypto,
+		&i.Price,
+		&i.Direction,
+		&i.Status,
+		&i.CreatedAt,
+		&i.Expression,
+		&i.Source,
+	)
+	return i, err
+}
+
+const listAlertsByCreatedAt = `-- name: ListAlertsByCreatedAt :many
+SELECT id, user_id, crypto, price, direction, status, created_at, expression, source FROM "Alerts"
+WHERE "user_id" = $1
+  AND ($2::varchar = '' OR "crypto" = $2)
+  AND (cardinality($3::varchar[]) = 0 OR "status" = ANY($3::varchar[]))
+  AND "created_at" >= $4 AND "created_at" < $5
+  AND ($6::bigint = 0 OR ("created_at", "id") < ($7::timestamptz, $6))
+ORDER BY "created_at" DESC, "id" DESC
+LIMIT $8
+`
+
+type ListAlertsByCreatedAtParams struct {
+	UserID         int64     `json:"user_id"`
+	Crypto         string    `json:"crypto"`
+	Statuses       []string  `json:"statuses"`
+	CreatedFrom    time.Time `json:"created_from"`
+	CreatedTo      time.Time `json:"created_to"`
+	AfterID        int64     `json:"after_id"`
+	AfterCreatedAt time.Time `json:"after_created_at"`
+	MaxRows        int32     `json:"max_rows"`
+}
+
+func (q *Queries) ListAlertsByCreatedAt(ctx context.Context, arg ListAlertsByCreatedAtParams) ([]Alert, error) {
+	rows, err := q.db.Query(ctx, listAlertsByCreatedAt,
+		arg.UserID,
+		arg.Crypto,
+		arg.Statuses,
+		arg.CreatedFrom,
+		arg.CreatedTo,
+		arg.AfterID,
+		arg.AfterCreatedAt,
+		arg.MaxRows,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Alert
+	for rows.Next() {
+		var i Alert
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Crypto,
+			&i.Price,
+			&i.Direction,
+			&i.Status,
+			&i.CreatedAt,
+			&i.Expression,
+			&i.Source,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
-func (q *Queries) GetAlertsByStatus(ctx context.Context, arg GetAlertsByStatusParams) ([]Alert, error) {
-	rows, err := q.db.Query(ctx, getAlertsByStatus,
+const listAlertsByPair = `-- name: ListAlertsByPair :many
+SELECT id, user_id, crypto, price, direction, status, created_at, expression, source FROM "Alerts"
+WHERE "user_id" = $1
+  AND ($2::varchar = '' OR "crypto" = $2)
+  AND (cardinality($3::varchar[]) = 0 OR "status" = ANY($3::varchar[]))
+  AND "created_at" >= $4 AND "created_at" < $5
+  AND ($6::bigint = 0 OR ("crypto", "id") > ($7::varchar, $6))
+ORDER BY "crypto", "id"
+LIMIT $8
+`
+
+type ListAlertsByPairParams struct {
+	UserID      int64     `json:"user_id"`
+	Crypto      string    `json:"crypto"`
+	Statuses    []string  `json:"statuses"`
+	CreatedFrom time.Time `json:"created_from"`
+	CreatedTo   time.Time `json:"created_to"`
+	AfterID     int64     `json:"after_id"`
+	AfterCrypto string    `json:"after_crypto"`
+	MaxRows     int32     `json:"max_rows"`
+}
+
+func (q *Queries) ListAlertsByPair(ctx context.Context, arg ListAlertsByPairParams) ([]Alert, error) {
+	rows, err := q.db.Query(ctx, listAlertsByPair,
 		arg.UserID,
-		arg.Status,
-		arg.Limit,
-		arg.Offset,
+		arg.Crypto,
+		arg.Statuses,
+		arg.CreatedFrom,
+		arg.CreatedTo,
+		arg.AfterID,
+		arg.AfterCrypto,
+		arg.MaxRows,
 	)
 	if err != nil {
 		return nil, err
@@ -101,6 +350,8 @@ func (q *Queries) GetAlertsByStatus(ctx context.Context, arg GetAlertsByStatusPa
 			&i.Direction,
 			&i.Status,
 			&i.CreatedAt,
+			&i.Expression,
+			&i.Source,
 		); err != nil {
 			return nil, err
 		}
@@ -112,21 +363,39 @@ func (q *Queries) GetAlertsByStatus(ctx context.Context, arg GetAlertsByStatusPa
 	return items, nil
 }
 
-const getAllAlerts = `-- name: GetAllAlerts :many
-SELECT id, user_id, crypto, price, direction, status, created_at FROM "Alerts" 
+const listAlertsByPrice = `-- name: ListAlertsByPrice :many
+SELECT id, user_id, crypto, price, direction, status, created_at, expression, source FROM "Alerts"
 WHERE "user_id" = $1
-LIMIT $2
-OFFSET $3
+  AND ($2::varchar = '' OR "crypto" = $2)
+  AND (cardinality($3::varchar[]) = 0 OR "status" = ANY($3::varchar[]))
+  AND "created_at" >= $4 AND "created_at" < $5
+  AND ($6::bigint = 0 OR ("price", "id") > ($7::float, $6))
+ORDER BY "price", "id"
+LIMIT $8
 `
 
-type GetAllAlertsParams struct {
-	UserID int64 `json:"user_id"`
-	Limit  int32 `json:"limit"`
-	Offset int32 `json:"offset"`
+type ListAlertsByPriceParams struct {
+	UserID      int64     `json:"user_id"`
+	Crypto      string    `json:"crypto"`
+	Statuses    []string  `json:"statuses"`
+	CreatedFrom time.Time `json:"created_from"`
+	CreatedTo   time.Time `json:"created_to"`
+	AfterID     int64     `json:"after_id"`
+	AfterPrice  float64   `json:"after_price"`
+	MaxRows     int32     `json:"max_rows"`
 }
 
-func (q *Queries) GetAllAlerts(ctx context.Context, arg GetAllAlertsParams) ([]Alert, error) {
-	rows, err := q.db.Query(ctx, getAllAlerts, arg.UserID, arg.Limit, arg.Offset)
+func (q *Queries) ListAlertsByPrice(ctx context.Context, arg ListAlertsByPriceParams) ([]Alert, error) {
+	rows, err := q.db.Query(ctx, listAlertsByPrice,
+		arg.UserID,
+		arg.Crypto,
+		arg.Statuses,
+		arg.CreatedFrom,
+		arg.CreatedTo,
+		arg.AfterID,
+		arg.AfterPrice,
+		arg.MaxRows,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -142,6 +411,8 @@ func (q *Queries) GetAllAlerts(ctx context.Context, arg GetAllAlertsParams) ([]A
 			&i.Direction,
 			&i.Status,
 			&i.CreatedAt,
+			&i.Expression,
+			&i.Source,
 		); err != nil {
 			return nil, err
 		}
@@ -153,13 +424,94 @@ func (q *Queries) GetAllAlerts(ctx context.Context, arg GetAllAlertsParams) ([]A
 	return items, nil
 }
 
+const listWatchedAlerts = `-- name: ListWatchedAlerts :many
+SELECT id, user_id, crypto, price, direction, status, created_at, expression, source FROM "Alerts"
+WHERE "status" = 'created'
+ORDER BY "id"
+`
+
+// the alerts the redis index should hold, every one still waiting to fire
+func (q *Queries) ListWatchedAlerts(ctx context.Context) ([]Alert, error) {
+	rows, err := q.db.Query(ctx, listWatchedAlerts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Alert
+	for rows.Next() {
+		var i Alert
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Crypto,
+			&i.Price,
+			&i.Direction,
+			&i.Status,
+			&i.CreatedAt,
+			&i.Expression,
+			&i.Source,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockAlertIndex = `-- name: LockAlertIndex :exec
+SELECT pg_advisory_xact_lock(72101)
+`
+
+// held by a rebuild of the redis index until it commits, transactions writing the index wait for it
+func (q *Queries) LockAlertIndex(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, lockAlertIndex)
+	return err
+}
+
+const shareAlertIndex = `-- name: ShareAlertIndex :exec
+SELECT pg_advisory_xact_lock_shared(72101)
+`
+
+// held by transactions writing the redis index until they commit, a rebuild waits for all of them
+func (q *Queries) ShareAlertIndex(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, shareAlertIndex)
+	return err
+}
+
+const triggerAlert = `-- name: TriggerAlert :one
+UPDATE "Alerts" SET
+  status = 'triggered'
+WHERE "id" = $1 AND "status" = 'created'
+RETURNING id, user_id, crypto, price, direction, status, created_at, expression, source
+`
+
+func (q *Queries) TriggerAlert(ctx context.Context, id int64) (Alert, error) {
+	row := q.db.QueryRow(ctx, triggerAlert, id)
+	var i Alert
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Crypto,
+		&i.Price,
+		&i.Direction,
+		&i.Status,
+		&i.CreatedAt,
+		&i.Expression,
+		&i.Source,
+	)
+	return i, err
+}
+
 const updateAlert = `-- name: UpdateAlert :one
 UPDATE "Alerts" SET
   crypto = $2,
   price = $3,
   direction = $4
 WHERE "id" = $1
-RETURNING id, user_id, crypto, price, direction, status, created_at
+RETURNING id, user_id, crypto, price, direction, status, created_at, expression, source
 `
 
 type UpdateAlertParams struct {
@@ -185,6 +537,8 @@ func (q *Queries) UpdateAlert(ctx context.Context, arg UpdateAlertParams) (Alert
 		&i.Direction,
 		&i.Status,
 		&i.CreatedAt,
+		&i.Expression,
+		&i.Source,
 	)
 	return i, err
 }
@@ -204,3 +558,62 @@ func (q *Queries) UpdateAlertStatus(ctx context.Context, arg UpdateAlertStatusPa
 	_, err := q.db.Exec(ctx, updateAlertStatus, arg.ID, arg.Status)
 	return err
 }
+
+const upsertAlert = `-- name: UpsertAlert :one
+INSERT INTO "Alerts" (
+  user_id, crypto, price, direction, expression, source
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+)
+ON CONFLICT ("user_id", "crypto", "price", "direction", "expression", "source") DO UPDATE SET
+  status = "Alerts".status
+RETURNING id, user_id, crypto, price, direction, status, created_at, expression, source, (xmax = 0)::boolean AS inserted
+`
+
+type UpsertAlertParams struct {
+	UserID     int64   `json:"user_id"`
+	Crypto     string  `json:"crypto"`
+	Price      float64 `json:"price"`
+	Direction  bool    `json:"direction"`
+	Expression string  `json:"expression"`
+	Source     string  `json:"source"`
+}
+
+type UpsertAlertRow struct {
+	ID         int64     `json:"id"`
+	UserID     int64     `json:"user_id"`
+	Crypto     string    `json:"crypto"`
+	Price      float64   `json:"price"`
+	Direction  bool      `json:"direction"`
+	Status     string    `json:"status"`
+	CreatedAt  time.Time `json:"created_at"`
+	Expression string    `json:"expression"`
+	Source     string    `json:"source"`
+	Inserted   bool      `json:"inserted"`
+}
+
+// a matching alert is returned as it is, an import never changes the status of an alert
+func (q *Queries) UpsertAlert(ctx context.Context, arg UpsertAlertParams) (UpsertAlertRow, error) {
+	row := q.db.QueryRow(ctx, upsertAlert,
+		arg.UserID,
+		arg.Crypto,
+		arg.Price,
+		arg.Direction,
+		arg.Expression,
+		arg.Source,
+	)
+	var i UpsertAlertRow
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Crypto,
+		&i.Price,
+		&i.Direction,
+		&i.Status,
+		&i.CreatedAt,
+		&i.Expression,
+		&i.Source,
+		&i.Inserted,
+	)
+	return i, err
+}
@@ -2,16 +2,151 @@ package database
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func NewPostresDB(ctx context.Context, addr string) (Querier, *pgx.Conn, error) {
-	conn, err := pgx.Connect(ctx, addr)
+// PoolConfig sizes the connection pool shared by every goroutine of a service
+type PoolConfig struct {
+	Address           string        `env:"POSTGRES_ADDRESS" required:"true"`
+	MaxConns          int32         `env:"POSTGRES_MAX_CONNS" default:"10"`
+	MinConns          int32         `env:"POSTGRES_MIN_CONNS" default:"1"`
+	MaxConnLifetime   time.Duration `env:"POSTGRES_MAX_CONN_LIFETIME" default:"1h"`
+	MaxConnIdleTime   time.Duration `env:"POSTGRES_MAX_CONN_IDLE_TIME" default:"30m"`
+	HealthCheckPeriod time.Duration `env:"POSTGRES_HEALTH_CHECK_PERIOD" default:"30s"`
+	// prepared statements kept per connection, 0 describes every statement instead which works behind pgbouncer
+	StatementCacheCapacity int `env:"POSTGRES_STATEMENT_CACHE_CAPACITY" default:"512"`
+}
+
+func (c *PoolConfig) Validate() error {
+	if c.MaxConns < 1 {
+		return errors.New("POSTGRES_MAX_CONNS must be at least 1")
+	}
+	if c.MinConns < 0 || c.MinConns > c.MaxConns {
+		return errors.New("POSTGRES_MIN_CONNS must be between 0 and POSTGRES_MAX_CONNS")
+	}
+	if c.HealthCheckPeriod <= 0 {
+		return errors.New("POSTGRES_HEALTH_CHECK_PERIOD must be positive")
+	}
+	if c.StatementCacheCapacity < 0 {
+		return errors.New("POSTGRES_STATEMENT_CACHE_CAPACITY must not be negative")
+	}
+	return nil
+}
+
+// Store runs the queries on the pool, WithTx groups several of them into one transaction
+type Store interface {
+	Querier
+	// fn gets queries bound to the transaction, it commits when fn returns nil and rolls back otherwise
+	WithTx(ctx context.Context, fn func(tx Tx) error) error
+}
+
+// Tx runs queries inside a transaction, Savepoint nests fn so that its failure only undoes its own
+// writes and the transaction can go on
+type Tx interface {
+	Querier
+	Savepoint(ctx context.Context, fn func(q Querier) error) error
+}
+
+type Postgres struct {
+	*Queries
+	Pool *pgxpool.Pool
+}
+
+func NewPostresDB(ctx context.Context, cfg PoolConfig) (*Postgres, error) {
+	poolCfg, err := pgxpool.ParseConfig(cfg.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	poolCfg.MaxConns = cfg.MaxConns
+	poolCfg.MinConns = cfg.MinConns
+	poolCfg.MaxConnLifetime = cfg.MaxConnLifetime
+	poolCfg.MaxConnIdleTime = cfg.MaxConnIdleTime
+	poolCfg.HealthCheckPeriod = cfg.HealthCheckPeriod
+	poolCfg.ConnConfig.StatementCacheCapacity = cfg.StatementCacheCapacity
+	if cfg.StatementCacheCapacity == 0 {
+		poolCfg.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeDescribeExec
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	err = pool.Ping(ctx)
+	if err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	return &Postgres{
+		Queries: New(pool),
+		Pool:    pool,
+	}, nil
+}
+
+func (p *Postgres) WithTx(ctx context.Context, fn func(tx Tx) error) error {
+	tx, err := p.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	return run(ctx, tx, func() error {
+		return fn(&pgTx{Queries: p.Queries.WithTx(tx), tx: tx})
+	})
+}
+
+type pgTx struct {
+	*Queries
+	tx pgx.Tx
+}
+
+// Savepoint begins a nested transaction, pgx turns it into a savepoint of the outer one
+func (t *pgTx) Savepoint(ctx context.Context, fn func(q Querier) error) error {
+	sp, err := t.tx.Begin(ctx)
 	if err != nil {
-		return nil, nil, err
+		return err
 	}
 
-	db := New(conn)
-	return db, conn, nil
+	return run(ctx, sp, func() error {
+		return fn(t.Queries.WithTx(sp))
+	})
+}
+
+// run commits tx when fn succeeds and rolls it back otherwise, a panic in fn rolls it back too
+func run(ctx context.Context, tx pgx.Tx, fn func() error) error {
+	// does nothing once tx is committed or rolled back
+	defer tx.Rollback(ctx)
+
+	err := fn()
+	if err != nil {
+		rbErr := tx.Rollback(ctx)
+		if rbErr != nil {
+			return fmt.Errorf("%w, rollback failed: %v", err, rbErr)
+		}
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Ping checks that a connection of the pool can reach postgres
+func (p *Postgres) Ping(ctx context.Context) error {
+	return p.Pool.Ping(ctx)
+}
+
+func (p *Postgres) Close() {
+	p.Pool.Close()
+}
+
+// IsUniqueViolation reports whether err comes from a statement that broke a unique constraint
+func IsUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
 }
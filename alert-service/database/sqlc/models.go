@@ -9,12 +9,98 @@ import (
 )
 
 type Alert struct {
+	ID         int64     `json:"id"`
+	UserID     int64     `json:"user_id"`
+	Crypto     string    `json:"crypto"`
+	Price      float64   `json:"price"`
+	Direction  bool      `json:"direction"`
+	Status     string    `json:"status"`
+	CreatedAt  time.Time `json:"created_at"`
+	Expression string    `json:"expression"`
+	Source     string    `json:"source"`
+}
+
+type AlertEvent struct {
+	ID        int64     `json:"id"`
+	AlertID   int64     `json:"alert_id"`
+	Type      string    `json:"type"`
+	Price     string    `json:"price"`
+	Detail    string    `json:"detail"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ApiKey struct {
+	ID         int64     `json:"id"`
+	UserID     int64     `json:"user_id"`
+	Name       string    `json:"name"`
+	Prefix     string    `json:"prefix"`
+	KeyHash    string    `json:"key_hash"`
+	Scopes     []string  `json:"scopes"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Revoked    bool      `json:"revoked"`
+}
+
+type AuditLog struct {
+	ID        int64     `json:"id"`
+	AdminID   int64     `json:"admin_id"`
+	Action    string    `json:"action"`
+	Target    string    `json:"target"`
+	Detail    string    `json:"detail"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Candle struct {
+	Pair     string    `json:"pair"`
+	Interval string    `json:"interval"`
+	OpenTime time.Time `json:"open_time"`
+	Open     float64   `json:"open"`
+	High     float64   `json:"high"`
+	Low      float64   `json:"low"`
+	Close    float64   `json:"close"`
+	Volume   float64   `json:"volume"`
+	Trades   int64     `json:"trades"`
+}
+
+type DeadLetter struct {
+	ID         int64     `json:"id"`
+	Topic      string    `json:"topic"`
+	Key        []byte    `json:"key"`
+	Value      []byte    `json:"value"`
+	Error      string    `json:"error"`
+	CreatedAt  time.Time `json:"created_at"`
+	ReplayedAt time.Time `json:"replayed_at"`
+}
+
+type DelayedNotification struct {
+	AlertID   int64     `json:"alert_id"`
+	UserID    int64     `json:"user_id"`
+	Price     string    `json:"price"`
+	SendAt    time.Time `json:"send_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type OidcIdentity struct {
 	ID        int64     `json:"id"`
 	UserID    int64     `json:"user_id"`
-	Crypto    string    `json:"crypto"`
-	Price     float64   `json:"price"`
-	Direction bool      `json:"direction"`
-	Status    string    `json:"status"`
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Plan struct {
+	Name               string   `json:"name"`
+	MaxActiveAlerts    int32    `json:"max_active_alerts"`
+	MaxPairs           int32    `json:"max_pairs"`
+	Channels           []string `json:"channels"`
+	MinCooldownSeconds int32    `json:"min_cooldown_seconds"`
+}
+
+type RecoveryCode struct {
+	UserID    int64     `json:"user_id"`
+	CodeHash  string    `json:"code_hash"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
@@ -23,4 +109,19 @@ type User struct {
 	Email          string    `json:"email"`
 	HashedPassword string    `json:"hashed_password"`
 	CreatedAt      time.Time `json:"created_at"`
+	Plan           string    `json:"plan"`
+	FailedLogins   int32     `json:"failed_logins"`
+	LockedUntil    time.Time `json:"locked_until"`
+	TotpSecret     string    `json:"totp_secret"`
+	TotpEnabled    bool      `json:"totp_enabled"`
+	TotpLastStep   int64     `json:"totp_last_step"`
+	Role           string    `json:"role"`
+}
+
+type UserLogin struct {
+	UserID     int64     `json:"user_id"`
+	Ip         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
 }
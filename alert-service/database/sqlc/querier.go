@@ -10,14 +10,76 @@ import (
 
 type Querier interface {
 	CreateAlert(ctx context.Context, arg CreateAlertParams) (Alert, error)
+	CreateAlertEvent(ctx context.Context, arg CreateAlertEventParams) error
+	CreateApiKey(ctx context.Context, arg CreateApiKeyParams) (ApiKey, error)
+	CreateAuditEntry(ctx context.Context, arg CreateAuditEntryParams) error
+	CreateExpressionAlert(ctx context.Context, arg CreateExpressionAlertParams) (Alert, error)
+	CreateOidcIdentity(ctx context.Context, arg CreateOidcIdentityParams) (OidcIdentity, error)
+	CreateRecoveryCode(ctx context.Context, arg CreateRecoveryCodeParams) error
 	CreateUser(ctx context.Context, arg CreateUserParams) (User, error)
+	DeleteRecoveryCodes(ctx context.Context, userID int64) error
+	// the step of the confirming code counts as used
+	EnableTOTP(ctx context.Context, arg EnableTOTPParams) error
+	ExportAlerts(ctx context.Context, arg ExportAlertsParams) ([]Alert, error)
 	GetAlertByID(ctx context.Context, id int64) (Alert, error)
-	GetAlertsByStatus(ctx context.Context, arg GetAlertsByStatusParams) ([]Alert, error)
-	GetAllAlerts(ctx context.Context, arg GetAllAlertsParams) ([]Alert, error)
+	GetAlertEvents(ctx context.Context, alertID int64) ([]AlertEvent, error)
+	GetAlertForUpdate(ctx context.Context, id int64) (Alert, error)
+	// alerts count against a plan until they are completed or deleted, except_id leaves out an alert being updated
+	GetAlertUsage(ctx context.Context, arg GetAlertUsageParams) (GetAlertUsageRow, error)
+	GetApiKeyByHash(ctx context.Context, keyHash string) (ApiKey, error)
+	GetCandleBefore(ctx context.Context, arg GetCandleBeforeParams) (Candle, error)
+	GetCandles(ctx context.Context, arg GetCandlesParams) ([]Candle, error)
+	// every pending letter when no ids are given, letters another admin is replaying are skipped
+	GetDeadLettersForReplay(ctx context.Context, arg GetDeadLettersForReplayParams) ([]DeadLetter, error)
+	// how many places the user logged in from, and from how many of them with this ip or device
+	GetKnownLogin(ctx context.Context, arg GetKnownLoginParams) (GetKnownLoginRow, error)
+	GetOidcIdentity(ctx context.Context, arg GetOidcIdentityParams) (OidcIdentity, error)
 	GetUserByEmail(ctx context.Context, email string) (User, error)
 	GetUserById(ctx context.Context, id int64) (User, error)
+	// locks the user so attempts to log in at the same time are counted one after the other
+	GetUserForUpdate(ctx context.Context, id int64) (User, error)
+	GetUserPlan(ctx context.Context, id int64) (Plan, error)
+	// locks the user so alerts created at the same time are counted against the plan one after the other
+	GetUserPlanForUpdate(ctx context.Context, id int64) (Plan, error)
+	ImportAlert(ctx context.Context, arg ImportAlertParams) (Alert, error)
+	ListAlertsByCreatedAt(ctx context.Context, arg ListAlertsByCreatedAtParams) ([]Alert, error)
+	ListAlertsByPair(ctx context.Context, arg ListAlertsByPairParams) ([]Alert, error)
+	ListAlertsByPrice(ctx context.Context, arg ListAlertsByPriceParams) ([]Alert, error)
+	ListApiKeys(ctx context.Context, userID int64) ([]ApiKey, error)
+	// newest first, a page continues below the last id of the one before
+	ListAuditLog(ctx context.Context, arg ListAuditLogParams) ([]AuditLog, error)
+	// letters not replayed yet, oldest first
+	ListDeadLetters(ctx context.Context, arg ListDeadLettersParams) ([]DeadLetter, error)
+	// the alerts the redis index should hold, every one still waiting to fire
+	ListWatchedAlerts(ctx context.Context) ([]Alert, error)
+	// held by a rebuild of the redis index until it commits, transactions writing the index wait for it
+	LockAlertIndex(ctx context.Context) error
+	LockUser(ctx context.Context, arg LockUserParams) error
+	MarkDeadLetterReplayed(ctx context.Context, id int64) error
+	RecordLogin(ctx context.Context, arg RecordLoginParams) error
+	RecordLoginFailure(ctx context.Context, id int64) (int32, error)
+	// an attempt counts as failed until its credential checks out, then it is taken back with the hold it
+	// put on the account
+	ReleaseLoginAttempt(ctx context.Context, id int64) (int32, error)
+	RevokeApiKey(ctx context.Context, arg RevokeApiKeyParams) (int64, error)
+	// users whose email contains the query, a page at a time in id order
+	SearchUsers(ctx context.Context, arg SearchUsersParams) ([]User, error)
+	// a new secret only replaces one that was never confirmed
+	SetTOTPSecret(ctx context.Context, arg SetTOTPSecretParams) (int64, error)
+	// held by transactions writing the redis index until they commit, a rebuild waits for all of them
+	ShareAlertIndex(ctx context.Context) error
+	// last_used_at is kept to the minute so busy bots do not write on every request
+	TouchApiKey(ctx context.Context, id int64) error
+	TriggerAlert(ctx context.Context, id int64) (Alert, error)
+	UnlockUser(ctx context.Context, id int64) (int64, error)
 	UpdateAlert(ctx context.Context, arg UpdateAlertParams) (Alert, error)
 	UpdateAlertStatus(ctx context.Context, arg UpdateAlertStatusParams) error
+	// a matching alert is returned as it is, an import never changes the status of an alert
+	UpsertAlert(ctx context.Context, arg UpsertAlertParams) (UpsertAlertRow, error)
+	UpsertCandles(ctx context.Context, arg []UpsertCandlesParams) *UpsertCandlesBatchResults
+	UseRecoveryCode(ctx context.Context, arg UseRecoveryCodeParams) (int64, error)
+	// takes the step of an accepted code, a step at or before the last one is a replay
+	UseTOTPStep(ctx context.Context, arg UseTOTPStepParams) (int64, error)
 }
 
 var _ Querier = (*Queries)(nil)
@@ -7,6 +7,7 @@ package database
 
 import (
 	"context"
+	"time"
 )
 
 const createUser = `-- name: CreateUser :one
@@ -15,7 +16,7 @@ INSERT INTO "Users" (
 ) VALUES (
   $1, $2
 )
-RETURNING id, email, hashed_password, created_at
+RETURNING id, email, hashed_password, created_at, plan, failed_logins, locked_until, totp_secret, totp_enabled, totp_last_step, role
 `
 
 type CreateUserParams struct {
@@ -31,13 +32,20 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.CreatedAt,
+		&i.Plan,
+		&i.FailedLogins,
+		&i.LockedUntil,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.Role,
 	)
 	return i, err
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-select id, email, hashed_password, created_at from "Users"
-where email = $1
+select id, email, hashed_password, created_at, plan, failed_logins, locked_until, totp_secret, totp_enabled, totp_last_step, role from "Users"
+where lower(email) = lower($1)
 `
 
 func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
@@ -48,12 +56,19 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.Email,
 		&i.HashedPassword,
 		&i.CreatedAt,
+		&i.Plan,
+		&i.FailedLogins,
+		&i.LockedUntil,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.Role,
 	)
 	return i, err
 }
 
 const getUserById = `-- name: GetUserById :one
-select id, email, hashed_password, created_at from "Users"
+select id, email, hashed_password, created_at, plan, failed_logins, locked_until, totp_secret, totp_enabled, totp_last_step, role from "Users"
 where id = $1
 limit 1
 `
@@ -66,6 +81,147 @@ func (q *Queries) GetUserById(ctx context.Context, id int64) (User, error) {
 		&i.Email,
 		&i.HashedPassword,
 		&i.CreatedAt,
+		&i.Plan,
+		&i.FailedLogins,
+		&i.LockedUntil,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.Role,
 	)
 	return i, err
 }
+
+const getUserForUpdate = `-- name: GetUserForUpdate :one
+select id, email, hashed_password, created_at, plan, failed_logins, locked_until, totp_secret, totp_enabled, totp_last_step, role from "Users"
+where id = $1
+for update
+`
+
+// locks the user so attempts to log in at the same time are counted one after the other
+func (q *Queries) GetUserForUpdate(ctx context.Context, id int64) (User, error) {
+	row := q.db.QueryRow(ctx, getUserForUpdate, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.HashedPassword,
+		&i.CreatedAt,
+		&i.Plan,
+		&i.FailedLogins,
+		&i.LockedUntil,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.Role,
+	)
+	return i, err
+}
+
+const lockUser = `-- name: LockUser :exec
+UPDATE "Users" SET
+  locked_until = $2
+WHERE id = $1
+`
+
+type LockUserParams struct {
+	ID          int64     `json:"id"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+func (q *Queries) LockUser(ctx context.Context, arg LockUserParams) error {
+	_, err := q.db.Exec(ctx, lockUser, arg.ID, arg.LockedUntil)
+	return err
+}
+
+const recordLoginFailure = `-- name: RecordLoginFailure :one
+UPDATE "Users" SET
+  failed_logins = failed_logins + 1
+WHERE id = $1
+RETURNING failed_logins
+`
+
+func (q *Queries) RecordLoginFailure(ctx context.Context, id int64) (int32, error) {
+	row := q.db.QueryRow(ctx, recordLoginFailure, id)
+	var failed_logins int32
+	err := row.Scan(&failed_logins)
+	return failed_logins, err
+}
+
+const releaseLoginAttempt = `-- name: ReleaseLoginAttempt :one
+UPDATE "Users" SET
+  failed_logins = greatest(failed_logins - 1, 0),
+  locked_until = 'epoch'
+WHERE id = $1
+RETURNING failed_logins
+`
+
+// an attempt counts as failed until its credential checks out, then it is taken back with the hold it
+// put on the account
+func (q *Queries) ReleaseLoginAttempt(ctx context.Context, id int64) (int32, error) {
+	row := q.db.QueryRow(ctx, releaseLoginAttempt, id)
+	var failed_logins int32
+	err := row.Scan(&failed_logins)
+	return failed_logins, err
+}
+
+const searchUsers = `-- name: SearchUsers :many
+SELECT id, email, hashed_password, created_at, plan, failed_logins, locked_until, totp_secret, totp_enabled, totp_last_step, role FROM "Users"
+WHERE strpos(lower("email"), lower($1::varchar)) > 0 AND "id" > $2
+ORDER BY "id"
+LIMIT $3
+`
+
+type SearchUsersParams struct {
+	Query   string `json:"query"`
+	AfterID int64  `json:"after_id"`
+	MaxRows int32  `json:"max_rows"`
+}
+
+// users whose email contains the query, a page at a time in id order
+func (q *Queries) SearchUsers(ctx context.Context, arg SearchUsersParams) ([]User, error) {
+	rows, err := q.db.Query(ctx, searchUsers, arg.Query, arg.AfterID, arg.MaxRows)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Email,
+			&i.HashedPassword,
+			&i.CreatedAt,
+			&i.Plan,
+			&i.FailedLogins,
+			&i.LockedUntil,
+			&i.TotpSecret,
+			&i.TotpEnabled,
+			&i.TotpLastStep,
+			&i.Role,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const unlockUser = `-- name: UnlockUser :execrows
+UPDATE "Users" SET
+  failed_logins = 0,
+  locked_until = 'epoch'
+WHERE id = $1
+`
+
+func (q *Queries) UnlockUser(ctx context.Context, id int64) (int64, error) {
+	result, err := q.db.Exec(ctx, unlockUser, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
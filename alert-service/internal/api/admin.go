@@ -0,0 +1,253 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"alert-service/internal/service"
+	"alert-service/internal/types"
+
+	"github.com/go-chi/chi"
+)
+
+// page size of admin listings without a limit
+const adminPageSize = 50
+
+// Search users handler
+func (a *API) searchUsers(w http.ResponseWriter, r *http.Request) error {
+	payload := r.Context().Value(AuthPayload).(*service.Payload)
+	after, limit, err := pageParams(r, "after")
+	if err != nil {
+		return err
+	}
+
+	req := types.SearchUsersRequest{
+		AdminID: payload.UserID,
+		Query:   r.URL.Query().Get("q"),
+		AfterID: after,
+		Limit:   limit,
+	}
+	err = a.validator.Struct(req)
+	if err != nil {
+		return types.NewErrValidation(err)
+	}
+
+	resp, err := a.admin.SearchUsers(r.Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(r.Context(), w, http.StatusOK, resp)
+}
+
+// User alerts handler
+func (a *API) userAlerts(w http.ResponseWriter, r *http.Request) error {
+	payload := r.Context().Value(AuthPayload).(*service.Payload)
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		return types.ErrBadRequest
+	}
+	after, limit, err := pageParams(r, "after")
+	if err != nil {
+		return err
+	}
+
+	req := types.AdminUserAlertsRequest{
+		AdminID: payload.UserID,
+		UserID:  id,
+		AfterID: after,
+		Limit:   limit,
+	}
+	err = a.validator.Struct(req)
+	if err != nil {
+		return types.NewErrValidation(err)
+	}
+
+	resp, err := a.admin.UserAlerts(r.Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(r.Context(), w, http.StatusOK, resp)
+}
+
+// Unlock user handler
+func (a *API) unlockUser(w http.ResponseWriter, r *http.Request) error {
+	payload := r.Context().Value(AuthPayload).(*service.Payload)
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		return types.ErrBadRequest
+	}
+
+	req := types.UnlockUserRequest{
+		AdminID: payload.UserID,
+		UserID:  id,
+	}
+	err = a.validator.Struct(req)
+	if err != nil {
+		return types.NewErrValidation(err)
+	}
+
+	err = a.admin.Unlock(r.Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(r.Context(), w, http.StatusOK, map[string]string{"message": "unlocked"})
+}
+
+// Disable alert handler, the body with a reason is optional
+func (a *API) disableAlert(w http.ResponseWriter, r *http.Request) error {
+	payload := r.Context().Value(AuthPayload).(*service.Payload)
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		return types.ErrBadRequest
+	}
+
+	var req types.DisableAlertRequest
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return types.ErrBadRequest
+	}
+
+	req.AdminID = payload.UserID
+	req.AlertID = id
+	err = a.validator.Struct(req)
+	if err != nil {
+		return types.NewErrValidation(err)
+	}
+
+	err = a.admin.DisableAlert(r.Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(r.Context(), w, http.StatusOK, map[string]string{"message": "disabled"})
+}
+
+// Watcher pairs handler
+func (a *API) watcherPairs(w http.ResponseWriter, r *http.Request) error {
+	payload := r.Context().Value(AuthPayload).(*service.Payload)
+
+	resp, err := a.admin.WatcherPairs(r.Context(), payload.UserID)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(r.Context(), w, http.StatusOK, resp)
+}
+
+// Rebuild cache handler
+func (a *API) rebuildCache(w http.ResponseWriter, r *http.Request) error {
+	payload := r.Context().Value(AuthPayload).(*service.Payload)
+
+	resp, err := a.admin.RebuildCache(r.Context(), payload.UserID)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(r.Context(), w, http.StatusOK, resp)
+}
+
+// Dead letters handler
+func (a *API) deadLetters(w http.ResponseWriter, r *http.Request) error {
+	payload := r.Context().Value(AuthPayload).(*service.Payload)
+	after, limit, err := pageParams(r, "after")
+	if err != nil {
+		return err
+	}
+
+	req := types.ListPageRequest{
+		AdminID: payload.UserID,
+		Cursor:  after,
+		Limit:   limit,
+	}
+	err = a.validator.Struct(req)
+	if err != nil {
+		return types.NewErrValidation(err)
+	}
+
+	resp, err := a.admin.DeadLetters(r.Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(r.Context(), w, http.StatusOK, resp)
+}
+
+// Replay dead letters handler, without ids the oldest pending letters are replayed
+func (a *API) replayDeadLetters(w http.ResponseWriter, r *http.Request) error {
+	payload := r.Context().Value(AuthPayload).(*service.Payload)
+	var req types.ReplayDeadLettersRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return types.ErrBadRequest
+	}
+
+	req.AdminID = payload.UserID
+	err = a.validator.Struct(req)
+	if err != nil {
+		return types.NewErrValidation(err)
+	}
+
+	resp, err := a.admin.ReplayDeadLetters(r.Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(r.Context(), w, http.StatusOK, resp)
+}
+
+// Audit log handler, newest first
+func (a *API) auditLog(w http.ResponseWriter, r *http.Request) error {
+	payload := r.Context().Value(AuthPayload).(*service.Payload)
+	before, limit, err := pageParams(r, "before")
+	if err != nil {
+		return err
+	}
+
+	req := types.ListPageRequest{
+		AdminID: payload.UserID,
+		Cursor:  before,
+		Limit:   limit,
+	}
+	err = a.validator.Struct(req)
+	if err != nil {
+		return types.NewErrValidation(err)
+	}
+
+	resp, err := a.admin.AuditLog(r.Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(r.Context(), w, http.StatusOK, resp)
+}
+
+// pageParams reads the id a listing continues from and its limit, both optional
+func pageParams(r *http.Request, cursor string) (int64, int32, error) {
+	query := r.URL.Query()
+
+	var id int64
+	if s := query.Get(cursor); s != "" {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return 0, 0, types.ErrBadRequest
+		}
+		id = n
+	}
+
+	limit := int32(adminPageSize)
+	if s := query.Get("limit"); s != "" {
+		n, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			return 0, 0, types.ErrBadRequest
+		}
+		limit = int32(n)
+	}
+
+	return id, limit, nil
+}
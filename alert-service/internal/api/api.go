@@ -0,0 +1,984 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"expvar"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"alert-service/internal/cache"
+	"alert-service/internal/health"
+	"alert-service/internal/logger"
+	"alert-service/internal/service"
+	"alert-service/internal/types"
+
+	"github.com/go-chi/chi"
+	"github.com/go-playground/validator"
+)
+
+// largest import body accepted
+const maxImportSize = 1 << 20
+
+type API struct {
+	listenAddr string
+	token      service.Maker
+	auth       service.Auther
+	admin      service.Admin
+	validator  *validator.Validate
+	alert      service.Alerter
+	market     service.Marketer
+	backtest   service.Backtester
+	cache      cache.Cacher
+	checks     health.Checks
+	limits     RateLimitConfig
+}
+
+func NewAPI(listenAddr string, token service.Maker, auth service.Auther, admin service.Admin, validator *validator.Validate, alert service.Alerter, market service.Marketer, backtest service.Backtester, cache cache.Cacher, checks health.Checks, limits RateLimitConfig) *API {
+	return &API{
+		listenAddr: listenAddr,
+		token:      token,
+		auth:       auth,
+		admin:      admin,
+		validator:  validator,
+		alert:      alert,
+		market:     market,
+		backtest:   backtest,
+		cache:      cache,
+		checks:     checks,
+		limits:     limits,
+	}
+}
+
+func (a *API) Run(ctx context.Context) *http.Server {
+	mux := chi.NewRouter()
+
+	// public routes
+	mux.Group(func(mux chi.Router) {
+		mux.Get("/", a.handle(a.root))
+		mux.Post("/signup", a.handle(a.rateLimit(a.limits.auth, a.signUp)))
+		mux.Get("/login", a.handle(a.rateLimit(a.limits.auth, a.login)))
+		mux.Get("/.well-known/jwks.json", a.handle(a.rateLimit(a.limits.read, a.publicKeys)))
+	})
+
+	// two-factor authentication
+	mux.Route("/v1/auth/totp", func(mux chi.Router) {
+		mux.Post("/enroll", a.handle(a.rateLimit(a.limits.auth, a.tokenMiddleware(service.ScopeAccount, a.userLimit(a.limits.auth, a.enrollTOTP)))))
+		mux.Post("/confirm", a.handle(a.rateLimit(a.limits.auth, a.tokenMiddleware(service.ScopeAccount, a.userLimit(a.limits.auth, a.confirmTOTP)))))
+		mux.Post("/login", a.handle(a.rateLimit(a.limits.auth, a.mfaMiddleware(a.userLimit(a.limits.auth, a.loginTOTP)))))
+		mux.Post("/step-up", a.handle(a.rateLimit(a.limits.auth, a.tokenMiddleware(service.ScopeAccount, a.userLimit(a.limits.auth, a.stepUpTOTP)))))
+	})
+
+	// single sign-on, the provider sends the browser back to the callback
+	mux.Route("/v1/auth/oidc", func(mux chi.Router) {
+		mux.Get("/login", a.handle(a.rateLimit(a.limits.auth, a.startOIDC)))
+		mux.Post("/link", a.handle(a.rateLimit(a.limits.auth, a.tokenMiddleware(service.ScopeAccount, a.stepUp(a.userLimit(a.limits.auth, a.linkOIDC))))))
+		mux.Get("/callback", a.handle(a.rateLimit(a.limits.auth, a.finishOIDC)))
+	})
+
+	// api keys, managed with a login and used by bots on the alert routes
+	mux.Route("/v1/auth/keys", func(mux chi.Router) {
+		mux.Post("/", a.handle(a.rateLimit(a.limits.write, a.tokenMiddleware(service.ScopeAccount, a.stepUp(a.userLimit(a.limits.write, a.createAPIKey))))))
+		mux.Get("/", a.handle(a.rateLimit(a.limits.read, a.tokenMiddleware(service.ScopeAccount, a.userLimit(a.limits.read, a.listAPIKeys)))))
+		mux.Delete("/{id}", a.handle(a.rateLimit(a.limits.write, a.tokenMiddleware(service.ScopeAccount, a.userLimit(a.limits.write, a.revokeAPIKey)))))
+	})
+
+	// private routes
+	mux.Route("/alerts", func(mux chi.Router) {
+		mux.Post("/create", a.handle(a.rateLimit(a.limits.write, a.authMiddleware(service.ScopeAlertsWrite, a.userLimit(a.limits.write, a.createAlert)))))
+		mux.Post("/create/expression", a.handle(a.rateLimit(a.limits.write, a.authMiddleware(service.ScopeAlertsWrite, a.userLimit(a.limits.write, a.createExpressionAlert)))))
+		mux.Get("/read", a.handle(a.rateLimit(a.limits.read, a.authMiddleware(service.ScopeAlertsRead, a.userLimit(a.limits.read, a.readAlert)))))
+		mux.Put("/update", a.handle(a.rateLimit(a.limits.write, a.authMiddleware(service.ScopeAlertsWrite, a.userLimit(a.limits.write, a.updateAlert)))))
+		mux.Delete("/delete", a.handle(a.rateLimit(a.limits.write, a.authMiddleware(service.ScopeAlertsWrite, a.stepUp(a.userLimit(a.limits.write, a.deleteAlert))))))
+	})
+
+	mux.Route("/v1/alerts", func(mux chi.Router) {
+		mux.Get("/", a.handle(a.rateLimit(a.limits.read, a.tokenMiddleware(service.ScopeAlertsRead, a.userLimit(a.limits.read, a.listAlerts)))))
+		mux.Get("/export", a.handle(a.rateLimit(a.limits.read, a.tokenMiddleware(service.ScopeAlertsRead, a.userLimit(a.limits.read, a.exportAlerts)))))
+		mux.Post("/import", a.handle(a.rateLimit(a.limits.write, a.tokenMiddleware(service.ScopeAlertsWrite, a.userLimit(a.limits.write, a.importAlerts)))))
+		mux.Get("/{id}/history", a.handle(a.rateLimit(a.limits.read, a.tokenMiddleware(service.ScopeAlertsRead, a.userLimit(a.limits.read, a.alertHistory)))))
+		mux.Get("/usage", a.handle(a.rateLimit(a.limits.read, a.tokenMiddleware(service.ScopeAlertsRead, a.userLimit(a.limits.read, a.alertUsage)))))
+		// backtests scan candles, they are counted as writes
+		mux.Post("/backtest", a.handle(a.rateLimit(a.limits.write, a.authMiddleware(service.ScopeAlertsRead, a.userLimit(a.limits.write, a.backtestAlert)))))
+	})
+
+	// bulk alert operations, each one applied in a single transaction
+	mux.Post("/v1/alerts:batchCreate", a.handle(a.rateLimit(a.limits.write, a.authMiddleware(service.ScopeAlertsWrite, a.userLimit(a.limits.write, a.batchCreateAlerts)))))
+	mux.Post("/v1/alerts:batchUpdate", a.handle(a.rateLimit(a.limits.write, a.authMiddleware(service.ScopeAlertsWrite, a.userLimit(a.limits.write, a.batchUpdateAlerts)))))
+	mux.Post("/v1/alerts:batchDelete", a.handle(a.rateLimit(a.limits.write, a.authMiddleware(service.ScopeAlertsWrite, a.stepUp(a.userLimit(a.limits.write, a.batchDeleteAlerts))))))
+
+	// live ticks and alert transitions over websocket or server sent events
+	mux.Get("/v1/stream", a.handle(a.rateLimit(a.limits.stream, a.streamMiddleware(service.ScopeAlertsRead, a.userLimit(a.limits.stream, a.stream)))))
+
+	// public market data
+	mux.Route("/v1/markets", func(mux chi.Router) {
+		mux.Get("/", a.handle(a.rateLimit(a.limits.read, a.readTickers)))
+		mux.Get("/{pair}", a.handle(a.rateLimit(a.limits.read, a.readTicker)))
+		mux.Get("/{pair}/candles", a.handle(a.rateLimit(a.limits.read, a.readCandles)))
+	})
+
+	// admin actions, the service checks the role again and audits every one of them
+	mux.Route("/v1/admin", func(mux chi.Router) {
+		mux.Get("/users", a.handle(a.rateLimit(a.limits.read, a.tokenMiddleware(service.ScopeAdmin, a.userLimit(a.limits.read, a.searchUsers)))))
+		mux.Get("/users/{id}/alerts", a.handle(a.rateLimit(a.limits.read, a.tokenMiddleware(service.ScopeAdmin, a.userLimit(a.limits.read, a.userAlerts)))))
+		mux.Post("/users/{id}/unlock", a.handle(a.rateLimit(a.limits.write, a.tokenMiddleware(service.ScopeAdmin, a.stepUp(a.userLimit(a.limits.write, a.unlockUser))))))
+		mux.Post("/alerts/{id}/disable", a.handle(a.rateLimit(a.limits.write, a.tokenMiddleware(service.ScopeAdmin, a.stepUp(a.userLimit(a.limits.write, a.disableAlert))))))
+		mux.Get("/watcher", a.handle(a.rateLimit(a.limits.read, a.tokenMiddleware(service.ScopeAdmin, a.userLimit(a.limits.read, a.watcherPairs)))))
+		mux.Post("/cache/rebuild", a.handle(a.rateLimit(a.limits.write, a.tokenMiddleware(service.ScopeAdmin, a.stepUp(a.userLimit(a.limits.write, a.rebuildCache))))))
+		mux.Get("/dlq", a.handle(a.rateLimit(a.limits.read, a.tokenMiddleware(service.ScopeAdmin, a.userLimit(a.limits.read, a.deadLetters)))))
+		mux.Post("/dlq/replay", a.handle(a.rateLimit(a.limits.write, a.tokenMiddleware(service.ScopeAdmin, a.stepUp(a.userLimit(a.limits.write, a.replayDeadLetters))))))
+		mux.Get("/audit", a.handle(a.rateLimit(a.limits.read, a.tokenMiddleware(service.ScopeAdmin, a.userLimit(a.limits.read, a.auditLog)))))
+	})
+
+	// watcher health, public so load balancers and monitors can poll it
+	mux.Get("/v1/health/watcher", a.handle(a.watcherHealth))
+
+	// process metrics
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	// liveness and readiness of the api itself
+	health.Mount(mux, a.checks)
+
+	server := &http.Server{
+		Addr:    a.listenAddr,
+		Handler: mux,
+		BaseContext: func(_ net.Listener) context.Context {
+			return ctx
+		},
+	}
+
+	return server
+}
+
+// Root handler
+func (a *API) root(w http.ResponseWriter, r *http.Request) error {
+	resp := map[string]string{"message": "ok"}
+	return writeJSON(r.Context(), w, http.StatusOK, resp)
+}
+
+// Sign Up handler
+func (a *API) signUp(w http.ResponseWriter, r *http.Request) error {
+	var req types.SignUpUserRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return types.ErrBadRequest
+	}
+
+	err = a.validator.Struct(req)
+	if err != nil {
+		return types.NewErrValidation(err)
+	}
+
+	resp, err := a.auth.SignUp(r.Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(r.Context(), w, http.StatusOK, resp)
+}
+
+// Login handler
+func (a *API) login(w http.ResponseWriter, r *http.Request) error {
+	var req types.LoginUserRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return types.ErrBadRequest
+	}
+
+	err = a.validator.Struct(req)
+	if err != nil {
+		return types.NewErrValidation(err)
+	}
+
+	req.IP = a.clientIP(r)
+	req.UserAgent = r.UserAgent()
+	resp, err := a.auth.Login(r.Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(r.Context(), w, http.StatusOK, resp)
+}
+
+// Public keys handler, verifiers may cache the set for a few minutes since keys are published before
+// they start signing
+func (a *API) publicKeys(w http.ResponseWriter, r *http.Request) error {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	return writeJSON(r.Context(), w, http.StatusOK, types.PublicKeySet{Keys: a.token.PublicKeys()})
+}
+
+// Enroll TOTP handler
+func (a *API) enrollTOTP(w http.ResponseWriter, r *http.Request) error {
+	payload := r.Context().Value(AuthPayload).(*service.Payload)
+
+	resp, err := a.auth.EnrollTOTP(r.Context(), payload.UserID)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(r.Context(), w, http.StatusOK, resp)
+}
+
+// Confirm TOTP handler
+func (a *API) confirmTOTP(w http.ResponseWriter, r *http.Request) error {
+	payload := r.Context().Value(AuthPayload).(*service.Payload)
+	var req types.TOTPRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return types.ErrBadRequest
+	}
+
+	req.UserID = payload.UserID
+	err = a.validator.Struct(req)
+	if err != nil {
+		return types.NewErrValidation(err)
+	}
+
+	resp, err := a.auth.ConfirmTOTP(r.Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(r.Context(), w, http.StatusOK, resp)
+}
+
+// Login TOTP handler
+func (a *API) loginTOTP(w http.ResponseWriter, r *http.Request) error {
+	payload := r.Context().Value(AuthPayload).(*service.Payload)
+	var req types.LoginTOTPRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return types.ErrBadRequest
+	}
+
+	req.UserID = payload.UserID
+	err = a.validator.Struct(req)
+	if err != nil {
+		return types.NewErrValidation(err)
+	}
+
+	req.IP = a.clientIP(r)
+	req.UserAgent = r.UserAgent()
+	resp, err := a.auth.LoginTOTP(r.Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(r.Context(), w, http.StatusOK, resp)
+}
+
+// Step up handler
+func (a *API) stepUpTOTP(w http.ResponseWriter, r *http.Request) error {
+	payload := r.Context().Value(AuthPayload).(*service.Payload)
+	var req types.TOTPRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return types.ErrBadRequest
+	}
+
+	req.UserID = payload.UserID
+	req.IP = a.clientIP(r)
+	req.UserAgent = r.UserAgent()
+	err = a.validator.Struct(req)
+	if err != nil {
+		return types.NewErrValidation(err)
+	}
+
+	resp, err := a.auth.StepUp(r.Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(r.Context(), w, http.StatusOK, resp)
+}
+
+// Create API key handler
+func (a *API) createAPIKey(w http.ResponseWriter, r *http.Request) error {
+	payload := r.Context().Value(AuthPayload).(*service.Payload)
+	var req types.CreateAPIKeyRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return types.ErrBadRequest
+	}
+
+	req.UserID = payload.UserID
+	err = a.validator.Struct(req)
+	if err != nil {
+		return types.NewErrValidation(err)
+	}
+
+	resp, err := a.auth.CreateAPIKey(r.Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(r.Context(), w, http.StatusOK, resp)
+}
+
+// List API keys handler
+func (a *API) listAPIKeys(w http.ResponseWriter, r *http.Request) error {
+	payload := r.Context().Value(AuthPayload).(*service.Payload)
+
+	resp, err := a.auth.ListAPIKeys(r.Context(), payload.UserID)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(r.Context(), w, http.StatusOK, resp)
+}
+
+// Revoke API key handler
+func (a *API) revokeAPIKey(w http.ResponseWriter, r *http.Request) error {
+	payload := r.Context().Value(AuthPayload).(*service.Payload)
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		return types.ErrBadRequest
+	}
+
+	req := types.RevokeAPIKeyRequest{
+		UserID: payload.UserID,
+		ID:     id,
+	}
+	err = a.validator.Struct(req)
+	if err != nil {
+		return types.NewErrValidation(err)
+	}
+
+	err = a.auth.RevokeAPIKey(r.Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(r.Context(), w, http.StatusOK, map[string]string{"message": "revoked"})
+}
+
+// Create Alert handler
+func (a *API) createAlert(w http.ResponseWriter, r *http.Request) error {
+	var req types.CreateAlertRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return types.ErrBadRequest
+	}
+
+	err = a.validator.Struct(req)
+	if err != nil {
+		return types.NewErrValidation(err)
+	}
+
+	resp, err := a.alert.Create(r.Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(r.Context(), w, http.StatusOK, resp)
+}
+
+// Create Expression Alert handler
+func (a *API) createExpressionAlert(w http.ResponseWriter, r *http.Request) error {
+	var req types.CreateExpressionAlertRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return types.ErrBadRequest
+	}
+
+	err = a.validator.Struct(req)
+	if err != nil {
+		return types.NewErrValidation(err)
+	}
+
+	resp, err := a.alert.CreateExpression(r.Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(r.Context(), w, http.StatusOK, resp)
+}
+
+// Read Alert handler
+func (a *API) readAlert(w http.ResponseWriter, r *http.Request) error {
+	var req types.ListAlertsRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return types.ErrBadRequest
+	}
+
+	return a.writeAlertPage(w, r, req)
+}
+
+// List alerts handler, the same listing as readAlert with the filters in the query string
+func (a *API) listAlerts(w http.ResponseWriter, r *http.Request) error {
+	payload := r.Context().Value(AuthPayload).(*service.Payload)
+	query := r.URL.Query()
+
+	req := types.ListAlertsRequest{
+		UserID: payload.UserID,
+		Sort:   query.Get("sort"),
+		Pair:   query.Get("pair"),
+		Cursor: query.Get("cursor"),
+	}
+	for _, status := range query["status"] {
+		req.Status = append(req.Status, strings.Split(status, ",")...)
+	}
+
+	var err error
+	req.From, err = types.ParseTime(query.Get("from"))
+	if err != nil {
+		return types.ErrBadRequest
+	}
+	req.To, err = types.ParseTime(query.Get("to"))
+	if err != nil {
+		return types.ErrBadRequest
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.ParseInt(limit, 10, 32)
+		if err != nil {
+			return types.ErrBadRequest
+		}
+		req.Limit = int32(n)
+	}
+
+	return a.writeAlertPage(w, r, req)
+}
+
+func (a *API) writeAlertPage(w http.ResponseWriter, r *http.Request, req types.ListAlertsRequest) error {
+	err := a.validator.Struct(req)
+	if err != nil {
+		return types.NewErrValidation(err)
+	}
+
+	resp, err := a.alert.List(r.Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(r.Context(), w, http.StatusOK, resp)
+}
+
+// update alert handler
+func (a *API) updateAlert(w http.ResponseWriter, r *http.Request) error {
+	var req types.UpdateAlertRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return types.ErrBadRequest
+	}
+
+	err = a.validator.Struct(req)
+	if err != nil {
+		return types.NewErrValidation(err)
+	}
+
+	resp, err := a.alert.Update(r.Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(r.Context(), w, http.StatusOK, resp)
+}
+
+// Delete Alert handler
+func (a *API) deleteAlert(w http.ResponseWriter, r *http.Request) error {
+	var req types.DeleteAlertRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return types.ErrBadRequest
+	}
+
+	err = a.validator.Struct(req)
+	if err != nil {
+		return types.NewErrValidation(err)
+	}
+
+	err = a.alert.Delete(r.Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(r.Context(), w, http.StatusOK, nil)
+}
+
+// Batch create handler, the alerts are listed or generated from a price ladder
+func (a *API) batchCreateAlerts(w http.ResponseWriter, r *http.Request) error {
+	var req types.BatchCreateAlertsRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return types.ErrBadRequest
+	}
+
+	err = a.validator.Struct(req)
+	if err != nil {
+		return types.NewErrValidation(err)
+	}
+
+	resp, err := a.alert.BatchCreate(r.Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(r.Context(), w, batchStatus(resp), resp)
+}
+
+// Batch update handler
+func (a *API) batchUpdateAlerts(w http.ResponseWriter, r *http.Request) error {
+	var req types.BatchUpdateAlertsRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return types.ErrBadRequest
+	}
+
+	err = a.validator.Struct(req)
+	if err != nil {
+		return types.NewErrValidation(err)
+	}
+
+	resp, err := a.alert.BatchUpdate(r.Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(r.Context(), w, batchStatus(resp), resp)
+}
+
+// Batch delete handler
+func (a *API) batchDeleteAlerts(w http.ResponseWriter, r *http.Request) error {
+	var req types.BatchDeleteAlertsRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return types.ErrBadRequest
+	}
+
+	err = a.validator.Struct(req)
+	if err != nil {
+		return types.NewErrValidation(err)
+	}
+
+	resp, err := a.alert.BatchDelete(r.Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(r.Context(), w, batchStatus(resp), resp)
+}
+
+// a rolled back batch is unprocessable, a partly applied one is a multi status
+func batchStatus(resp service.BatchResult) int {
+	switch {
+	case !resp.Applied:
+		return http.StatusUnprocessableEntity
+	case resp.Failed > 0:
+		return http.StatusMultiStatus
+	}
+	return http.StatusOK
+}
+
+// Alert history handler
+func (a *API) alertHistory(w http.ResponseWriter, r *http.Request) error {
+	payload := r.Context().Value(AuthPayload).(*service.Payload)
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		return types.ErrBadRequest
+	}
+
+	req := types.AlertHistoryRequest{
+		AlertID: id,
+		UserID:  payload.UserID,
+	}
+	err = a.validator.Struct(req)
+	if err != nil {
+		return types.NewErrValidation(err)
+	}
+
+	resp, err := a.alert.History(r.Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(r.Context(), w, http.StatusOK, resp)
+}
+
+// Alert usage handler, the plan of the caller with what is left of it
+func (a *API) alertUsage(w http.ResponseWriter, r *http.Request) error {
+	payload := r.Context().Value(AuthPayload).(*service.Payload)
+	resp, err := a.alert.Usage(r.Context(), payload.UserID)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(r.Context(), w, http.StatusOK, resp)
+}
+
+// Export alerts handler, the file is streamed so the status is sent before the alerts are read
+func (a *API) exportAlerts(w http.ResponseWriter, r *http.Request) error {
+	payload := r.Context().Value(AuthPayload).(*service.Payload)
+	req := types.ExportAlertsRequest{
+		UserID: payload.UserID,
+		Format: r.URL.Query().Get("format"),
+	}
+	if req.Format == "" {
+		req.Format = types.FormatJSON
+	}
+
+	err := a.validator.Struct(req)
+	if err != nil {
+		return types.NewErrValidation(err)
+	}
+
+	contentType := "application/json"
+	if req.Format == types.FormatCSV {
+		contentType = "text/csv"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="alerts.`+req.Format+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	err = a.alert.Export(r.Context(), req, w)
+	if err != nil {
+		// too late for an error response, the client gets a truncated file
+		logger.Error().
+			Str("route", r.Context().Value(Route).(string)).
+			Str("method", r.Context().Value(Method).(string)).
+			Str("err", err.Error()).
+			Msg("export aborted")
+		return nil
+	}
+
+	logger.Info().
+		Int("status", http.StatusOK).
+		Str("route", r.Context().Value(Route).(string)).
+		Str("method", r.Context().Value(Method).(string)).
+		Send()
+	return nil
+}
+
+// Import alerts handler, the body is a csv file or json array as written by the export
+func (a *API) importAlerts(w http.ResponseWriter, r *http.Request) error {
+	payload := r.Context().Value(AuthPayload).(*service.Payload)
+	query := r.URL.Query()
+
+	req := types.ImportAlertsRequest{
+		UserID:     payload.UserID,
+		Format:     query.Get("format"),
+		OnConflict: query.Get("on_conflict"),
+	}
+	if req.Format == "" {
+		req.Format = types.FormatJSON
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+			req.Format = types.FormatCSV
+		}
+	}
+	if req.OnConflict == "" {
+		req.OnConflict = types.ConflictSkip
+	}
+	if dryRun := query.Get("dry_run"); dryRun != "" {
+		var err error
+		req.DryRun, err = strconv.ParseBool(dryRun)
+		if err != nil {
+			return types.ErrBadRequest
+		}
+	}
+
+	err := a.validator.Struct(req)
+	if err != nil {
+		return types.NewErrValidation(err)
+	}
+
+	resp, err := a.alert.Import(r.Context(), req, http.MaxBytesReader(w, r.Body, maxImportSize))
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(r.Context(), w, http.StatusOK, resp)
+}
+
+// Backtest Alert handler
+func (a *API) backtestAlert(w http.ResponseWriter, r *http.Request) error {
+	var req types.BacktestRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return types.ErrBadRequest
+	}
+
+	err = a.validator.Struct(req)
+	if err != nil {
+		return types.NewErrValidation(err)
+	}
+
+	resp, err := a.backtest.Backtest(r.Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(r.Context(), w, http.StatusOK, resp)
+}
+
+// Read Tickers handler
+func (a *API) readTickers(w http.ResponseWriter, r *http.Request) error {
+	resp, err := a.market.Tickers(r.Context())
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(r.Context(), w, http.StatusOK, resp)
+}
+
+// Read Ticker handler
+func (a *API) readTicker(w http.ResponseWriter, r *http.Request) error {
+	resp, err := a.market.Ticker(r.Context(), chi.URLParam(r, "pair"))
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(r.Context(), w, http.StatusOK, resp)
+}
+
+// Watcher Health handler, anything but ok is served as unavailable
+func (a *API) watcherHealth(w http.ResponseWriter, r *http.Request) error {
+	resp, err := a.market.Health(r.Context())
+	if err != nil {
+		return err
+	}
+
+	status := http.StatusOK
+	if resp.Status != types.HealthOK {
+		status = http.StatusServiceUnavailable
+	}
+	return writeJSON(r.Context(), w, status, resp)
+}
+
+// Read Candles handler
+func (a *API) readCandles(w http.ResponseWriter, r *http.Request) error {
+	req := types.ReadCandlesRequest{
+		Pair:     chi.URLParam(r, "pair"),
+		Interval: r.URL.Query().Get("interval"),
+	}
+	if req.Interval == "" {
+		req.Interval = "1m"
+	}
+
+	var err error
+	req.From, err = types.ParseTime(r.URL.Query().Get("from"))
+	if err != nil {
+		return types.ErrBadRequest
+	}
+	req.To, err = types.ParseTime(r.URL.Query().Get("to"))
+	if err != nil {
+		return types.ErrBadRequest
+	}
+
+	err = a.validator.Struct(req)
+	if err != nil {
+		return types.NewErrValidation(err)
+	}
+
+	resp, err := a.market.Candles(r.Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(r.Context(), w, http.StatusOK, resp)
+}
+
+type contextKey string
+
+const (
+	Route  contextKey = "route"
+	Method contextKey = "method"
+	// verified token payload of the caller
+	AuthPayload contextKey = "auth_payload"
+)
+
+// centralize error handling
+type Handler func(w http.ResponseWriter, r *http.Request) error
+
+type ApiError struct {
+	Error string `json:"error"`
+}
+
+func (a *API) handle(next Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r = r.WithContext(context.WithValue(r.Context(), Route, r.URL.Path))
+		r = r.WithContext(context.WithValue(r.Context(), Method, r.Method))
+
+		if err := next(w, r); err != nil {
+			switch err {
+			case types.ErrBadRequest, types.ErrNoAuthHeader, types.ErrInvalidAuthHeader, types.ErrUnsupportedAuthType, types.ErrUserAlreadyExists, types.ErrDuplicateAlert, types.ErrAlertNotFound, types.ErrExpressionAlert, types.ErrUnknownPair, types.ErrInvalidCursor, types.ErrUserNotFound, types.ErrTOTPEnabled, types.ErrTOTPNotEnrolled, types.ErrInvalidTOTPCode, types.ErrAPIKeyNotFound, types.ErrInvalidExpiry, types.ErrAlertNotActive, types.ErrInvalidOIDCState:
+				writeJSON(r.Context(), w, http.StatusBadRequest, ApiError{Error: err.Error()})
+
+			case types.ErrNotAuthorized, types.ErrTokenExpired, types.ErrInvalidToken, types.ErrStepUpRequired, types.ErrOIDCLoginFailed:
+				writeJSON(r.Context(), w, http.StatusUnauthorized, ApiError{Error: err.Error()})
+
+			case types.ErrTickerNotFound, types.ErrMarketNotFound:
+				writeJSON(r.Context(), w, http.StatusNotFound, ApiError{Error: err.Error()})
+
+			case types.ErrRateLimited:
+				writeJSON(r.Context(), w, http.StatusTooManyRequests, ApiError{Error: err.Error()})
+
+			case types.ErrForbidden, types.ErrOIDCEmailUnverified, types.ErrOIDCLinkRequired, types.ErrOIDCIdentityLinked:
+				writeJSON(r.Context(), w, http.StatusForbidden, ApiError{Error: err.Error()})
+
+			case types.ErrReplayUnavailable, types.ErrOIDCUnavailable:
+				writeJSON(r.Context(), w, http.StatusServiceUnavailable, ApiError{Error: err.Error()})
+
+			default:
+				if vErr, ok := err.(*types.ErrValidation); ok {
+					writeJSON(r.Context(), w, http.StatusBadRequest, ApiError{Error: vErr.Error()})
+				} else if qErr, ok := err.(*types.ErrQuotaExceeded); ok {
+					writeJSON(r.Context(), w, http.StatusForbidden, ApiError{Error: qErr.Error()})
+				} else if lErr, ok := err.(*types.ErrLoginLocked); ok {
+					w.Header().Set("Retry-After", seconds(lErr.RetryAfter))
+					writeJSON(r.Context(), w, http.StatusTooManyRequests, ApiError{Error: lErr.Error()})
+				} else {
+					log.Println("critical internal server error:", err)
+					writeJSON(r.Context(), w, http.StatusInternalServerError, ApiError{Error: "internal server error"})
+				}
+			}
+		}
+	}
+}
+
+// middlewares
+type Request struct {
+	UserID int64 `json:"user_id"`
+}
+
+func (a *API) authMiddleware(scope string, next Handler) Handler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		payload, err := a.authenticate(r.Context(), r.Header.Get("authorization"), scope)
+		if err != nil {
+			return err
+		}
+
+		var req Request
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return err
+		}
+		err = json.Unmarshal(body, &req)
+		if err != nil {
+			return types.ErrBadRequest
+		}
+		if payload.UserID != req.UserID {
+			return types.ErrNotAuthorized
+		}
+
+		r.Body = io.NopCloser(bytes.NewBuffer(body))
+		r = r.WithContext(context.WithValue(r.Context(), AuthPayload, payload))
+		return next(w, r)
+	}
+}
+
+// tokenMiddleware authenticates requests without a body
+func (a *API) tokenMiddleware(scope string, next Handler) Handler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		payload, err := a.authenticate(r.Context(), r.Header.Get("authorization"), scope)
+		if err != nil {
+			return err
+		}
+
+		r = r.WithContext(context.WithValue(r.Context(), AuthPayload, payload))
+		return next(w, r)
+	}
+}
+
+// streamMiddleware is tokenMiddleware for the stream, browsers cannot set headers on websockets and
+// event sources so the token may also come as the access_token query parameter. Only there, urls end
+// up in access logs and browser history.
+func (a *API) streamMiddleware(scope string, next Handler) Handler {
+	next = a.tokenMiddleware(scope, next)
+	return func(w http.ResponseWriter, r *http.Request) error {
+		if token := r.URL.Query().Get("access_token"); r.Header.Get("authorization") == "" && token != "" {
+			r = r.Clone(r.Context())
+			r.Header.Set("Authorization", "bearer "+token)
+		}
+		return next(w, r)
+	}
+}
+
+// mfaMiddleware only takes the token handed out between the password and the second factor of a login
+func (a *API) mfaMiddleware(next Handler) Handler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		payload, err := a.authenticate(r.Context(), r.Header.Get("authorization"), service.ScopeMFA)
+		if err != nil {
+			return err
+		}
+
+		r = r.WithContext(context.WithValue(r.Context(), AuthPayload, payload))
+		return next(w, r)
+	}
+}
+
+// stepUp guards sensitive operations, it goes after the middleware that authenticated the caller.
+// Sensitive are the ones that cannot be undone or hand out access: deleting alerts, one or a batch,
+// creating api keys, linking single sign-on and every admin action that writes. Revoking a key is
+// not, a leaked key should go without delay.
+func (a *API) stepUp(next Handler) Handler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		payload := r.Context().Value(AuthPayload).(*service.Payload)
+		err := a.auth.CheckStepUp(payload)
+		if err != nil {
+			return err
+		}
+		return next(w, r)
+	}
+}
+
+// authenticate verifies the bearer token or api key of an authorization header, callers the route
+// scope is not open to are refused
+func (a *API) authenticate(ctx context.Context, authorizationHeader string, scope string) (*service.Payload, error) {
+	if len(authorizationHeader) == 0 {
+		return nil, types.ErrNoAuthHeader
+	}
+
+	fields := strings.Fields(authorizationHeader)
+	if len(fields) < 2 {
+		return nil, types.ErrInvalidAuthHeader
+	}
+
+	authorizationType := strings.ToLower(fields[0])
+	if authorizationType != "bearer" {
+		return nil, types.ErrUnsupportedAuthType
+	}
+
+	var payload *service.Payload
+	var err error
+	if credential := fields[1]; service.IsAPIKey(credential) {
+		payload, err = a.auth.AuthenticateAPIKey(ctx, credential)
+	} else {
+		payload, err = a.token.Verify(credential)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !payload.Allows(scope) {
+		return nil, types.ErrForbidden
+	}
+	return payload, nil
+}
+
+// helper function
+func writeJSON(ctx context.Context, w http.ResponseWriter, s int, v any) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(s)
+
+	// centralized logging
+	if apiErr, ok := v.(ApiError); ok {
+		logger.Error().
+			Int("status", s).
+			Str("route", ctx.Value(Route).(string)).
+			Str("method", ctx.Value(Method).(string)).
+			Str("err", apiErr.Error).
+			Send()
+	} else {
+		logger.Info().
+			Int("status", s).
+			Str("route", ctx.Value(Route).(string)).
+			Str("method", ctx.Value(Method).(string)).
+			Send()
+	}
+
+	return json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"alert-service/internal/service"
+
+	"github.com/go-chi/chi"
+	"github.com/go-playground/validator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryToken(t *testing.T) {
+	maker, err := service.NewPasetoMaker("01234567890123456789012345678901")
+	require.NoError(t, err)
+	token, _, err := maker.Create(1, time.Minute, service.Claims{})
+	require.NoError(t, err)
+	a := &API{token: maker}
+
+	ok := func(w http.ResponseWriter, r *http.Request) error {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	serve := func(h Handler, header string) int {
+		req := httptest.NewRequest(http.MethodGet, "/v1/stream?access_token="+token, nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		rec := httptest.NewRecorder()
+		a.handle(h)(rec, req)
+		return rec.Code
+	}
+
+	// only the stream takes a token from the url, browsers cannot set headers there
+	assert.Equal(t, http.StatusNoContent, serve(a.streamMiddleware(service.ScopeAlertsRead, ok), ""))
+	assert.Equal(t, http.StatusBadRequest, serve(a.tokenMiddleware(service.ScopeAlertsRead, ok), ""))
+	assert.Equal(t, http.StatusNoContent, serve(a.tokenMiddleware(service.ScopeAlertsRead, ok), "Bearer "+token))
+
+	// a header that is there wins over the url
+	assert.Equal(t, http.StatusBadRequest, serve(a.streamMiddleware(service.ScopeAlertsRead, ok), "Basic secret"))
+}
+
+func TestMarketNotFound(t *testing.T) {
+	a := &API{market: service.NewMarketService(nil, nil), validator: validator.New()}
+	mux := chi.NewRouter()
+	mux.Get("/v1/markets/{pair}", a.handle(a.readTicker))
+	mux.Get("/v1/markets/{pair}/candles", a.handle(a.readCandles))
+
+	// a pair that is not traded is a market that does not exist
+	for _, path := range []string{"/v1/markets/dogeusdt", "/v1/markets/dogeusdt/candles"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code, path)
+	}
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"time"
+
+	"alert-service/internal/service"
+	"alert-service/internal/types"
+)
+
+// the state of a login is also kept in a cookie of the browser that started it, so a link with the
+// code and state of someone else's login does not log the browser in as them
+const oidcStateCookie = "oidc_state"
+
+// Start OIDC handler, redirects the browser to the identity provider
+func (a *API) startOIDC(w http.ResponseWriter, r *http.Request) error {
+	start, err := a.auth.StartOIDC(r.Context())
+	if err != nil {
+		return err
+	}
+
+	setOIDCState(w, r, start)
+	http.Redirect(w, r, start.URL, http.StatusFound)
+	return nil
+}
+
+// Link OIDC handler, answers where to send the browser since the token of the user cannot come along
+// with a redirect
+func (a *API) linkOIDC(w http.ResponseWriter, r *http.Request) error {
+	payload := r.Context().Value(AuthPayload).(*service.Payload)
+	start, err := a.auth.LinkOIDC(r.Context(), payload.UserID)
+	if err != nil {
+		return err
+	}
+
+	setOIDCState(w, r, start)
+	return writeJSON(r.Context(), w, http.StatusOK, start)
+}
+
+func setOIDCState(w http.ResponseWriter, r *http.Request, start types.OIDCStart) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    start.State,
+		Path:     "/v1/auth/oidc",
+		Expires:  start.ExpiresAt,
+		Secure:   r.TLS != nil,
+		HttpOnly: true,
+		// sent along when the provider redirects back, a top level navigation from another site
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Finish OIDC handler, the identity provider redirects the browser here
+func (a *API) finishOIDC(w http.ResponseWriter, r *http.Request) error {
+	query := r.URL.Query()
+	if query.Get("error") != "" {
+		return types.ErrOIDCLoginFailed
+	}
+
+	req := types.OIDCCallbackRequest{
+		Code:      query.Get("code"),
+		State:     query.Get("state"),
+		IP:        a.clientIP(r),
+		UserAgent: r.UserAgent(),
+	}
+	err := a.validator.Struct(req)
+	if err != nil {
+		return types.NewErrValidation(err)
+	}
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(req.State)) != 1 {
+		return types.ErrInvalidOIDCState
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Path:     "/v1/auth/oidc",
+		Expires:  time.Unix(0, 0),
+		MaxAge:   -1,
+		Secure:   r.TLS != nil,
+		HttpOnly: true,
+	})
+
+	resp, err := a.auth.FinishOIDC(r.Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(r.Context(), w, http.StatusOK, resp)
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"alert-service/internal/cache"
+	"alert-service/internal/logger"
+	"alert-service/internal/service"
+	"alert-service/internal/types"
+)
+
+// RateLimitConfig sets the requests a client may make per route group as "<requests>/<window>", for
+// example "10/1m". Every group is counted per client ip and, once authenticated, per user. A limit of
+// 0 turns a group off.
+type RateLimitConfig struct {
+	// signup and login, bcrypt makes every attempt expensive
+	Auth string `env:"RATE_LIMIT_AUTH" default:"10/1m"`
+	// reads of alerts, markets and health
+	Read string `env:"RATE_LIMIT_READ" default:"300/1m"`
+	// alert writes, batches and imports
+	Write string `env:"RATE_LIMIT_WRITE" default:"60/1m"`
+	// new stream connections
+	Stream string `env:"RATE_LIMIT_STREAM" default:"10/1m"`
+	// take the client ip from the last X-Forwarded-For hop, only behind a proxy that sets it
+	TrustProxy bool `env:"RATE_LIMIT_TRUST_PROXY" default:"false"`
+
+	auth, read, write, stream rate
+}
+
+// rate is a token bucket of limit tokens refilled at limit per window
+type rate struct {
+	group  string
+	limit  int
+	window time.Duration
+}
+
+func (c *RateLimitConfig) Validate() error {
+	var err error
+	for _, r := range []struct {
+		env   string
+		group string
+		raw   string
+		rate  *rate
+	}{
+		{"RATE_LIMIT_AUTH", "auth", c.Auth, &c.auth},
+		{"RATE_LIMIT_READ", "read", c.Read, &c.read},
+		{"RATE_LIMIT_WRITE", "write", c.Write, &c.write},
+		{"RATE_LIMIT_STREAM", "stream", c.Stream, &c.stream},
+	} {
+		*r.rate, err = parseRate(r.group, r.raw)
+		if err != nil {
+			return fmt.Errorf("%s: %w", r.env, err)
+		}
+	}
+	return nil
+}
+
+func parseRate(group string, s string) (rate, error) {
+	rawLimit, rawWindow, ok := strings.Cut(s, "/")
+	if !ok {
+		return rate{}, fmt.Errorf("%q is not <requests>/<window>", s)
+	}
+
+	limit, err := strconv.Atoi(rawLimit)
+	if err != nil || limit < 0 {
+		return rate{}, fmt.Errorf("%q is not a number of requests", rawLimit)
+	}
+	window, err := time.ParseDuration(rawWindow)
+	if err != nil || window <= 0 {
+		return rate{}, fmt.Errorf("%q is not a positive duration", rawWindow)
+	}
+
+	return rate{group: group, limit: limit, window: window}, nil
+}
+
+// rateLimit counts the request against the bucket of the client ip before next authenticates it, so
+// requests with bad credentials use up the limit too. Routes with a login count the request per user
+// again with userLimit. Requests are let through when redis cannot be reached.
+func (a *API) rateLimit(r rate, next Handler) Handler {
+	return a.limit(r, func(req *http.Request) string {
+		return r.group + ":ip:" + a.clientIP(req)
+	}, next)
+}
+
+// userLimit counts the request against the bucket of the authenticated user, so it goes after the
+// auth middlewares
+func (a *API) userLimit(r rate, next Handler) Handler {
+	return a.limit(r, func(req *http.Request) string {
+		payload := req.Context().Value(AuthPayload).(*service.Payload)
+		return r.group + ":user:" + strconv.FormatInt(payload.UserID, 10)
+	}, next)
+}
+
+func (a *API) limit(r rate, key func(req *http.Request) string, next Handler) Handler {
+	return func(w http.ResponseWriter, req *http.Request) error {
+		if r.limit == 0 {
+			return next(w, req)
+		}
+
+		limit, err := a.cache.TakeToken(req.Context(), []string{key(req)}, r.limit, r.window)
+		if err != nil {
+			logger.Error().Str("err", err.Error()).Str("msg", "rate limit").Send()
+			return next(w, req)
+		}
+
+		setLimitHeaders(w.Header(), r, limit)
+		if !limit.Allowed {
+			return types.ErrRateLimited
+		}
+		return next(w, req)
+	}
+}
+
+// setLimitHeaders describes the emptiest bucket the request was counted against, the ip bucket is
+// counted first and the user bucket replaces it when it has less left or refused the request
+func setLimitHeaders(h http.Header, r rate, limit cache.RateLimit) {
+	prev, err := strconv.Atoi(h.Get("RateLimit-Remaining"))
+	if err == nil && prev <= limit.Remaining && limit.Allowed {
+		return
+	}
+
+	h.Set("RateLimit-Limit", strconv.Itoa(r.limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(limit.Remaining))
+	h.Set("RateLimit-Reset", seconds(limit.Reset))
+	if !limit.Allowed {
+		h.Set("Retry-After", seconds(limit.RetryAfter))
+	}
+}
+
+// clientIP is the peer address, or the address the trusted proxy saw when there is one
+func (a *API) clientIP(r *http.Request) string {
+	if a.limits.TrustProxy {
+		hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+		if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+			return ip
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// headers carry whole seconds, rounded up so clients never retry early
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
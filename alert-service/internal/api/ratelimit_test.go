@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"alert-service/internal/cache"
+	"alert-service/internal/service"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memBuckets is a token bucket per key that never refills
+type memBuckets struct {
+	cache.Cacher
+	tokens map[string]int
+}
+
+func (m *memBuckets) TakeToken(_ context.Context, keys []string, limit int, window time.Duration) (cache.RateLimit, error) {
+	key := keys[0]
+	if _, ok := m.tokens[key]; !ok {
+		m.tokens[key] = limit
+	}
+	if m.tokens[key] == 0 {
+		return cache.RateLimit{Reset: window, RetryAfter: window / time.Duration(limit)}, nil
+	}
+	m.tokens[key]--
+	return cache.RateLimit{Allowed: true, Remaining: m.tokens[key], Reset: window}, nil
+}
+
+func TestParseRate(t *testing.T) {
+	r, err := parseRate("read", "300/1m")
+	assert.NoError(t, err)
+	assert.Equal(t, rate{group: "read", limit: 300, window: time.Minute}, r)
+
+	r, err = parseRate("auth", "0/1s")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, r.limit)
+
+	for _, s := range []string{"", "10", "-1/1m", "x/1m", "10/0s", "10/-1s", "10/minute"} {
+		_, err := parseRate("read", s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	buckets := &memBuckets{tokens: make(map[string]int)}
+	a := &API{cache: buckets}
+	r := rate{group: "read", limit: 2, window: time.Minute}
+
+	// credentials are checked after the ip is counted, so bad ones are limited like any request
+	h := a.handle(a.rateLimit(r, a.tokenMiddleware(service.ScopeAlertsRead, a.userLimit(r, func(w http.ResponseWriter, req *http.Request) error {
+		return nil
+	}))))
+	codes := make([]int, 3)
+	for i := range codes {
+		req := httptest.NewRequest(http.MethodGet, "/v1/alerts", nil)
+		req.Header.Set("Authorization", "Basic secret")
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		codes[i] = rec.Code
+
+		if i == 2 {
+			assert.Equal(t, "2", rec.Header().Get("RateLimit-Limit"))
+			assert.Equal(t, "0", rec.Header().Get("RateLimit-Remaining"))
+			assert.Equal(t, "60", rec.Header().Get("RateLimit-Reset"))
+			assert.Equal(t, "30", rec.Header().Get("Retry-After"))
+		}
+	}
+	assert.Equal(t, []int{http.StatusBadRequest, http.StatusBadRequest, http.StatusTooManyRequests}, codes)
+	assert.Equal(t, 0, buckets.tokens["read:ip:192.0.2.1"])
+
+	// the user bucket reports itself once it has less left than the ip bucket
+	header := http.Header{}
+	setLimitHeaders(header, rate{limit: 10}, cache.RateLimit{Allowed: true, Remaining: 5, Reset: time.Second})
+	setLimitHeaders(header, rate{limit: 3}, cache.RateLimit{Allowed: true, Remaining: 7, Reset: time.Second})
+	assert.Equal(t, "10", header.Get("RateLimit-Limit"))
+	assert.Equal(t, "5", header.Get("RateLimit-Remaining"))
+	setLimitHeaders(header, rate{limit: 3}, cache.RateLimit{Allowed: true, Remaining: 2, Reset: 1500 * time.Millisecond})
+	assert.Equal(t, "3", header.Get("RateLimit-Limit"))
+	assert.Equal(t, "2", header.Get("RateLimit-Remaining"))
+	assert.Equal(t, "2", header.Get("RateLimit-Reset"))
+	assert.Empty(t, header.Get("Retry-After"))
+}
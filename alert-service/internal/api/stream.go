@@ -0,0 +1,223 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"alert-service/internal/cache"
+	"alert-service/internal/logger"
+	"alert-service/internal/service"
+	"alert-service/internal/types"
+
+	"nhooyr.io/websocket"
+)
+
+const (
+	// events queued per client, a client that falls this far behind is disconnected
+	streamBuffer = 64
+
+	streamWriteTimeout = 10 * time.Second
+	streamPingInterval = 30 * time.Second
+)
+
+// streamConn is one side of the push transport, websocket or server sent events
+type streamConn interface {
+	Write(ctx context.Context, event []byte) error
+	Ping(ctx context.Context) error
+	Close(reason string) error
+}
+
+// Stream handler, pushes ticks of the requested pairs and the caller's alert transitions
+func (a *API) stream(w http.ResponseWriter, r *http.Request) error {
+	payload, ok := r.Context().Value(AuthPayload).(*service.Payload)
+	if !ok {
+		return types.ErrNotAuthorized
+	}
+
+	usage, err := a.alert.Usage(r.Context(), payload.UserID)
+	if err != nil {
+		return err
+	}
+
+	// ticks are public, alert transitions only come through when the plan includes the stream
+	var channels []string
+	if usage.Limits.Allows(types.ChannelStream) {
+		channels = append(channels, cache.AlertChannel(payload.UserID))
+	}
+	pairs := types.SupportedCurrencies
+	if q := r.URL.Query().Get("pairs"); q != "" {
+		pairs = nil
+		for _, s := range strings.Split(q, ",") {
+			pair, ok := types.ParsePair(strings.TrimSpace(s))
+			if !ok {
+				return types.ErrUnknownPair
+			}
+			pairs = append(pairs, pair)
+		}
+	}
+	for _, pair := range pairs {
+		channels = append(channels, cache.TickChannel(types.PairName(pair)))
+	}
+
+	sub, err := a.cache.Subscribe(r.Context(), channels...)
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	var conn streamConn
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		ws, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			// Accept has already written the handshake failure
+			logger.Error().Str("err", err.Error()).Str("msg", "websocket handshake").Send()
+			return nil
+		}
+		// clients only listen, reading is just for close frames
+		ctx = ws.CloseRead(ctx)
+		conn = &wsConn{ws: ws}
+	} else {
+		rc := http.NewResponseController(w)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		err := rc.Flush()
+		if err != nil {
+			return err
+		}
+		conn = &sseConn{w: w, rc: rc}
+	}
+
+	logger.Info().
+		Int64("userID", payload.UserID).
+		Strs("channels", channels).
+		Str("msg", "stream connected").
+		Send()
+
+	reason := a.pump(ctx, sub, conn)
+	logger.Info().
+		Int64("userID", payload.UserID).
+		Str("reason", reason).
+		Str("msg", "stream disconnected").
+		Send()
+
+	conn.Close(reason)
+	return nil
+}
+
+// pump forwards subscription messages to the client until either side goes away and returns why it stopped
+func (a *API) pump(ctx context.Context, sub cache.Subscription, conn streamConn) string {
+	queue := make(chan []byte, streamBuffer)
+	slow := make(chan struct{})
+
+	go func() {
+		defer close(queue)
+		for payload := range sub.Messages() {
+			select {
+			case queue <- []byte(payload):
+			case <-ctx.Done():
+				return
+			default:
+				// never block the subscription on one client
+				close(slow)
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(streamPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return "client closed"
+
+		case <-slow:
+			return "slow consumer"
+
+		case event, ok := <-queue:
+			if !ok {
+				return "subscription closed"
+			}
+			wctx, cancel := context.WithTimeout(ctx, streamWriteTimeout)
+			err := conn.Write(wctx, event)
+			cancel()
+			if err != nil {
+				return "write failed"
+			}
+
+		case <-ping.C:
+			wctx, cancel := context.WithTimeout(ctx, streamWriteTimeout)
+			err := conn.Ping(wctx)
+			cancel()
+			if err != nil {
+				return "ping failed"
+			}
+		}
+	}
+}
+
+type wsConn struct {
+	ws *websocket.Conn
+}
+
+func (c *wsConn) Write(ctx context.Context, event []byte) error {
+	return c.ws.Write(ctx, websocket.MessageText, event)
+}
+
+func (c *wsConn) Ping(ctx context.Context) error {
+	return c.ws.Ping(ctx)
+}
+
+func (c *wsConn) Close(reason string) error {
+	status := websocket.StatusNormalClosure
+	if reason == "slow consumer" {
+		status = websocket.StatusPolicyViolation
+	}
+	return c.ws.Close(status, reason)
+}
+
+type sseConn struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+func (c *sseConn) Write(ctx context.Context, event []byte) error {
+	return c.send(ctx, "data: %s\n\n", event)
+}
+
+// Ping sends a comment line, it keeps proxies from timing out idle connections
+func (c *sseConn) Ping(ctx context.Context) error {
+	return c.send(ctx, ": ping\n\n")
+}
+
+func (c *sseConn) Close(reason string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), streamWriteTimeout)
+	defer cancel()
+
+	return c.send(ctx, "event: close\ndata: %s\n\n", reason)
+}
+
+// send writes with the context deadline so a stalled client cannot block the handler forever
+func (c *sseConn) send(ctx context.Context, format string, args ...any) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		err := c.rc.SetWriteDeadline(deadline)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintf(c.w, format, args...)
+	if err != nil {
+		return err
+	}
+	return c.rc.Flush()
+}
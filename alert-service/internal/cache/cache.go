@@ -0,0 +1,518 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"alert-service/internal/types"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type Cacher interface {
+	// price alerts are kept in one sorted set per pair, price source and direction
+	AddAlert(ctx context.Context, alertID int64, crypto string, source string, price float64, direction bool) error
+	GetTargets(ctx context.Context, crypto types.Currency, source string, direction bool, min, max float64) ([]string, error)
+
+	// expression alerts live in a single hash of alert id to expression and price source
+	AddExpression(ctx context.Context, alertID int64, expression string, source string) error
+	GetExpressions(ctx context.Context) (map[int64]ExpressionAlert, error)
+	// RemoveExpression reports whether this call removed the alert, so only one caller acts on it
+	RemoveExpression(ctx context.Context, alertID int64) (bool, error)
+
+	// WriteAlerts applies the index changes of many alerts in one pipelined round trip
+	WriteAlerts(ctx context.Context, writes []AlertWrite) error
+	// RebuildAlerts replaces the whole index with writes in one transaction, for an index that was lost
+	// or drifted from postgres
+	RebuildAlerts(ctx context.Context, writes []AlertWrite) error
+
+	// tickers are published by the watcher and read by the api
+	SetTickers(ctx context.Context, tickers []types.Ticker) error
+	GetTickers(ctx context.Context) ([]types.Ticker, error)
+	GetTicker(ctx context.Context, pair string) (types.Ticker, error)
+
+	// every watcher instance publishes its own health, reports older than HealthTTL are dropped on read
+	SetHealth(ctx context.Context, instance string, health types.WatcherHealth) error
+	GetHealth(ctx context.Context) (map[string]types.WatcherHealth, error)
+
+	// pair leases shard the watcher across instances, a lease only moves once its holder stops renewing it
+	AcquireLease(ctx context.Context, name string, owner string, ttl time.Duration) (bool, error)
+	RenewLease(ctx context.Context, name string, owner string, ttl time.Duration) (bool, error)
+	ReleaseLease(ctx context.Context, name string, owner string) error
+	LeaseOwners(ctx context.Context, names []string) (map[string]string, error)
+
+	// Heartbeat registers a live watcher instance and returns how many are live
+	Heartbeat(ctx context.Context, instance string, ttl time.Duration) (int, error)
+	RemoveInstance(ctx context.Context, instance string) error
+
+	// pub/sub fan-out for live streams, any api replica can serve any user
+	Publish(ctx context.Context, channel string, v any) error
+	Subscribe(ctx context.Context, channels ...string) (Subscription, error)
+
+	// TakeToken counts a request against the token buckets of keys, each holding limit tokens and
+	// refilled at limit per window, it is refused when one of them is empty
+	TakeToken(ctx context.Context, keys []string, limit int, window time.Duration) (RateLimit, error)
+
+	// counters of failures in a window, a counter is gone ttl after it was first incremented.
+	// IncrCounter returns the new count and how long until it expires, DecrCounter takes a count back.
+	IncrCounter(ctx context.Context, key string, ttl time.Duration) (int, time.Duration, error)
+	DecrCounter(ctx context.Context, key string) error
+
+	// values read at most once, like the state of a login at an identity provider
+	PutOnce(ctx context.Context, key string, v any, ttl time.Duration) error
+	TakeOnce(ctx context.Context, key string, v any) (bool, error)
+
+	// Ping checks that redis is reachable, for readiness probes
+	Ping(ctx context.Context) error
+}
+
+// ExpressionAlert is what the watcher needs to evaluate an expression alert
+type ExpressionAlert struct {
+	Expression string `json:"expression"`
+	Source     string `json:"source"`
+}
+
+// AlertWrite adds an alert to the index the watcher reads or removes it from there, an alert with
+// an expression goes to the expressions hash and any other to the sorted set of its pair
+type AlertWrite struct {
+	Remove     bool
+	AlertID    int64
+	Crypto     string
+	Source     string
+	Price      float64
+	Direction  bool
+	Expression string
+}
+
+// Subscription delivers pub/sub payloads until it is closed
+type Subscription interface {
+	Messages() <-chan string
+	Close() error
+}
+
+const (
+	expressionsKey = "alerts:expressions"
+	tickersKey     = "market:tickers"
+	healthKey      = "watcher:health"
+	instancesKey   = "watcher:instances"
+	leaseKeyPrefix = "watcher:lease:"
+
+	HealthTTL = 5 * types.HealthInterval
+)
+
+type Redis struct {
+	client *redis.Client
+}
+
+func NewRedis(addr string) (Cacher, error) {
+	opt, err := redis.ParseURL(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	client := redis.NewClient(opt)
+	return &Redis{
+		client: client,
+	}, nil
+}
+
+func (r *Redis) AddAlert(ctx context.Context, alertID int64, crypto string, source string, price float64, direction bool) error {
+	key := formKey(crypto, source, direction)
+	err := r.client.ZAdd(ctx, key, redis.Z{
+		Score:  price,
+		Member: fmt.Sprint(alertID),
+	}).Err()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// takeTargets reads and removes the targets in one step, an alert added in between would be removed
+// without being read otherwise. They are removed in chunks since lua only unpacks so many values.
+var takeTargets = redis.NewScript(`
+local targets = redis.call("ZRANGEBYSCORE", KEYS[1], ARGV[1], ARGV[2])
+for i = 1, #targets, 1000 do
+  redis.call("ZREM", KEYS[1], unpack(targets, i, math.min(i + 999, #targets)))
+end
+return targets`)
+
+// GetTargets takes the alerts of a direction whose target lies within [min, max] out of the index
+func (r *Redis) GetTargets(ctx context.Context, crypto types.Currency, source string, direction bool, min, max float64) ([]string, error) {
+	key := formKey(string(crypto), source, direction)
+	return takeTargets.Run(ctx, r.client, []string{key}, score(min), score(max)).StringSlice()
+}
+
+// score formats a bound of a sorted set range
+func score(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+inf"
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func (r *Redis) AddExpression(ctx context.Context, alertID int64, expression string, source string) error {
+	b, err := json.Marshal(ExpressionAlert{Expression: expression, Source: source})
+	if err != nil {
+		return err
+	}
+
+	return r.client.HSet(ctx, expressionsKey, fmt.Sprint(alertID), b).Err()
+}
+
+func (r *Redis) GetExpressions(ctx context.Context) (map[int64]ExpressionAlert, error) {
+	res, err := r.client.HGetAll(ctx, expressionsKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	expressions := make(map[int64]ExpressionAlert, len(res))
+	for field, val := range res {
+		id, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		// alerts stored before sources existed hold the bare expression
+		alert := ExpressionAlert{Expression: val, Source: types.SourceConsensus}
+		if strings.HasPrefix(val, "{") {
+			err := json.Unmarshal([]byte(val), &alert)
+			if err != nil {
+				return nil, err
+			}
+		}
+		expressions[id] = alert
+	}
+
+	return expressions, nil
+}
+
+func (r *Redis) RemoveExpression(ctx context.Context, alertID int64) (bool, error) {
+	n, err := r.client.HDel(ctx, expressionsKey, fmt.Sprint(alertID)).Result()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+func (r *Redis) WriteAlerts(ctx context.Context, writes []AlertWrite) error {
+	if len(writes) == 0 {
+		return nil
+	}
+
+	pipe := r.client.Pipeline()
+	err := queueWrites(ctx, pipe, writes)
+	if err != nil {
+		return err
+	}
+
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (r *Redis) RebuildAlerts(ctx context.Context, writes []AlertWrite) error {
+	// every key an alert can be indexed under, sorted sets of pairs nobody watches are empty anyway
+	keys := []string{expressionsKey}
+	sources := append([]string{types.SourceConsensus}, types.SupportedSources...)
+	for _, curr := range types.SupportedCurrencies {
+		for _, source := range sources {
+			keys = append(keys, formKey(string(curr), source, true), formKey(string(curr), source, false))
+		}
+	}
+
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, keys...)
+		return queueWrites(ctx, pipe, writes)
+	})
+	return err
+}
+
+func queueWrites(ctx context.Context, pipe redis.Pipeliner, writes []AlertWrite) error {
+	for _, w := range writes {
+		member := fmt.Sprint(w.AlertID)
+		switch {
+		case w.Expression != "" && w.Remove:
+			pipe.HDel(ctx, expressionsKey, member)
+
+		case w.Expression != "":
+			b, err := json.Marshal(ExpressionAlert{Expression: w.Expression, Source: w.Source})
+			if err != nil {
+				return err
+			}
+			pipe.HSet(ctx, expressionsKey, member, b)
+
+		case w.Remove:
+			pipe.ZRem(ctx, formKey(w.Crypto, w.Source, w.Direction), member)
+
+		default:
+			pipe.ZAdd(ctx, formKey(w.Crypto, w.Source, w.Direction), redis.Z{
+				Score:  w.Price,
+				Member: member,
+			})
+		}
+	}
+	return nil
+}
+
+func (r *Redis) SetTickers(ctx context.Context, tickers []types.Ticker) error {
+	if len(tickers) == 0 {
+		return nil
+	}
+
+	values := make([]interface{}, 0, 2*len(tickers))
+	for _, t := range tickers {
+		b, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+		values = append(values, t.Pair, b)
+	}
+
+	return r.client.HSet(ctx, tickersKey, values...).Err()
+}
+
+func (r *Redis) GetTickers(ctx context.Context) ([]types.Ticker, error) {
+	res, err := r.client.HGetAll(ctx, tickersKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	tickers := make([]types.Ticker, 0, len(res))
+	for _, val := range res {
+		var t types.Ticker
+		err := json.Unmarshal([]byte(val), &t)
+		if err != nil {
+			return nil, err
+		}
+		tickers = append(tickers, t)
+	}
+	sort.Slice(tickers, func(i, j int) bool { return tickers[i].Pair < tickers[j].Pair })
+
+	return tickers, nil
+}
+
+func (r *Redis) GetTicker(ctx context.Context, pair string) (types.Ticker, error) {
+	val, err := r.client.HGet(ctx, tickersKey, pair).Result()
+	if errors.Is(err, redis.Nil) {
+		return types.Ticker{}, types.ErrTickerNotFound
+	}
+	if err != nil {
+		return types.Ticker{}, err
+	}
+
+	var t types.Ticker
+	err = json.Unmarshal([]byte(val), &t)
+	return t, err
+}
+
+func (r *Redis) SetHealth(ctx context.Context, instance string, health types.WatcherHealth) error {
+	b, err := json.Marshal(health)
+	if err != nil {
+		return err
+	}
+
+	return r.client.HSet(ctx, healthKey, instance, b).Err()
+}
+
+func (r *Redis) GetHealth(ctx context.Context) (map[string]types.WatcherHealth, error) {
+	res, err := r.client.HGetAll(ctx, healthKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	reports := make(map[string]types.WatcherHealth, len(res))
+	var gone []string
+	for instance, val := range res {
+		var health types.WatcherHealth
+		err := json.Unmarshal([]byte(val), &health)
+		if err != nil {
+			return nil, err
+		}
+
+		if time.Since(health.CheckedAt) > HealthTTL {
+			gone = append(gone, instance)
+			continue
+		}
+		reports[instance] = health
+	}
+
+	// instances that died never clean up after themselves
+	if len(gone) > 0 {
+		err := r.client.HDel(ctx, healthKey, gone...).Err()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return reports, nil
+}
+
+// scripts only touch a lease while the caller still holds it
+var (
+	renewLease = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+  return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+	releaseLease = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+  return redis.call("DEL", KEYS[1])
+end
+return 0`)
+)
+
+func (r *Redis) AcquireLease(ctx context.Context, name string, owner string, ttl time.Duration) (bool, error) {
+	return r.client.SetNX(ctx, leaseKeyPrefix+name, owner, ttl).Result()
+}
+
+func (r *Redis) RenewLease(ctx context.Context, name string, owner string, ttl time.Duration) (bool, error) {
+	n, err := renewLease.Run(ctx, r.client, []string{leaseKeyPrefix + name}, owner, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+func (r *Redis) ReleaseLease(ctx context.Context, name string, owner string) error {
+	return releaseLease.Run(ctx, r.client, []string{leaseKeyPrefix + name}, owner).Err()
+}
+
+func (r *Redis) LeaseOwners(ctx context.Context, names []string) (map[string]string, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, len(names))
+	for i, name := range names {
+		keys[i] = leaseKeyPrefix + name
+	}
+	res, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	owners := make(map[string]string, len(names))
+	for i, val := range res {
+		if owner, ok := val.(string); ok {
+			owners[names[i]] = owner
+		}
+	}
+
+	return owners, nil
+}
+
+// instances are kept in a sorted set scored by when their heartbeat runs out
+func (r *Redis) Heartbeat(ctx context.Context, instance string, ttl time.Duration) (int, error) {
+	now := time.Now()
+
+	var live *redis.IntCmd
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, instancesKey, redis.Z{
+			Score:  float64(now.Add(ttl).UnixMilli()),
+			Member: instance,
+		})
+		pipe.ZRemRangeByScore(ctx, instancesKey, "-inf", fmt.Sprint(now.UnixMilli()))
+		live = pipe.ZCard(ctx, instancesKey)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(live.Val()), nil
+}
+
+func (r *Redis) RemoveInstance(ctx context.Context, instance string) error {
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, instancesKey, instance)
+		pipe.HDel(ctx, healthKey, instance)
+		return nil
+	})
+	return err
+}
+
+func (r *Redis) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
+func (r *Redis) Publish(ctx context.Context, channel string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return r.client.Publish(ctx, channel, b).Err()
+}
+
+func (r *Redis) Subscribe(ctx context.Context, channels ...string) (Subscription, error) {
+	pubsub := r.client.Subscribe(ctx, channels...)
+
+	// waits for the subscription to be confirmed so no message published afterwards is missed
+	_, err := pubsub.Receive(ctx)
+	if err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	sub := &redisSubscription{
+		pubsub:   pubsub,
+		messages: make(chan string),
+		done:     make(chan struct{}),
+	}
+	go sub.forward()
+
+	return sub, nil
+}
+
+type redisSubscription struct {
+	pubsub   *redis.PubSub
+	messages chan string
+	done     chan struct{}
+	once     sync.Once
+}
+
+func (s *redisSubscription) forward() {
+	defer close(s.messages)
+	for msg := range s.pubsub.Channel() {
+		select {
+		case s.messages <- msg.Payload:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *redisSubscription) Messages() <-chan string {
+	return s.messages
+}
+
+func (s *redisSubscription) Close() error {
+	s.once.Do(func() { close(s.done) })
+	return s.pubsub.Close()
+}
+
+// helper function
+// consensus alerts keep the keys from before sources existed, single exchange alerts get their own
+func formKey(crypto string, source string, direction bool) string {
+	if source != types.SourceConsensus {
+		crypto += ":" + source
+	}
+
+	if direction {
+		return crypto + ":" + "gt"
+	}
+
+	return crypto + ":" + "lt"
+}
@@ -0,0 +1,57 @@
+package cache
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"alert-service/internal/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetTargets(t *testing.T) {
+	_, r := newMiniRedis(t)
+	ctx := context.Background()
+
+	require.NoError(t, r.AddAlert(ctx, 1, string(types.BTC), types.SourceConsensus, 100, true))
+	require.NoError(t, r.AddAlert(ctx, 2, string(types.BTC), types.SourceConsensus, 200, true))
+	require.NoError(t, r.AddAlert(ctx, 3, string(types.BTC), types.SourceConsensus, 100, false))
+	require.NoError(t, r.AddAlert(ctx, 4, string(types.BTC), types.SourceBinance, 100, true))
+
+	// a target is taken once, at its price
+	min, max := types.TargetRange(true, 150)
+	targets, err := r.GetTargets(ctx, types.BTC, types.SourceConsensus, true, min, max)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1"}, targets)
+	targets, err = r.GetTargets(ctx, types.BTC, types.SourceConsensus, true, min, max)
+	require.NoError(t, err)
+	assert.Empty(t, targets)
+
+	min, max = types.TargetRange(false, 100)
+	assert.True(t, math.IsInf(max, 1))
+	targets, err = r.GetTargets(ctx, types.BTC, types.SourceConsensus, false, min, max)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3"}, targets)
+
+	// more targets than lua unpacks at once are all taken
+	for id := int64(10); id < 2510; id++ {
+		require.NoError(t, r.AddAlert(ctx, id, string(types.ETH), types.SourceConsensus, float64(id), true))
+	}
+	targets, err = r.GetTargets(ctx, types.ETH, types.SourceConsensus, true, 0, 5000)
+	require.NoError(t, err)
+	assert.Len(t, targets, 2500)
+	assert.Equal(t, "2509", targets[len(targets)-1])
+	left, err := r.client.ZCard(ctx, formKey(string(types.ETH), types.SourceConsensus, true)).Result()
+	require.NoError(t, err)
+	assert.Zero(t, left)
+
+	// other sources and pairs keep theirs
+	targets, err = r.GetTargets(ctx, types.BTC, types.SourceBinance, true, 0, 100)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"4"}, targets)
+	left, err = r.client.ZCard(ctx, formKey(string(types.BTC), types.SourceConsensus, true)).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), left)
+}
@@ -0,0 +1,34 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const onceKeyPrefix = "once:"
+
+// PutOnce keeps v as json under key for ttl, until TakeOnce reads it
+func (r *Redis) PutOnce(ctx context.Context, key string, v any, ttl time.Duration) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(ctx, onceKeyPrefix+key, b, ttl).Err()
+}
+
+// TakeOnce reads the value under key into v and deletes it in the same step, so two requests never
+// both get it. It reports false when there is none or it expired.
+func (r *Redis) TakeOnce(ctx context.Context, key string, v any) (bool, error) {
+	b, err := r.client.GetDel(ctx, onceKeyPrefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(b, v)
+}
@@ -0,0 +1,114 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	rateLimitKeyPrefix = "ratelimit:"
+	counterKeyPrefix   = "counter:"
+)
+
+// RateLimit is the state of the emptiest bucket a request was counted against
+type RateLimit struct {
+	Allowed   bool
+	Remaining int
+	// until the bucket is full again
+	Reset time.Duration
+	// until the next request would be allowed, only set when this one was not
+	RetryAfter time.Duration
+}
+
+// takeToken refills every bucket for the time since it was last used and takes a token from each, or
+// from none when one of them is empty. Time comes from redis so api replicas need no synced clocks.
+var takeToken = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local rate = capacity / window
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local tokens = {}
+local lowest = capacity
+for i, key in ipairs(KEYS) do
+  local b = redis.call("HMGET", key, "tokens", "ts")
+  local n = tonumber(b[1]) or capacity
+  local ts = tonumber(b[2]) or now
+  n = math.min(capacity, n + math.max(0, now - ts) * rate)
+  tokens[i] = n
+  if n < lowest then
+    lowest = n
+  end
+end
+
+local allowed = 0
+if lowest >= 1 then
+  allowed = 1
+  lowest = lowest - 1
+end
+
+for i, key in ipairs(KEYS) do
+  redis.call("HSET", key, "tokens", tostring(tokens[i] - allowed), "ts", now)
+  redis.call("PEXPIRE", key, window)
+end
+
+local retry = 0
+if allowed == 0 then
+  retry = math.ceil((1 - lowest) / rate)
+end
+return {allowed, math.floor(lowest), math.ceil((capacity - lowest) / rate), retry}`)
+
+// TakeToken counts a request against the token buckets of keys, each holding limit tokens and
+// refilled at limit per window
+func (r *Redis) TakeToken(ctx context.Context, keys []string, limit int, window time.Duration) (RateLimit, error) {
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = rateLimitKeyPrefix + key
+	}
+
+	res, err := takeToken.Run(ctx, r.client, prefixed, limit, window.Milliseconds()).Int64Slice()
+	if err != nil {
+		return RateLimit{}, err
+	}
+
+	return RateLimit{
+		Allowed:    res[0] == 1,
+		Remaining:  int(res[1]),
+		Reset:      time.Duration(res[2]) * time.Millisecond,
+		RetryAfter: time.Duration(res[3]) * time.Millisecond,
+	}, nil
+}
+
+// incrCounter counts and starts the window with the first count in one step, so a counter cannot be
+// left without an expiry. Later counts do not extend the window, nor do counts after one taken back.
+var incrCounter = redis.NewScript(`
+local n = redis.call("INCR", KEYS[1])
+local ttl = redis.call("PTTL", KEYS[1])
+if ttl < 0 then
+  redis.call("PEXPIRE", KEYS[1], ARGV[1])
+  ttl = tonumber(ARGV[1])
+end
+return {n, ttl}`)
+
+func (r *Redis) IncrCounter(ctx context.Context, key string, ttl time.Duration) (int, time.Duration, error) {
+	res, err := incrCounter.Run(ctx, r.client, []string{counterKeyPrefix + key}, ttl.Milliseconds()).Int64Slice()
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(res[0]), time.Duration(res[1]) * time.Millisecond, nil
+}
+
+// decrCounter never takes a counter below zero nor brings back one that expired
+var decrCounter = redis.NewScript(`
+local n = tonumber(redis.call("GET", KEYS[1]))
+if n and n > 0 then
+  redis.call("DECR", KEYS[1])
+end
+return 0`)
+
+func (r *Redis) DecrCounter(ctx context.Context, key string) error {
+	return decrCounter.Run(ctx, r.client, []string{counterKeyPrefix + key}).Err()
+}
@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMiniRedis(t *testing.T) (*miniredis.Miniredis, *Redis) {
+	m := miniredis.RunT(t)
+	c, err := NewRedis("redis://" + m.Addr())
+	require.NoError(t, err)
+	return m, c.(*Redis)
+}
+
+func TestTakeToken(t *testing.T) {
+	m, r := newMiniRedis(t)
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m.SetTime(now)
+
+	// two tokens refilled at two a second
+	for remaining := 1; remaining >= 0; remaining-- {
+		limit, err := r.TakeToken(ctx, []string{"ip"}, 2, time.Second)
+		require.NoError(t, err)
+		assert.True(t, limit.Allowed)
+		assert.Equal(t, remaining, limit.Remaining)
+	}
+
+	limit, err := r.TakeToken(ctx, []string{"ip"}, 2, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, RateLimit{Allowed: false, Remaining: 0, Reset: time.Second, RetryAfter: 500 * time.Millisecond}, limit)
+	assert.Equal(t, time.Second, m.TTL(rateLimitKeyPrefix+"ip"))
+
+	// half the window refills a token
+	m.SetTime(now.Add(500 * time.Millisecond))
+	limit, err = r.TakeToken(ctx, []string{"ip"}, 2, time.Second)
+	require.NoError(t, err)
+	assert.True(t, limit.Allowed)
+	assert.Equal(t, 0, limit.Remaining)
+
+	// an empty bucket refuses the request for every key, the full one keeps its token
+	limit, err = r.TakeToken(ctx, []string{"ip", "user"}, 2, time.Second)
+	require.NoError(t, err)
+	assert.False(t, limit.Allowed)
+	limit, err = r.TakeToken(ctx, []string{"user"}, 2, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, 1, limit.Remaining)
+}
+
+func TestIncrCounter(t *testing.T) {
+	m, r := newMiniRedis(t)
+	ctx := context.Background()
+
+	n, ttl, err := r.IncrCounter(ctx, "login", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, time.Minute, ttl)
+
+	// later counts do not extend the window
+	m.FastForward(20 * time.Second)
+	n, ttl, err = r.IncrCounter(ctx, "login", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 40*time.Second, ttl)
+
+	// a count taken back is not counted again, nor does the counter go below zero
+	for i := 0; i < 3; i++ {
+		require.NoError(t, r.DecrCounter(ctx, "login"))
+	}
+	n, ttl, err = r.IncrCounter(ctx, "login", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 40*time.Second, ttl)
+
+	m.FastForward(40 * time.Second)
+	require.NoError(t, r.DecrCounter(ctx, "login"))
+	assert.False(t, m.Exists(counterKeyPrefix+"login"))
+	n, ttl, err = r.IncrCounter(ctx, "login", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, time.Minute, ttl)
+}
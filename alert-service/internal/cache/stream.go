@@ -0,0 +1,41 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"alert-service/internal/types"
+)
+
+const (
+	tickChannelPrefix  = "stream:ticks:"
+	alertChannelPrefix = "stream:alerts:"
+)
+
+func TickChannel(pair string) string {
+	return tickChannelPrefix + pair
+}
+
+func AlertChannel(userID int64) string {
+	return fmt.Sprint(alertChannelPrefix, userID)
+}
+
+// PublishTick pushes a ticker to every client subscribed to its pair
+func PublishTick(ctx context.Context, c Cacher, t types.Ticker) error {
+	return publishEvent(ctx, c, TickChannel(t.Pair), "tick", t)
+}
+
+// PublishAlertEvent pushes an alert transition to the owner's streams
+func PublishAlertEvent(ctx context.Context, c Cacher, e types.AlertEvent) error {
+	return publishEvent(ctx, c, AlertChannel(e.UserID), "alert", e)
+}
+
+func publishEvent(ctx context.Context, c Cacher, channel string, typ string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return c.Publish(ctx, channel, types.StreamEvent{Type: typ, Data: data})
+}
@@ -0,0 +1,561 @@
+package expression
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"alert-service/internal/types"
+)
+
+// Expression alerts combine several pairs into a single condition, e.g.
+//
+//	btcusdt > 70000 && ethusdt > 4000
+//	solusdt / btcusdt < 0.002
+//
+// grammar (lowest to highest precedence):
+//
+//	or      = and { ("||" | "or") and }
+//	and     = not { ("&&" | "and") not }
+//	not     = ("!" | "not") not | compare
+//	compare = sum [ ("<" | "<=" | ">" | ">=" | "==" | "!=") sum ]
+//	sum     = product { ("+" | "-") product }
+//	product = unary { ("*" | "/") unary }
+//	unary   = "-" unary | primary
+//	primary = number | pair | "true" | "false" | "(" or ")"
+
+var (
+	ErrExprNoPrice      = errors.New("expression references a pair without a price")
+	ErrExprDivideByZero = errors.New("expression divides by zero")
+)
+
+type exprType int
+
+const (
+	numberType exprType = iota
+	boolType
+)
+
+func (t exprType) String() string {
+	if t == boolType {
+		return "bool"
+	}
+	return "number"
+}
+
+type node interface {
+	String() string
+}
+
+type numberLit struct{ value float64 }
+type boolLit struct{ value bool }
+type pairRef struct{ pair types.Currency }
+type unaryOp struct {
+	op string
+	x  node
+}
+type binaryOp struct {
+	op   string
+	l, r node
+}
+
+func (n numberLit) String() string { return strconv.FormatFloat(n.value, 'f', -1, 64) }
+func (n boolLit) String() string   { return strconv.FormatBool(n.value) }
+func (n pairRef) String() string   { return types.PairName(n.pair) }
+func (n unaryOp) String() string   { return n.op + n.x.String() }
+func (n binaryOp) String() string  { return "(" + n.l.String() + " " + n.op + " " + n.r.String() + ")" }
+
+// Expr is a parsed and type checked alert expression
+type Expr struct {
+	root  node
+	pairs []types.Currency
+}
+
+// ParseExpr parses src and checks that it is a boolean condition over supported pairs
+func ParseExpr(src string) (*Expr, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.peek().text, p.peek().pos)
+	}
+
+	typ, err := check(root)
+	if err != nil {
+		return nil, err
+	}
+	if typ != boolType {
+		return nil, fmt.Errorf("expression must be a condition, got %s", typ)
+	}
+
+	seen := make(map[types.Currency]bool)
+	var pairs []types.Currency
+	walk(root, func(n node) {
+		if ref, ok := n.(pairRef); ok && !seen[ref.pair] {
+			seen[ref.pair] = true
+			pairs = append(pairs, ref.pair)
+		}
+	})
+	if len(pairs) == 0 {
+		return nil, errors.New("expression must reference at least one pair")
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i] < pairs[j] })
+
+	return &Expr{root: root, pairs: pairs}, nil
+}
+
+// String returns the canonical, fully parenthesized form of the expression
+func (e *Expr) String() string {
+	return e.root.String()
+}
+
+// Pairs returns the sorted set of pairs the expression depends on
+func (e *Expr) Pairs() []types.Currency {
+	return e.pairs
+}
+
+// Eval evaluates the expression against a snapshot of market prices
+func (e *Expr) Eval(prices map[types.Currency]float64) (bool, error) {
+	return evalBool(e.root, prices)
+}
+
+// Describe renders the prices the expression was evaluated against
+func (e *Expr) Describe(prices map[types.Currency]float64) string {
+	parts := make([]string, 0, len(e.pairs))
+	for _, pair := range e.pairs {
+		parts = append(parts, types.PairName(pair)+"="+strconv.FormatFloat(prices[pair], 'f', -1, 64))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func walk(n node, fn func(node)) {
+	fn(n)
+	switch n := n.(type) {
+	case unaryOp:
+		walk(n.x, fn)
+	case binaryOp:
+		walk(n.l, fn)
+		walk(n.r, fn)
+	}
+}
+
+func check(n node) (exprType, error) {
+	switch n := n.(type) {
+	case numberLit, pairRef:
+		return numberType, nil
+
+	case boolLit:
+		return boolType, nil
+
+	case unaryOp:
+		typ, err := check(n.x)
+		if err != nil {
+			return 0, err
+		}
+		want := numberType
+		if n.op == "!" {
+			want = boolType
+		}
+		if typ != want {
+			return 0, fmt.Errorf("operator %s expects a %s, got %s", n.op, want, typ)
+		}
+		return typ, nil
+
+	case binaryOp:
+		lt, err := check(n.l)
+		if err != nil {
+			return 0, err
+		}
+		rt, err := check(n.r)
+		if err != nil {
+			return 0, err
+		}
+
+		switch n.op {
+		case "&&", "||":
+			if lt != boolType || rt != boolType {
+				return 0, fmt.Errorf("operator %s expects conditions, got %s and %s", n.op, lt, rt)
+			}
+			return boolType, nil
+
+		case "<", "<=", ">", ">=", "==", "!=":
+			if lt != numberType || rt != numberType {
+				return 0, fmt.Errorf("operator %s expects numbers, got %s and %s", n.op, lt, rt)
+			}
+			return boolType, nil
+
+		default:
+			if lt != numberType || rt != numberType {
+				return 0, fmt.Errorf("operator %s expects numbers, got %s and %s", n.op, lt, rt)
+			}
+			return numberType, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown expression node %T", n)
+}
+
+func evalBool(n node, prices map[types.Currency]float64) (bool, error) {
+	switch n := n.(type) {
+	case boolLit:
+		return n.value, nil
+
+	case unaryOp:
+		v, err := evalBool(n.x, prices)
+		return !v, err
+
+	case binaryOp:
+		switch n.op {
+		case "&&", "||":
+			l, err := evalBool(n.l, prices)
+			if err != nil {
+				return false, err
+			}
+			// short circuit so a missing price on the other side does not block the result
+			if n.op == "&&" && !l {
+				return false, nil
+			}
+			if n.op == "||" && l {
+				return true, nil
+			}
+			return evalBool(n.r, prices)
+		}
+
+		l, err := evalNumber(n.l, prices)
+		if err != nil {
+			return false, err
+		}
+		r, err := evalNumber(n.r, prices)
+		if err != nil {
+			return false, err
+		}
+
+		switch n.op {
+		case "<":
+			return l < r, nil
+		case "<=":
+			return l <= r, nil
+		case ">":
+			return l > r, nil
+		case ">=":
+			return l >= r, nil
+		case "==":
+			return l == r, nil
+		case "!=":
+			return l != r, nil
+		}
+	}
+
+	return false, fmt.Errorf("cannot evaluate %s as a condition", n)
+}
+
+func evalNumber(n node, prices map[types.Currency]float64) (float64, error) {
+	switch n := n.(type) {
+	case numberLit:
+		return n.value, nil
+
+	case pairRef:
+		price, ok := prices[n.pair]
+		if !ok || price == 0 {
+			return 0, ErrExprNoPrice
+		}
+		return price, nil
+
+	case unaryOp:
+		v, err := evalNumber(n.x, prices)
+		return -v, err
+
+	case binaryOp:
+		l, err := evalNumber(n.l, prices)
+		if err != nil {
+			return 0, err
+		}
+		r, err := evalNumber(n.r, prices)
+		if err != nil {
+			return 0, err
+		}
+
+		switch n.op {
+		case "+":
+			return l + r, nil
+		case "-":
+			return l - r, nil
+		case "*":
+			return l * r, nil
+		case "/":
+			if r == 0 {
+				return 0, ErrExprDivideByZero
+			}
+			return l / r, nil
+		}
+	}
+
+	return 0, fmt.Errorf("cannot evaluate %s as a number", n)
+}
+
+// lexer
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokIdent
+	tokOp
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func lex(src string) ([]token, error) {
+	var tokens []token
+	runes := []rune(src)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case unicode.IsDigit(r) || r == '.':
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: string(runes[start:i]), pos: start})
+
+		case unicode.IsLetter(r):
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '@' || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: string(runes[start:i]), pos: start})
+
+		case r == '(':
+			tokens = append(tokens, token{kind: tokLParen, text: "(", pos: i})
+			i++
+
+		case r == ')':
+			tokens = append(tokens, token{kind: tokRParen, text: ")", pos: i})
+			i++
+
+		default:
+			op := ""
+			if i+1 < len(runes) {
+				switch two := string(runes[i : i+2]); two {
+				case "&&", "||", "<=", ">=", "==", "!=":
+					op = two
+				}
+			}
+			if op == "" {
+				switch r {
+				case '<', '>', '!', '+', '-', '*', '/':
+					op = string(r)
+				default:
+					return nil, fmt.Errorf("unexpected character %q at position %d", r, i)
+				}
+			}
+			tokens = append(tokens, token{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+
+	return append(tokens, token{kind: tokEOF, pos: len(runes)}), nil
+}
+
+// parser
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it is one of ops, keywords are matched case insensitively
+func (p *parser) accept(ops ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != tokOp && t.kind != tokIdent {
+		return "", false
+	}
+	for _, op := range ops {
+		if strings.EqualFold(t.text, op) {
+			p.next()
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) parseOr() (node, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("||", "or"); !ok {
+			return l, nil
+		}
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = binaryOp{op: "||", l: l, r: r}
+	}
+}
+
+func (p *parser) parseAnd() (node, error) {
+	l, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("&&", "and"); !ok {
+			return l, nil
+		}
+		r, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l = binaryOp{op: "&&", l: l, r: r}
+	}
+}
+
+func (p *parser) parseNot() (node, error) {
+	if _, ok := p.accept("!", "not"); ok {
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return unaryOp{op: "!", x: x}, nil
+	}
+	return p.parseCompare()
+}
+
+func (p *parser) parseCompare() (node, error) {
+	l, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.accept("<=", ">=", "==", "!=", "<", ">")
+	if !ok {
+		return l, nil
+	}
+	r, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	return binaryOp{op: op, l: l, r: r}, nil
+}
+
+func (p *parser) parseSum() (node, error) {
+	l, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("+", "-")
+		if !ok {
+			return l, nil
+		}
+		r, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		l = binaryOp{op: op, l: l, r: r}
+	}
+}
+
+func (p *parser) parseProduct() (node, error) {
+	l, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("*", "/")
+		if !ok {
+			return l, nil
+		}
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l = binaryOp{op: op, l: l, r: r}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if _, ok := p.accept("-"); ok {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return unaryOp{op: "-", x: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		value, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at position %d", t.text, t.pos)
+		}
+		return numberLit{value: value}, nil
+
+	case tokIdent:
+		switch strings.ToLower(t.text) {
+		case "true":
+			return boolLit{value: true}, nil
+		case "false":
+			return boolLit{value: false}, nil
+		}
+		pair, ok := types.ParsePair(t.text)
+		if !ok {
+			return nil, fmt.Errorf("unknown pair %q at position %d", t.text, t.pos)
+		}
+		return pairRef{pair: pair}, nil
+
+	case tokLParen:
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next().kind != tokRParen {
+			return nil, fmt.Errorf("missing closing parenthesis for position %d", t.pos)
+		}
+		return x, nil
+
+	case tokEOF:
+		return nil, errors.New("unexpected end of expression")
+	}
+
+	return nil, fmt.Errorf("unexpected %q at position %d", t.text, t.pos)
+}
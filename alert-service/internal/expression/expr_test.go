@@ -0,0 +1,74 @@
+package expression
+
+import (
+	"testing"
+
+	"alert-service/internal/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseExpr(t *testing.T) {
+	expr, err := ParseExpr("BTCUSDT > 70000 and ethusdt@trade > 4000")
+	assert.NoError(t, err)
+	assert.Equal(t, "((btcusdt > 70000) && (ethusdt > 4000))", expr.String())
+	assert.Equal(t, []types.Currency{types.BTC, types.ETH}, expr.Pairs())
+
+	expr, err = ParseExpr("solusdt / btcusdt < 0.002 || !(btcusdt - 1 >= -5)")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Currency{types.BTC, types.SOL}, expr.Pairs())
+
+	// canonical form parses back to itself
+	again, err := ParseExpr(expr.String())
+	assert.NoError(t, err)
+	assert.Equal(t, expr.String(), again.String())
+
+	for _, src := range []string{
+		"",
+		"btcusdt",                 // not a condition
+		"btcusdt > 1 + (2 > 1)",   // number plus bool
+		"btcusdt > 1 && 2",        // and over a number
+		"dogeusdt > 1",            // unsupported pair
+		"true",                    // no pair referenced
+		"(btcusdt > 1",            // unbalanced
+		"btcusdt > 1 ethusdt > 2", // trailing tokens
+		"btcusdt # 1",             // unknown operator
+	} {
+		_, err := ParseExpr(src)
+		assert.Error(t, err, src)
+	}
+}
+
+func TestEvalExpr(t *testing.T) {
+	expr, err := ParseExpr("btcusdt > 70000 && ethusdt > 4000")
+	assert.NoError(t, err)
+
+	ok, err := expr.Eval(map[types.Currency]float64{types.BTC: 70001, types.ETH: 4001})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = expr.Eval(map[types.Currency]float64{types.BTC: 69999, types.ETH: 4001})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// the left side short circuits before the missing price is read
+	ok, err = expr.Eval(map[types.Currency]float64{types.BTC: 1})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = expr.Eval(map[types.Currency]float64{types.BTC: 70001})
+	assert.ErrorIs(t, err, ErrExprNoPrice)
+
+	ratio, err := ParseExpr("solusdt / btcusdt < 0.002")
+	assert.NoError(t, err)
+
+	ok, err = ratio.Eval(map[types.Currency]float64{types.SOL: 100, types.BTC: 70000})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "btcusdt=70000, solusdt=100", ratio.Describe(map[types.Currency]float64{types.SOL: 100, types.BTC: 70000}))
+
+	zero, err := ParseExpr("btcusdt / (ethusdt - ethusdt) > 1")
+	assert.NoError(t, err)
+	_, err = zero.Eval(map[types.Currency]float64{types.BTC: 1, types.ETH: 2})
+	assert.ErrorIs(t, err, ErrExprDivideByZero)
+}
@@ -0,0 +1,67 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// how long a single dependency may take to answer a readiness probe
+const checkTimeout = 2 * time.Second
+
+// Check reports whether a dependency of a command can be used
+type Check func(ctx context.Context) error
+
+// Checks are the dependencies a command needs before it is ready, by name
+type Checks map[string]Check
+
+type response struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Mount serves /healthz and /readyz. Liveness only says the process serves http, readiness runs
+// every check and answers 503 while any of them fails.
+func Mount(mux chi.Router, checks Checks) {
+	mux.Get("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		write(w, http.StatusOK, response{Status: "ok"})
+	})
+
+	mux.Get("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		status, resp := checks.run(r.Context())
+		write(w, status, resp)
+	})
+}
+
+func (c Checks) run(ctx context.Context) (int, response) {
+	names := make([]string, 0, len(c))
+	for name := range c {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	status, resp := http.StatusOK, response{Status: "ok", Checks: make(map[string]string, len(c))}
+	for _, name := range names {
+		cctx, cancel := context.WithTimeout(ctx, checkTimeout)
+		err := c[name](cctx)
+		cancel()
+
+		if err != nil {
+			status, resp.Status = http.StatusServiceUnavailable, "unavailable"
+			resp.Checks[name] = err.Error()
+			continue
+		}
+		resp.Checks[name] = "ok"
+	}
+	return status, resp
+}
+
+func write(w http.ResponseWriter, status int, resp response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,28 @@
+package logger
+
+import (
+	"os"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Logger is shared by every command, events go to stderr in a human readable form
+var Logger zerolog.Logger = zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339}).
+	Level(zerolog.TraceLevel).
+	With().
+	Timestamp().
+	Caller().
+	Logger()
+
+func Info() *zerolog.Event {
+	return Logger.Info()
+}
+
+func Warn() *zerolog.Event {
+	return Logger.Warn()
+}
+
+func Error() *zerolog.Event {
+	return Logger.Error()
+}
@@ -0,0 +1,332 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	database "alert-service/database/sqlc"
+	"alert-service/internal/cache"
+	"alert-service/internal/logger"
+	"alert-service/internal/types"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// actions of the audit log
+const (
+	auditSearchUsers       = "search_users"
+	auditUserAlerts        = "list_user_alerts"
+	auditUnlockUser        = "unlock_user"
+	auditDisableAlert      = "disable_alert"
+	auditWatcherPairs      = "watcher_pairs"
+	auditRebuildCache      = "rebuild_cache"
+	auditListDeadLetters   = "list_dead_letters"
+	auditReplayDeadLetters = "replay_dead_letters"
+	auditListAuditLog      = "list_audit_log"
+)
+
+// Admin is everything only admins may do. Each method checks the role in postgres again, a token
+// outlives a role taken away, and records the action in the audit log.
+type Admin interface {
+	// SearchUsers finds users by a part of their email, a page at a time
+	SearchUsers(ctx context.Context, req types.SearchUsersRequest) ([]types.AdminUser, error)
+	// UserAlerts lists the alerts of any user but the deleted ones
+	UserAlerts(ctx context.Context, req types.AdminUserAlertsRequest) ([]database.Alert, error)
+	// Unlock lets a locked out user log in again right away
+	Unlock(ctx context.Context, req types.UnlockUserRequest) error
+	// DisableAlert takes an alert of any user off the watcher for good
+	DisableAlert(ctx context.Context, req types.DisableAlertRequest) error
+
+	// WatcherPairs shows per pair which instance watches it, its last price and why it is paused
+	WatcherPairs(ctx context.Context, adminID int64) ([]types.PairState, error)
+	// RebuildCache writes the redis index again from the alerts in postgres
+	RebuildCache(ctx context.Context, adminID int64) (types.RebuildResult, error)
+
+	// messages email-service could not handle, replaying puts them back on their topic
+	DeadLetters(ctx context.Context, req types.ListPageRequest) ([]database.DeadLetter, error)
+	ReplayDeadLetters(ctx context.Context, req types.ReplayDeadLettersRequest) (types.ReplayResult, error)
+
+	// AuditLog lists admin actions newest first
+	AuditLog(ctx context.Context, req types.ListPageRequest) ([]database.AuditLog, error)
+}
+
+type admin struct {
+	db          database.Store
+	cache       cache.Cacher
+	republisher Republisher
+}
+
+// republisher may be nil when there is no kafka, dead letters can then be listed but not replayed
+func NewAdminSvc(db database.Store, cache cache.Cacher, republisher Republisher) Admin {
+	return &admin{
+		db:          db,
+		cache:       cache,
+		republisher: republisher,
+	}
+}
+
+func (a *admin) SearchUsers(ctx context.Context, req types.SearchUsersRequest) ([]types.AdminUser, error) {
+	err := a.authorize(ctx, a.db, req.AdminID, auditSearchUsers, "users", fmt.Sprintf("query %q", req.Query))
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := a.db.SearchUsers(ctx, database.SearchUsersParams{
+		Query:   req.Query,
+		AfterID: req.AfterID,
+		MaxRows: req.Limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := make([]types.AdminUser, len(users))
+	for i, user := range users {
+		resp[i] = types.AdminUser{
+			ID:           user.ID,
+			Email:        user.Email,
+			Role:         user.Role,
+			Plan:         user.Plan,
+			CreatedAt:    user.CreatedAt,
+			FailedLogins: user.FailedLogins,
+			LockedUntil:  user.LockedUntil,
+			TOTPEnabled:  user.TotpEnabled,
+		}
+	}
+	return resp, nil
+}
+
+func (a *admin) UserAlerts(ctx context.Context, req types.AdminUserAlertsRequest) ([]database.Alert, error) {
+	err := a.authorize(ctx, a.db, req.AdminID, auditUserAlerts, userTarget(req.UserID), "")
+	if err != nil {
+		return nil, err
+	}
+
+	alerts, err := a.db.ExportAlerts(ctx, database.ExportAlertsParams{
+		UserID:  req.UserID,
+		AfterID: req.AfterID,
+		MaxRows: req.Limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if alerts == nil {
+		alerts = []database.Alert{}
+	}
+	return alerts, nil
+}
+
+// Unlock clears the account only, failures counted against ips run out with their window
+func (a *admin) Unlock(ctx context.Context, req types.UnlockUserRequest) error {
+	return a.db.WithTx(ctx, func(tx database.Tx) error {
+		err := a.authorize(ctx, tx, req.AdminID, auditUnlockUser, userTarget(req.UserID), "")
+		if err != nil {
+			return err
+		}
+
+		n, err := tx.UnlockUser(ctx, req.UserID)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return types.ErrUserNotFound
+		}
+		return nil
+	})
+}
+
+// DisableAlert works on alerts that may still fire, the owner sees the change in their history and
+// live streams
+func (a *admin) DisableAlert(ctx context.Context, req types.DisableAlertRequest) error {
+	var res database.Alert
+	err := a.db.WithTx(ctx, func(tx database.Tx) error {
+		err := a.authorize(ctx, tx, req.AdminID, auditDisableAlert, "alert:"+strconv.FormatInt(req.AlertID, 10), req.Reason)
+		if err != nil {
+			return err
+		}
+
+		res, err = tx.GetAlertForUpdate(ctx, req.AlertID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return types.ErrAlertNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if res.Status != string(types.Created) && res.Status != string(types.Triggered) {
+			return types.ErrAlertNotActive
+		}
+
+		err = tx.UpdateAlertStatus(ctx, database.UpdateAlertStatusParams{
+			ID:     res.ID,
+			Status: string(types.Disabled),
+		})
+		if err != nil {
+			return err
+		}
+
+		err = recordEvent(ctx, tx, res, types.EventDisabled, "by an admin: "+req.Reason)
+		if err != nil {
+			return err
+		}
+
+		// dropped from redis last, a failure keeps the alert in both stores
+		err = tx.ShareAlertIndex(ctx)
+		if err != nil {
+			return err
+		}
+		return a.cache.WriteAlerts(ctx, []cache.AlertWrite{indexWrite(res, true)})
+	})
+	if err != nil {
+		return err
+	}
+
+	err = cache.PublishAlertEvent(ctx, a.cache, types.AlertEvent{
+		AlertID: res.ID,
+		UserID:  res.UserID,
+		Status:  string(types.Disabled),
+		At:      time.Now(),
+	})
+	if err != nil {
+		logger.Error().Str("err", err.Error()).Int64("alertID", res.ID).Send()
+	}
+	return nil
+}
+
+func (a *admin) WatcherPairs(ctx context.Context, adminID int64) ([]types.PairState, error) {
+	err := a.authorize(ctx, a.db, adminID, auditWatcherPairs, "watcher", "")
+	if err != nil {
+		return nil, err
+	}
+
+	pairs := types.PairNames(types.SupportedCurrencies)
+	owners, err := a.cache.LeaseOwners(ctx, pairs)
+	if err != nil {
+		return nil, err
+	}
+	tickers, err := a.cache.GetTickers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reports, err := a.cache.GetHealth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]types.PairState, len(pairs))
+	index := make(map[string]*types.PairState, len(pairs))
+	for i, pair := range pairs {
+		states[i] = types.PairState{
+			Pair:   pair,
+			Owner:  owners[pair],
+			Stale:  true,
+			Paused: []types.PausedPair{},
+		}
+		index[pair] = &states[i]
+	}
+	for _, t := range tickers {
+		if state, ok := index[t.Pair]; ok {
+			state.Price = t.Price
+			state.UpdatedAt = t.UpdatedAt
+			state.Stale = t.Stale || time.Since(t.UpdatedAt) > types.MaxTickerAge
+			state.Sources = t.Sources
+		}
+	}
+	for _, report := range reports {
+		for _, paused := range report.Paused {
+			if state, ok := index[paused.Pair]; ok {
+				state.Paused = append(state.Paused, paused)
+			}
+		}
+	}
+	for i := range states {
+		types.SortPaused(states[i].Paused)
+	}
+
+	return states, nil
+}
+
+// RebuildCache swaps the whole index at once. Requests writing the index are held off from before
+// postgres is read until the swap, the ones already writing it are waited for so what they wrote is
+// read back. An alert the watcher fires meanwhile may come back and is dropped when it fires again.
+func (a *admin) RebuildCache(ctx context.Context, adminID int64) (types.RebuildResult, error) {
+	err := a.authorize(ctx, a.db, adminID, auditRebuildCache, "redis", "")
+	if err != nil {
+		return types.RebuildResult{}, err
+	}
+
+	var res types.RebuildResult
+	err = a.db.WithTx(ctx, func(tx database.Tx) error {
+		err := tx.LockAlertIndex(ctx)
+		if err != nil {
+			return err
+		}
+
+		alerts, err := tx.ListWatchedAlerts(ctx)
+		if err != nil {
+			return err
+		}
+
+		writes := make([]cache.AlertWrite, len(alerts))
+		for i, alert := range alerts {
+			writes[i] = indexWrite(alert, false)
+			if alert.Expression != "" {
+				res.ExpressionAlerts++
+			} else {
+				res.PriceAlerts++
+			}
+		}
+		return a.cache.RebuildAlerts(ctx, writes)
+	})
+	if err != nil {
+		return types.RebuildResult{}, err
+	}
+	return res, nil
+}
+
+func (a *admin) AuditLog(ctx context.Context, req types.ListPageRequest) ([]database.AuditLog, error) {
+	err := a.authorize(ctx, a.db, req.AdminID, auditListAuditLog, "audit_log", "")
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := a.db.ListAuditLog(ctx, database.ListAuditLogParams{
+		BeforeID: req.Cursor,
+		MaxRows:  req.Limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if entries == nil {
+		entries = []database.AuditLog{}
+	}
+	return entries, nil
+}
+
+// authorize lets admins through and records what they are about to do. Actions that change
+// something pass their transaction so the entry is only kept when the change is.
+func (a *admin) authorize(ctx context.Context, q database.Querier, adminID int64, action string, target string, detail string) error {
+	user, err := q.GetUserById(ctx, adminID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.ErrNotAuthorized
+	}
+	if err != nil {
+		return err
+	}
+	if user.Role != types.RoleAdmin {
+		return types.ErrForbidden
+	}
+
+	return q.CreateAuditEntry(ctx, database.CreateAuditEntryParams{
+		AdminID: adminID,
+		Action:  action,
+		Target:  target,
+		Detail:  detail,
+	})
+}
+
+func userTarget(userID int64) string {
+	return "user:" + strconv.FormatInt(userID, 10)
+}
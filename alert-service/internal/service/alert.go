@@ -0,0 +1,416 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	database "alert-service/database/sqlc"
+	"alert-service/internal/cache"
+	"alert-service/internal/expression"
+	"alert-service/internal/logger"
+	"alert-service/internal/types"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type Alerter interface {
+	// creates an alert and pushes to postgres and redis for indexing it in a sorted set
+	Create(ctx context.Context, req types.CreateAlertRequest) (database.Alert, error)
+
+	// creates an alert over an expression of several pairs, the expression is type checked before it is stored
+	CreateExpression(ctx context.Context, req types.CreateExpressionAlertRequest) (database.Alert, error)
+
+	// List your alerts a page at a time, filtered and sorted, the next page continues from the returned cursor
+	List(ctx context.Context, req types.ListAlertsRequest) (AlertPage, error)
+
+	// Update an alert in postgres and redis
+	Update(ctx context.Context, req types.UpdateAlertRequest) (database.Alert, error)
+
+	// Delete an alert from postgres and redis
+	Delete(ctx context.Context, req types.DeleteAlertRequest) error
+
+	// batches apply many alerts in one transaction and one redis round trip, with a result per item
+	BatchCreate(ctx context.Context, req types.BatchCreateAlertsRequest) (BatchResult, error)
+	BatchUpdate(ctx context.Context, req types.BatchUpdateAlertsRequest) (BatchResult, error)
+	BatchDelete(ctx context.Context, req types.BatchDeleteAlertsRequest) (BatchResult, error)
+
+	// History lists every recorded change of one of your alerts
+	History(ctx context.Context, req types.AlertHistoryRequest) (AlertHistory, error)
+
+	// Export streams your alerts as csv or json, Import reads the same format back
+	Export(ctx context.Context, req types.ExportAlertsRequest, w io.Writer) error
+	Import(ctx context.Context, req types.ImportAlertsRequest, r io.Reader) (ImportResult, error)
+
+	// Usage shows the plan of the user, its limits and how much of them is taken
+	Usage(ctx context.Context, userID int64) (Usage, error)
+}
+
+// AlertPage is one page of a listing, the cursor is empty on the last page
+type AlertPage struct {
+	Alerts     []database.Alert `json:"alerts"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+// AlertHistory is an alert with the changes recorded for it
+type AlertHistory struct {
+	Alert  database.Alert        `json:"alert"`
+	Events []database.AlertEvent `json:"events"`
+}
+
+// upper bound of a listing without an end date
+var endOfTime = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+
+type alert struct {
+	cache   cache.Cacher
+	db      database.Store
+	cursors *cursorSigner
+	sources []string
+}
+
+// cursorSecret signs the page cursors handed to clients, sources are the exchanges the watchers
+// read so an alert on any other one is refused instead of never firing
+func NewAlertService(cache cache.Cacher, db database.Store, cursorSecret []byte, sources []string) Alerter {
+	return &alert{
+		cache:   cache,
+		db:      db,
+		cursors: newCursorSigner(cursorSecret),
+		sources: sources,
+	}
+}
+
+// alert is created in postgres, get alert id from postgres, push alert_id with price to redis sorted sets.
+// the insert is only committed once redis has the alert so the watcher never misses a stored one
+func (a *alert) Create(ctx context.Context, req types.CreateAlertRequest) (database.Alert, error) {
+	source, err := a.alertSource(req.Source)
+	if err != nil {
+		return database.Alert{}, err
+	}
+	params := database.CreateAlertParams{
+		UserID:    req.UserID,
+		Crypto:    req.Currency,
+		Price:     req.Price,
+		Direction: req.Direction,
+		Source:    source,
+	}
+
+	var res database.Alert
+	err = a.db.WithTx(ctx, func(q database.Tx) error {
+		err := checkQuota(ctx, q, req.UserID, 0, types.Currency(req.Currency))
+		if err != nil {
+			return err
+		}
+
+		res, err = q.CreateAlert(ctx, params)
+		if err != nil {
+			return types.ErrDuplicateAlert
+		}
+
+		err = recordEvent(ctx, q, res, types.EventCreated, describeAlert(res))
+		if err != nil {
+			return err
+		}
+		err = q.ShareAlertIndex(ctx)
+		if err != nil {
+			return err
+		}
+
+		return a.cache.AddAlert(ctx, res.ID, res.Crypto, res.Source, res.Price, res.Direction)
+	})
+	if err != nil {
+		return database.Alert{}, err
+	}
+
+	a.publish(ctx, res)
+	return res, nil
+}
+
+// expression is parsed up front so only well typed conditions reach postgres and the watcher
+func (a *alert) CreateExpression(ctx context.Context, req types.CreateExpressionAlertRequest) (database.Alert, error) {
+	expr, err := expression.ParseExpr(req.Expression)
+	if err != nil {
+		return database.Alert{}, types.NewErrValidation(err)
+	}
+	source, err := a.alertSource(req.Source)
+	if err != nil {
+		return database.Alert{}, err
+	}
+
+	params := database.CreateExpressionAlertParams{
+		UserID:     req.UserID,
+		Expression: expr.String(),
+		Source:     source,
+	}
+
+	var res database.Alert
+	err = a.db.WithTx(ctx, func(q database.Tx) error {
+		err := checkQuota(ctx, q, req.UserID, 0, expr.Pairs()...)
+		if err != nil {
+			return err
+		}
+
+		res, err = q.CreateExpressionAlert(ctx, params)
+		if err != nil {
+			return types.ErrDuplicateAlert
+		}
+
+		err = recordEvent(ctx, q, res, types.EventCreated, describeAlert(res))
+		if err != nil {
+			return err
+		}
+		err = q.ShareAlertIndex(ctx)
+		if err != nil {
+			return err
+		}
+
+		return a.cache.AddExpression(ctx, res.ID, res.Expression, res.Source)
+	})
+	if err != nil {
+		return database.Alert{}, err
+	}
+
+	a.publish(ctx, res)
+	return res, nil
+}
+
+// pages by keyset on the sort column and the id, one extra row is read to know whether there is a next page
+func (a *alert) List(ctx context.Context, req types.ListAlertsRequest) (AlertPage, error) {
+	if req.Sort == "" {
+		req.Sort = types.SortCreatedAt
+	}
+	if req.Limit == 0 {
+		req.Limit = types.DefaultListLimit
+	}
+	if req.To.IsZero() {
+		req.To = endOfTime
+	}
+	// a null array would match no status at all
+	if req.Status == nil {
+		req.Status = []string{}
+	}
+	if !req.From.Before(req.To) {
+		return AlertPage{}, types.NewErrValidation(errors.New("from must be before to"))
+	}
+
+	var crypto string
+	if req.Pair != "" {
+		pair, ok := types.ParsePair(req.Pair)
+		if !ok {
+			return AlertPage{}, types.ErrUnknownPair
+		}
+		crypto = string(pair)
+	}
+
+	var after cursor
+	if req.Cursor != "" {
+		var err error
+		after, err = a.cursors.decode(req.Cursor)
+		if err != nil || after.UserID != req.UserID || after.Sort != req.Sort {
+			return AlertPage{}, types.ErrInvalidCursor
+		}
+	}
+
+	res, err := a.list(ctx, req, crypto, after)
+	if err != nil {
+		return AlertPage{}, err
+	}
+
+	page := AlertPage{Alerts: res}
+	if len(res) > int(req.Limit) {
+		page.Alerts = res[:req.Limit]
+		page.NextCursor, err = a.cursors.encode(cursorAfter(req.Sort, page.Alerts[req.Limit-1]))
+		if err != nil {
+			return AlertPage{}, err
+		}
+	}
+	if page.Alerts == nil {
+		page.Alerts = []database.Alert{}
+	}
+	return page, nil
+}
+
+func (a *alert) list(ctx context.Context, req types.ListAlertsRequest, crypto string, after cursor) ([]database.Alert, error) {
+	maxRows := req.Limit + 1
+	switch req.Sort {
+	case types.SortPrice:
+		return a.db.ListAlertsByPrice(ctx, database.ListAlertsByPriceParams{
+			UserID:      req.UserID,
+			Crypto:      crypto,
+			Statuses:    req.Status,
+			CreatedFrom: req.From,
+			CreatedTo:   req.To,
+			AfterID:     after.ID,
+			AfterPrice:  after.Price,
+			MaxRows:     maxRows,
+		})
+
+	case types.SortPair:
+		return a.db.ListAlertsByPair(ctx, database.ListAlertsByPairParams{
+			UserID:      req.UserID,
+			Crypto:      crypto,
+			Statuses:    req.Status,
+			CreatedFrom: req.From,
+			CreatedTo:   req.To,
+			AfterID:     after.ID,
+			AfterCrypto: after.Pair,
+			MaxRows:     maxRows,
+		})
+
+	default:
+		return a.db.ListAlertsByCreatedAt(ctx, database.ListAlertsByCreatedAtParams{
+			UserID:         req.UserID,
+			Crypto:         crypto,
+			Statuses:       req.Status,
+			CreatedFrom:    req.From,
+			CreatedTo:      req.To,
+			AfterID:        after.ID,
+			AfterCreatedAt: after.CreatedAt,
+			MaxRows:        maxRows,
+		})
+	}
+}
+
+// the row stays locked from the ownership check to the update so a concurrent trigger or delete
+// cannot slip in between. The index is changed like in a batch, before the commit.
+func (a *alert) Update(ctx context.Context, req types.UpdateAlertRequest) (database.Alert, error) {
+	update := types.AlertUpdate{
+		AlertID:   req.AlertID,
+		Currency:  req.Currency,
+		Price:     req.Price,
+		Direction: req.Direction,
+	}
+
+	var res database.Alert
+	err := a.db.WithTx(ctx, func(tx database.Tx) error {
+		var writes []cache.AlertWrite
+		var err error
+		res, writes, err = a.updateAlert(ctx, tx, req.UserID, update)
+		if err != nil {
+			return err
+		}
+		return a.writeIndex(ctx, tx, writes)
+	})
+	if err != nil {
+		return database.Alert{}, err
+	}
+
+	a.publish(ctx, res)
+	return res, nil
+}
+
+func (a *alert) Delete(ctx context.Context, req types.DeleteAlertRequest) error {
+	var res database.Alert
+	err := a.db.WithTx(ctx, func(tx database.Tx) error {
+		var writes []cache.AlertWrite
+		var err error
+		res, writes, err = a.deleteAlert(ctx, tx, req.UserID, req.AlertID)
+		if err != nil {
+			return err
+		}
+		return a.writeIndex(ctx, tx, writes)
+	})
+	if err != nil {
+		return err
+	}
+
+	a.publish(ctx, res)
+	return nil
+}
+
+// writeIndex applies the index changes of a transaction last, a failure keeps the alerts in both stores
+// as they were
+func (a *alert) writeIndex(ctx context.Context, tx database.Tx, writes []cache.AlertWrite) error {
+	err := tx.ShareAlertIndex(ctx)
+	if err != nil {
+		return err
+	}
+	return a.cache.WriteAlerts(ctx, writes)
+}
+
+// History returns the alert with its recorded changes, oldest first
+func (a *alert) History(ctx context.Context, req types.AlertHistoryRequest) (AlertHistory, error) {
+	res, err := a.db.GetAlertByID(ctx, req.AlertID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return AlertHistory{}, types.ErrAlertNotFound
+	}
+	if err != nil {
+		return AlertHistory{}, err
+	}
+
+	if res.UserID != req.UserID {
+		return AlertHistory{}, types.ErrNotAuthorized
+	}
+
+	events, err := a.db.GetAlertEvents(ctx, req.AlertID)
+	if err != nil {
+		return AlertHistory{}, err
+	}
+	if events == nil {
+		events = []database.AlertEvent{}
+	}
+
+	return AlertHistory{
+		Alert:  res,
+		Events: events,
+	}, nil
+}
+
+// recordEvent appends to the history of an alert, always inside the transaction that made the change
+// so the history cannot disagree with the alert
+func recordEvent(ctx context.Context, q database.Querier, res database.Alert, typ string, detail string) error {
+	var price string
+	if res.Expression == "" {
+		price = strconv.FormatFloat(res.Price, 'f', -1, 64)
+	}
+
+	return q.CreateAlertEvent(ctx, database.CreateAlertEventParams{
+		AlertID: res.ID,
+		Type:    typ,
+		Price:   price,
+		Detail:  detail,
+	})
+}
+
+// describeAlert is the condition of an alert as the history shows it
+func describeAlert(res database.Alert) string {
+	if res.Expression != "" {
+		return res.Expression + " on " + res.Source
+	}
+
+	direction := "below"
+	if res.Direction {
+		direction = "above"
+	}
+	return fmt.Sprintf("%s %s %s on %s", types.PairName(types.Currency(res.Crypto)), direction, strconv.FormatFloat(res.Price, 'f', -1, 64), res.Source)
+}
+
+// alerts fire on the consensus price unless a single exchange is asked for, which has to be one
+// the watchers read
+func (a *alert) alertSource(source string) (string, error) {
+	if source == "" || source == types.SourceConsensus {
+		return types.SourceConsensus, nil
+	}
+	if !slices.Contains(a.sources, source) {
+		return "", types.NewErrValidation(fmt.Errorf("source %q is not watched, use consensus or one of %s", source, strings.Join(a.sources, ", ")))
+	}
+	return source, nil
+}
+
+// publish tells the owner's live streams about the new state of an alert, a failed push is
+// only logged since the alert itself is already stored
+func (a *alert) publish(ctx context.Context, res database.Alert) {
+	err := cache.PublishAlertEvent(ctx, a.cache, types.AlertEvent{
+		AlertID: res.ID,
+		UserID:  res.UserID,
+		Status:  res.Status,
+		At:      time.Now(),
+	})
+	if err != nil {
+		logger.Error().Str("err", err.Error()).Int64("alertID", res.ID).Send()
+	}
+}
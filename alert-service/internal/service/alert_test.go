@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	database "alert-service/database/sqlc"
+	"alert-service/internal/cache"
+	"alert-service/internal/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory(t *testing.T) {
+	store := &memStore{plan: database.Plan{Name: types.PlanFree}}
+	svc := NewAlertService(&memCache{}, store, []byte("secret"), []string{types.SourceBinance})
+	ctx := context.Background()
+
+	res, err := svc.Create(ctx, types.CreateAlertRequest{UserID: 1, Currency: string(types.BTC), Price: 100, Direction: true})
+	require.NoError(t, err)
+	// another user's alert in between, its events are not part of the history
+	other, err := svc.Create(ctx, types.CreateAlertRequest{UserID: 2, Currency: string(types.ETH), Price: 5})
+	require.NoError(t, err)
+	_, err = svc.Update(ctx, types.UpdateAlertRequest{UserID: 1, AlertID: res.ID, Currency: string(types.BTC), Price: 200, Direction: true})
+	require.NoError(t, err)
+	err = svc.Delete(ctx, types.DeleteAlertRequest{UserID: 1, AlertID: res.ID})
+	require.NoError(t, err)
+
+	// every change is recorded with the alert as it was after it, oldest first
+	history, err := svc.History(ctx, types.AlertHistoryRequest{UserID: 1, AlertID: res.ID})
+	require.NoError(t, err)
+	assert.Equal(t, res.ID, history.Alert.ID)
+	assert.Equal(t, string(types.Deleted), history.Alert.Status)
+
+	var kinds, prices, details []string
+	for i, event := range history.Events {
+		assert.Equal(t, res.ID, event.AlertID)
+		if i > 0 {
+			assert.Greater(t, event.ID, history.Events[i-1].ID)
+		}
+		kinds = append(kinds, event.Type)
+		prices = append(prices, event.Price)
+		details = append(details, event.Detail)
+	}
+	assert.Equal(t, []string{types.EventCreated, types.EventUpdated, types.EventDeleted}, kinds)
+	assert.Equal(t, []string{"100", "200", "200"}, prices)
+	assert.Equal(t, []string{"btcusdt above 100 on consensus", "btcusdt above 200 on consensus", ""}, details)
+
+	// only the owner sees the history, an unknown alert is not found
+	_, err = svc.History(ctx, types.AlertHistoryRequest{UserID: 2, AlertID: res.ID})
+	assert.ErrorIs(t, err, types.ErrNotAuthorized)
+	_, err = svc.History(ctx, types.AlertHistoryRequest{UserID: 1, AlertID: 99})
+	assert.ErrorIs(t, err, types.ErrAlertNotFound)
+
+	history, err = svc.History(ctx, types.AlertHistoryRequest{UserID: 2, AlertID: other.ID})
+	require.NoError(t, err)
+	require.Len(t, history.Events, 1)
+	assert.Equal(t, types.EventCreated, history.Events[0].Type)
+
+	// an alert without events has an empty history, not a missing one
+	quiet := store.addAlert(database.Alert{UserID: 1, Crypto: string(types.SOL), Status: string(types.Created)})
+	history, err = svc.History(ctx, types.AlertHistoryRequest{UserID: 1, AlertID: quiet.ID})
+	require.NoError(t, err)
+	assert.NotNil(t, history.Events)
+	assert.Empty(t, history.Events)
+}
+
+func TestAlertSource(t *testing.T) {
+	store := &memStore{plan: database.Plan{Name: types.PlanFree}}
+	svc := NewAlertService(&memCache{}, store, []byte("secret"), []string{types.SourceBinance})
+	ctx := context.Background()
+
+	// no source is the consensus, a watched exchange is kept
+	res, err := svc.Create(ctx, types.CreateAlertRequest{UserID: 1, Currency: string(types.BTC), Price: 100})
+	require.NoError(t, err)
+	assert.Equal(t, types.SourceConsensus, res.Source)
+	res, err = svc.Create(ctx, types.CreateAlertRequest{UserID: 1, Currency: string(types.BTC), Price: 200, Source: types.SourceBinance})
+	require.NoError(t, err)
+	assert.Equal(t, types.SourceBinance, res.Source)
+
+	// an exchange no watcher reads would never fire
+	var vErr *types.ErrValidation
+	_, err = svc.Create(ctx, types.CreateAlertRequest{UserID: 1, Currency: string(types.BTC), Price: 300, Source: types.SourceCoinbase})
+	assert.ErrorAs(t, err, &vErr)
+	_, err = svc.CreateExpression(ctx, types.CreateExpressionAlertRequest{UserID: 1, Expression: "btcusdt > 300", Source: types.SourceCoinbase})
+	assert.ErrorAs(t, err, &vErr)
+
+	rows := "pair,price,direction,source\nbtcusdt,300,true,coinbase\n"
+	imported, err := svc.Import(ctx, types.ImportAlertsRequest{UserID: 1, Format: types.FormatCSV, OnConflict: types.ConflictSkip}, strings.NewReader(rows))
+	require.NoError(t, err)
+	assert.Equal(t, 1, imported.Invalid)
+	assert.Contains(t, imported.Rows[0].Error, "not watched")
+	assert.Len(t, store.alerts, 2)
+}
+
+func TestUpdateIndex(t *testing.T) {
+	store := &memStore{plan: database.Plan{Name: types.PlanFree}}
+	c := &memCache{}
+	svc := NewAlertService(c, store, []byte("secret"), []string{types.SourceBinance})
+	ctx := context.Background()
+
+	waiting := store.addAlert(database.Alert{UserID: 1, Crypto: string(types.BTC), Price: 100, Direction: true, Status: string(types.Created), Source: types.SourceConsensus})
+	fired := store.addAlert(database.Alert{UserID: 1, Crypto: string(types.ETH), Price: 5, Direction: true, Status: string(types.Triggered), Source: types.SourceConsensus})
+
+	// the old target leaves the index and the new one takes its place
+	_, err := svc.Update(ctx, types.UpdateAlertRequest{UserID: 1, AlertID: waiting.ID, Currency: string(types.SOL), Price: 50})
+	require.NoError(t, err)
+	require.Len(t, c.writes, 2)
+	assert.Equal(t, indexWrite(waiting, true), c.writes[0])
+	assert.False(t, c.writes[1].Remove)
+	assert.Equal(t, string(types.SOL), c.writes[1].Crypto)
+	assert.Equal(t, 50.0, c.writes[1].Price)
+	assert.False(t, c.writes[1].Direction)
+
+	// an alert that already fired is not armed again
+	c.writes = nil
+	_, err = svc.Update(ctx, types.UpdateAlertRequest{UserID: 1, AlertID: fired.ID, Currency: string(types.ETH), Price: 6, Direction: true})
+	require.NoError(t, err)
+	assert.Equal(t, []cache.AlertWrite{indexWrite(fired, true)}, c.writes)
+
+	// a deleted alert leaves the index
+	c.writes = nil
+	err = svc.Delete(ctx, types.DeleteAlertRequest{UserID: 1, AlertID: waiting.ID})
+	require.NoError(t, err)
+	require.Len(t, c.writes, 1)
+	assert.True(t, c.writes[0].Remove)
+	assert.Equal(t, string(types.SOL), c.writes[0].Crypto)
+
+	// nothing is written for someone else's alert
+	c.writes = nil
+	err = svc.Delete(ctx, types.DeleteAlertRequest{UserID: 2, AlertID: fired.ID})
+	assert.ErrorIs(t, err, types.ErrNotAuthorized)
+	assert.Empty(t, c.writes)
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"testing"
+
+	"alert-service/internal/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPayloadAllows(t *testing.T) {
+	login := &Payload{UserID: 1}
+	assert.True(t, login.Allows(ScopeAccount))
+	assert.True(t, login.Allows(ScopeAlertsWrite))
+	assert.False(t, login.Allows(ScopeMFA))
+
+	// halfway through a login only the second step is open
+	mfa := &Payload{UserID: 1, Claims: Claims{Scope: ScopeMFA}}
+	assert.True(t, mfa.Allows(ScopeMFA))
+	assert.False(t, mfa.Allows(ScopeAlertsRead))
+
+	key := &Payload{UserID: 1, Claims: Claims{APIKeyID: 7, Scopes: []string{ScopeAlertsRead}}}
+	assert.True(t, key.Allows(ScopeAlertsRead))
+	assert.False(t, key.Allows(ScopeAlertsWrite))
+	assert.False(t, key.Allows(ScopeAccount))
+	assert.False(t, key.Allows(ScopeMFA))
+
+	assert.True(t, IsAPIKey(APIKeyPrefix+"abc"))
+	assert.False(t, IsAPIKey("v2.local.abc"))
+}
+
+func TestPayloadAllowsAdmin(t *testing.T) {
+	assert.False(t, (&Payload{UserID: 1}).Allows(ScopeAdmin))
+	assert.True(t, (&Payload{UserID: 1, Claims: Claims{Role: types.RoleAdmin}}).Allows(ScopeAdmin))
+
+	// the role of a user does not pass to their keys
+	key := &Payload{UserID: 1, Claims: Claims{Role: types.RoleAdmin, APIKeyID: 7, Scopes: []string{ScopeAlertsRead}}}
+	assert.False(t, key.Allows(ScopeAdmin))
+}
@@ -0,0 +1,355 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	database "alert-service/database/sqlc"
+	"alert-service/internal/cache"
+	"alert-service/internal/logger"
+	"alert-service/internal/types"
+
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type Auther interface {
+	SignUp(ctx context.Context, req types.SignUpUserRequest) (types.SignUpUserResponse, error)
+	Login(ctx context.Context, req types.LoginUserRequest) (types.LoginUserResponse, error)
+
+	// two-factor authentication with an authenticator app, enrolled first and turned on by a code
+	EnrollTOTP(ctx context.Context, userID int64) (types.TOTPEnrollment, error)
+	ConfirmTOTP(ctx context.Context, req types.TOTPRequest) (types.RecoveryCodes, error)
+	// LoginTOTP finishes the login of a user with two-factor authentication turned on
+	LoginTOTP(ctx context.Context, req types.LoginTOTPRequest) (types.LoginUserResponse, error)
+	StepUp(ctx context.Context, req types.TOTPRequest) (types.LoginUserResponse, error)
+	// CheckStepUp fails when the token is too old a proof of the second factor for sensitive operations
+	CheckStepUp(payload *Payload) error
+
+	// api keys let bots use the alert routes without logging in
+	CreateAPIKey(ctx context.Context, req types.CreateAPIKeyRequest) (types.CreateAPIKeyResponse, error)
+	ListAPIKeys(ctx context.Context, userID int64) ([]types.APIKey, error)
+	RevokeAPIKey(ctx context.Context, req types.RevokeAPIKeyRequest) error
+	// AuthenticateAPIKey is to keys what Maker.Verify is to tokens
+	AuthenticateAPIKey(ctx context.Context, key string) (*Payload, error)
+
+	// single sign-on with an OpenID Connect provider, StartOIDC sends the user to the provider and
+	// FinishOIDC logs them in once it sent them back. LinkOIDC does the same for a logged in user, whose
+	// account the identity is then linked to.
+	StartOIDC(ctx context.Context) (types.OIDCStart, error)
+	LinkOIDC(ctx context.Context, userID int64) (types.OIDCStart, error)
+	FinishOIDC(ctx context.Context, req types.OIDCCallbackRequest) (types.LoginUserResponse, error)
+}
+
+// LoginConfig slows password guessing down, per account with growing delays up to a lockout and per
+// ip across every account it tries
+type LoginConfig struct {
+	// failed logins in a row before each further one doubles the wait for the next attempt, from a second on
+	FreeAttempts int32 `env:"LOGIN_FREE_ATTEMPTS" default:"3"`
+	// failed logins in a row that lock the account, the user is emailed about it
+	MaxAttempts int32         `env:"LOGIN_MAX_ATTEMPTS" default:"10"`
+	Lockout     time.Duration `env:"LOGIN_LOCKOUT" default:"15m"`
+	// failed logins of one ip in a window before the ip is refused until the window ends
+	MaxIPFailures int           `env:"LOGIN_MAX_IP_FAILURES" default:"50"`
+	IPWindow      time.Duration `env:"LOGIN_IP_WINDOW" default:"15m"`
+}
+
+func (c *LoginConfig) Validate() error {
+	switch {
+	case c.FreeAttempts < 0 || c.FreeAttempts >= c.MaxAttempts:
+		return fmt.Errorf("invalid LOGIN_FREE_ATTEMPTS %d, it must be below LOGIN_MAX_ATTEMPTS", c.FreeAttempts)
+	case c.Lockout <= 0:
+		return fmt.Errorf("invalid LOGIN_LOCKOUT %s", c.Lockout)
+	case c.MaxIPFailures < 1:
+		return fmt.Errorf("invalid LOGIN_MAX_IP_FAILURES %d", c.MaxIPFailures)
+	case c.IPWindow <= 0:
+		return fmt.Errorf("invalid LOGIN_IP_WINDOW %s", c.IPWindow)
+	}
+	return nil
+}
+
+// delay is how long an account waits for its next attempt after failures failed logins in a row
+func (c LoginConfig) delay(failures int32) time.Duration {
+	if failures >= c.MaxAttempts {
+		return c.Lockout
+	}
+	if failures <= c.FreeAttempts {
+		return 0
+	}
+
+	d := time.Second << (failures - c.FreeAttempts - 1)
+	if d > c.Lockout {
+		return c.Lockout
+	}
+	return d
+}
+
+type auther struct {
+	db       database.Store
+	cache    cache.Cacher
+	notifier Notifier
+	token    Maker
+	tokenExp time.Duration
+	login    LoginConfig
+	totp     TOTPConfig
+	secrets  *secretBox
+	// nil when single sign-on is off
+	oidc *oidcClient
+}
+
+func NewAuthSvc(db database.Store, cache cache.Cacher, notifier Notifier, token Maker, tokenExp time.Duration, login LoginConfig, totp TOTPConfig, oidc OIDCConfig, secretKey []byte) Auther {
+	return &auther{
+		db:       db,
+		cache:    cache,
+		notifier: notifier,
+		token:    token,
+		tokenExp: tokenExp,
+		login:    login,
+		totp:     totp,
+		secrets:  newSecretBox(secretKey),
+		oidc:     newOIDCClient(oidc),
+	}
+}
+
+func (a *auther) SignUp(ctx context.Context, req types.SignUpUserRequest) (types.SignUpUserResponse, error) {
+	hashedPassword, err := hashPassword(req.Password)
+	if err != nil {
+		return types.SignUpUserResponse{}, err
+	}
+
+	createUserParams := database.CreateUserParams{
+		Email:          normalizeEmail(req.Email),
+		HashedPassword: hashedPassword,
+	}
+
+	res, err := a.db.CreateUser(ctx, createUserParams)
+	if err != nil {
+		return types.SignUpUserResponse{}, types.ErrUserAlreadyExists
+	}
+
+	return types.SignUpUserResponse{
+		UserID:    res.ID,
+		CreatedAt: res.CreatedAt,
+	}, nil
+}
+
+func (a *auther) Login(ctx context.Context, req types.LoginUserRequest) (types.LoginUserResponse, error) {
+	user, err := a.startLoginAttempt(ctx, req.UserID, req.IP)
+	if err != nil {
+		return types.LoginUserResponse{}, err
+	}
+
+	err = checkPassword(req.Password, user.HashedPassword)
+	if err != nil {
+		return types.LoginUserResponse{}, a.loginFailed(user, req.IP, req.UserAgent)
+	}
+	user, err = a.loginPassed(ctx, user, req.IP)
+	if err != nil {
+		return types.LoginUserResponse{}, err
+	}
+
+	return a.firstFactorPassed(ctx, user, req.IP, req.UserAgent)
+}
+
+// firstFactorPassed hands users with two-factor authentication an mfa token for the second step and
+// logs the others in
+func (a *auther) firstFactorPassed(ctx context.Context, user database.User, ip string, userAgent string) (types.LoginUserResponse, error) {
+	// failures are kept until the code is right too, or the password would reset the count of code guesses
+	if user.TotpEnabled {
+		mfaToken, _, err := a.token.Create(user.ID, a.totp.MFATokenDuration, Claims{Scope: ScopeMFA})
+		if err != nil {
+			return types.LoginUserResponse{}, err
+		}
+		return types.LoginUserResponse{
+			MFARequired: true,
+			MFAToken:    mfaToken,
+			User:        types.SignUpUserResponse{UserID: user.ID, CreatedAt: user.CreatedAt},
+		}, nil
+	}
+
+	return a.finishLogin(ctx, user, ip, userAgent)
+}
+
+// finishLogin runs once every factor of the user checked out
+func (a *auther) finishLogin(ctx context.Context, user database.User, ip string, userAgent string) (types.LoginUserResponse, error) {
+	if user.FailedLogins > 0 {
+		_, err := a.db.UnlockUser(ctx, user.ID)
+		if err != nil {
+			return types.LoginUserResponse{}, err
+		}
+	}
+
+	err := a.recordLogin(ctx, user, ip, userAgent)
+	if err != nil {
+		return types.LoginUserResponse{}, err
+	}
+
+	return a.accessToken(user)
+}
+
+// tokens carry the role of the user, and when the second factor was last checked for users with
+// two-factor authentication
+func (a *auther) accessToken(user database.User) (types.LoginUserResponse, error) {
+	claims := Claims{Role: user.Role}
+	if user.TotpEnabled {
+		claims.MFA = true
+		claims.MFAVerifiedAt = time.Now()
+	}
+
+	accessToken, accessPayload, err := a.token.Create(user.ID, a.tokenExp, claims)
+	if err != nil {
+		return types.LoginUserResponse{}, err
+	}
+
+	return types.LoginUserResponse{
+		AccessToken:          accessToken,
+		AccessTokenExpiresAt: accessPayload.ExpiredAt,
+		User:                 types.SignUpUserResponse{UserID: user.ID, CreatedAt: user.CreatedAt},
+	}, nil
+}
+
+// startLoginAttempt counts an attempt against the ip and the account before its credential is checked,
+// so guesses made in parallel cannot all pass limits that would stop them one after the other. An ip
+// that failed too often is refused before any account is looked at. The account is held back for the
+// delay a failure would cause right away, the next attempt waits for it. An attempt is a failure until
+// loginPassed takes it back.
+func (a *auther) startLoginAttempt(ctx context.Context, userID int64, ip string) (database.User, error) {
+	n, ttl, err := a.cache.IncrCounter(ctx, loginIPKey(ip), a.login.IPWindow)
+	if err != nil {
+		return database.User{}, err
+	}
+	if n > a.login.MaxIPFailures {
+		return database.User{}, &types.ErrLoginLocked{RetryAfter: ttl}
+	}
+
+	var user database.User
+	err = a.db.WithTx(ctx, func(tx database.Tx) error {
+		var err error
+		user, err = tx.GetUserForUpdate(ctx, userID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return types.ErrNotAuthorized
+		}
+		if err != nil {
+			return err
+		}
+
+		// the credential is not even checked while the account waits, guesses cost nothing but time
+		if wait := time.Until(user.LockedUntil); wait > 0 {
+			return &types.ErrLoginLocked{RetryAfter: wait}
+		}
+
+		user.FailedLogins, err = tx.RecordLoginFailure(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		delay := a.login.delay(user.FailedLogins)
+		if delay == 0 {
+			return nil
+		}
+		user.LockedUntil = time.Now().Add(delay)
+		return tx.LockUser(ctx, database.LockUserParams{
+			ID:          user.ID,
+			LockedUntil: user.LockedUntil,
+		})
+	})
+	return user, err
+}
+
+// loginFailed is an attempt whose credential was wrong, it stays counted and the user is told once it
+// locked the account
+func (a *auther) loginFailed(user database.User, ip string, userAgent string) error {
+	if user.FailedLogins >= a.login.MaxAttempts {
+		a.notify(types.SecurityNotice{
+			UserID:    user.ID,
+			Kind:      types.NoticeLockout,
+			IP:        ip,
+			UserAgent: userAgent,
+			At:        time.Now(),
+			Until:     user.LockedUntil,
+		})
+	}
+	return types.ErrNotAuthorized
+}
+
+// loginPassed takes back an attempt whose credential checked out, earlier failures of the account are
+// kept until every factor of the login passed
+func (a *auther) loginPassed(ctx context.Context, user database.User, ip string) (database.User, error) {
+	err := a.cache.DecrCounter(ctx, loginIPKey(ip))
+	if err != nil {
+		return database.User{}, err
+	}
+
+	user.FailedLogins, err = a.db.ReleaseLoginAttempt(ctx, user.ID)
+	if err != nil {
+		return database.User{}, err
+	}
+	user.LockedUntil = time.Unix(0, 0)
+	return user, nil
+}
+
+// recordLogin remembers where the user logged in from, an ip or a device not seen before is reported
+// to them unless it is their first login
+func (a *auther) recordLogin(ctx context.Context, user database.User, ip string, userAgent string) error {
+	known, err := a.db.GetKnownLogin(ctx, database.GetKnownLoginParams{
+		UserID:    user.ID,
+		Ip:        ip,
+		UserAgent: userAgent,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = a.db.RecordLogin(ctx, database.RecordLoginParams{
+		UserID:    user.ID,
+		Ip:        ip,
+		UserAgent: userAgent,
+	})
+	if err != nil {
+		return err
+	}
+
+	if known.Logins > 0 && (known.FromIp == 0 || known.FromDevice == 0) {
+		a.notify(types.SecurityNotice{
+			UserID:    user.ID,
+			Kind:      types.NoticeNewLogin,
+			IP:        ip,
+			UserAgent: userAgent,
+			At:        time.Now(),
+		})
+	}
+	return nil
+}
+
+// notices are best effort, a login does not fail because email-service cannot be reached
+func (a *auther) notify(notice types.SecurityNotice) {
+	err := a.notifier.Notify(notice)
+	if err != nil {
+		logger.Error().Str("err", err.Error()).Str("msg", "security notice").Send()
+	}
+}
+
+func loginIPKey(ip string) string {
+	return "login:ip:" + ip
+}
+
+// hashPassword returns the bcrypt hash of the password
+func hashPassword(password string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hashedPassword), nil
+}
+
+// checkPassword checks if the provided password is correct or not
+func checkPassword(password string, hashedPassword string) error {
+	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+}
+
+// normalizeEmail is how an email is stored, addresses are looked up without case
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
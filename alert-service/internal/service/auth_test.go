@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	database "alert-service/database/sqlc"
+	"alert-service/internal/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginDelay(t *testing.T) {
+	cfg := LoginConfig{FreeAttempts: 3, MaxAttempts: 10, Lockout: 15 * time.Minute}
+
+	var delays []time.Duration
+	for failures := int32(1); failures <= 11; failures++ {
+		delays = append(delays, cfg.delay(failures))
+	}
+	assert.Equal(t, []time.Duration{
+		0, 0, 0,
+		time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 32 * time.Second,
+		15 * time.Minute, 15 * time.Minute,
+	}, delays)
+
+	// growing delays never outlast the lockout
+	cfg.Lockout = 5 * time.Second
+	assert.Equal(t, 5*time.Second, cfg.delay(9))
+}
+
+func TestLoginAttempts(t *testing.T) {
+	store := &memStore{}
+	c := &memCache{}
+	ctx := context.Background()
+	hash, err := hashPassword("password")
+	require.NoError(t, err)
+	user, err := store.CreateUser(ctx, database.CreateUserParams{Email: "user@example.com", HashedPassword: hash})
+	require.NoError(t, err)
+
+	maker, err := NewPasetoMaker("01234567890123456789012345678901")
+	require.NoError(t, err)
+	a := &auther{db: store, cache: c, token: maker, tokenExp: time.Minute, login: LoginConfig{
+		FreeAttempts:  1,
+		MaxAttempts:   3,
+		Lockout:       time.Minute,
+		MaxIPFailures: 3,
+		IPWindow:      time.Minute,
+	}}
+
+	// attempts are counted before the password is checked, the second of two running at the same time
+	// already holds the account back and a third one is refused
+	_, err = a.startLoginAttempt(ctx, user.ID, "192.0.2.1")
+	require.NoError(t, err)
+	second, err := a.startLoginAttempt(ctx, user.ID, "192.0.2.2")
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), second.FailedLogins)
+	_, err = a.startLoginAttempt(ctx, user.ID, "192.0.2.3")
+	var locked *types.ErrLoginLocked
+	require.ErrorAs(t, err, &locked)
+	assert.InDelta(t, time.Second, locked.RetryAfter, float64(100*time.Millisecond))
+
+	// a password that checks out takes its attempt back, earlier failures go once the login finished
+	store.updateUser(user.ID, func(u *database.User) { u.LockedUntil = time.Unix(0, 0) })
+	resp, err := a.Login(ctx, types.LoginUserRequest{UserID: user.ID, Password: "password", IP: "192.0.2.4"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, resp.AccessToken)
+	assert.Equal(t, int32(0), store.users[0].FailedLogins)
+	assert.Equal(t, 0, c.counters[loginIPKey("192.0.2.4")])
+
+	// an ip is refused once it failed too often, before any account is looked at
+	for i := 0; i < 3; i++ {
+		_, err = a.Login(ctx, types.LoginUserRequest{UserID: 99, Password: "password", IP: "192.0.2.9"})
+		assert.ErrorIs(t, err, types.ErrNotAuthorized)
+	}
+	_, err = a.Login(ctx, types.LoginUserRequest{UserID: user.ID, Password: "password", IP: "192.0.2.9"})
+	assert.ErrorAs(t, err, &locked)
+}
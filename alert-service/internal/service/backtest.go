@@ -0,0 +1,251 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	database "alert-service/database/sqlc"
+	"alert-service/internal/expression"
+	"alert-service/internal/types"
+)
+
+// default history a backtest replays when no window is given
+const backtestWindow = 30 * 24 * time.Hour
+
+type Backtester interface {
+	// Replays stored candles through the alert condition and returns when it would have fired,
+	// nothing is written to redis or kafka
+	Backtest(ctx context.Context, req types.BacktestRequest) (types.BacktestResponse, error)
+}
+
+type backtester struct {
+	db database.Querier
+}
+
+func NewBacktester(db database.Querier) Backtester {
+	return &backtester{
+		db: db,
+	}
+}
+
+func (b *backtester) Backtest(ctx context.Context, req types.BacktestRequest) (types.BacktestResponse, error) {
+	cond, err := backtestCondition(req)
+	if err != nil {
+		return types.BacktestResponse{}, types.NewErrValidation(err)
+	}
+
+	if req.Interval == "" {
+		req.Interval = "1m"
+	}
+	if req.To.IsZero() {
+		req.To = time.Now()
+	}
+	if req.From.IsZero() {
+		req.From = req.To.Add(-backtestWindow)
+	}
+	if !req.From.Before(req.To) {
+		return types.BacktestResponse{}, types.NewErrValidation(errors.New("from must be before to"))
+	}
+
+	history := make(map[types.Currency][]database.Candle)
+	count := 0
+	for _, pair := range cond.pairs {
+		candles, err := b.candles(ctx, pair, req.Interval, req.From, req.To)
+		if err != nil {
+			return types.BacktestResponse{}, err
+		}
+		history[pair] = candles
+		count += len(candles)
+	}
+
+	return types.BacktestResponse{
+		Expression: cond.desc,
+		Interval:   req.Interval,
+		From:       req.From,
+		To:         req.To,
+		Candles:    count,
+		Fires:      replay(cond, history),
+	}, nil
+}
+
+// condition is what a backtest replays, the pairs an alert reads and whether it fires at their prices
+type condition struct {
+	desc  string
+	pairs []types.Currency
+	fires func(prices map[types.Currency]float64) bool
+}
+
+// backtestCondition turns the request into the condition that is replayed, a price alert fires on the
+// same decision as in the watcher
+func backtestCondition(r types.BacktestRequest) (condition, error) {
+	if r.Expression != "" {
+		expr, err := expression.ParseExpr(r.Expression)
+		if err != nil {
+			return condition{}, err
+		}
+		return condition{
+			desc:  expr.String(),
+			pairs: expr.Pairs(),
+			fires: func(prices map[types.Currency]float64) bool {
+				ok, err := expr.Eval(prices)
+				return err == nil && ok
+			},
+		}, nil
+	}
+
+	pair, ok := types.ParsePair(r.Currency)
+	if !ok {
+		return condition{}, fmt.Errorf("unknown pair %q", r.Currency)
+	}
+	if r.Price <= 0 {
+		return condition{}, errors.New("price must be positive")
+	}
+
+	direction := "below"
+	if r.Direction {
+		direction = "above"
+	}
+	return condition{
+		desc:  fmt.Sprintf("%s %s %s", types.PairName(pair), direction, strconv.FormatFloat(r.Price, 'f', -1, 64)),
+		pairs: []types.Currency{pair},
+		fires: func(prices map[types.Currency]float64) bool {
+			price, ok := prices[pair]
+			if !ok {
+				return false
+			}
+			min, max := types.TargetRange(r.Direction, price)
+			return min <= r.Price && r.Price <= max
+		},
+	}, nil
+}
+
+// candles pages through the stored candles of a pair, a single read is capped at maxCandles
+func (b *backtester) candles(ctx context.Context, pair types.Currency, interval string, from, to time.Time) ([]database.Candle, error) {
+	var candles []database.Candle
+	for {
+		params := database.GetCandlesParams{
+			Pair:     types.PairName(pair),
+			Interval: interval,
+			FromTime: from,
+			ToTime:   to,
+			MaxRows:  maxCandles,
+		}
+		page, err := b.db.GetCandles(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+
+		candles = append(candles, page...)
+		if len(page) < maxCandles {
+			return candles, nil
+		}
+		from = page[len(page)-1].OpenTime.Add(time.Nanosecond)
+	}
+}
+
+// replay walks the candles of every referenced pair in time order and checks the condition at each step.
+// An alert only fires once live, here it re-arms as soon as the condition stops holding so the result
+// shows how often it would have fired.
+func replay(cond condition, history map[types.Currency][]database.Candle) []types.BacktestFire {
+	steps := make(map[time.Time][]database.Candle)
+	for _, candles := range history {
+		for _, c := range candles {
+			steps[c.OpenTime] = append(steps[c.OpenTime], c)
+		}
+	}
+
+	times := make([]time.Time, 0, len(steps))
+	for t := range steps {
+		times = append(times, t)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+
+	// a single pair condition is exact on the candle extremes, combined pairs are only checked on closes
+	single := len(cond.pairs) == 1
+
+	fires := []types.BacktestFire{}
+	closes := make(map[types.Currency]float64)
+	armed := true
+	for _, t := range times {
+		for _, c := range steps[t] {
+			pair, _ := types.ParsePair(c.Pair)
+			closes[pair] = c.Close
+		}
+
+		candidates := []map[types.Currency]float64{closes}
+		if single {
+			c := steps[t][0]
+			pair := cond.pairs[0]
+			candidates = append(candidates, map[types.Currency]float64{pair: c.High}, map[types.Currency]float64{pair: c.Low})
+		}
+
+		fired := false
+		for _, prices := range candidates {
+			if !cond.fires(prices) {
+				continue
+			}
+
+			fired = true
+			if armed {
+				fires = append(fires, types.BacktestFire{
+					Time:   t,
+					Prices: namedPrices(prices),
+				})
+			}
+			break
+		}
+		armed = !fired
+	}
+
+	return fires
+}
+
+func namedPrices(prices map[types.Currency]float64) map[string]float64 {
+	named := make(map[string]float64, len(prices))
+	for pair, price := range prices {
+		named[types.PairName(pair)] = price
+	}
+	return named
+}
+
+// BacktestCommand runs a backtest from the command line and prints the result as json
+func BacktestCommand(ctx context.Context, b Backtester, args []string, out io.Writer) error {
+	var req types.BacktestRequest
+	var from, to string
+
+	fs := flag.NewFlagSet("backtest", flag.ContinueOnError)
+	fs.StringVar(&req.Expression, "expr", "", "alert expression, e.g. \"btcusdt > 70000 && ethusdt > 4000\"")
+	fs.StringVar(&req.Currency, "currency", "", "pair of a single price alert, e.g. btcusdt@trade")
+	fs.Float64Var(&req.Price, "price", 0, "target price of a single price alert")
+	fs.BoolVar(&req.Direction, "above", false, "single price alert fires above the price instead of below")
+	fs.StringVar(&req.Interval, "interval", "1m", "candle interval to replay: 1m, 5m or 1h")
+	fs.StringVar(&from, "from", "", "start of the replay, RFC3339 or unix seconds (default 30 days ago)")
+	fs.StringVar(&to, "to", "", "end of the replay, RFC3339 or unix seconds (default now)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var err error
+	if req.From, err = types.ParseTime(from); err != nil {
+		return err
+	}
+	if req.To, err = types.ParseTime(to); err != nil {
+		return err
+	}
+
+	resp, err := b.Backtest(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(resp)
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	database "alert-service/database/sqlc"
+	"alert-service/internal/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplay(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	candle := func(pair string, minute int, high, low, close float64) database.Candle {
+		return database.Candle{
+			Pair:     pair,
+			Interval: "1m",
+			OpenTime: start.Add(time.Duration(minute) * time.Minute),
+			High:     high,
+			Low:      low,
+			Close:    close,
+		}
+	}
+
+	// a single price alert fires on the candle high and re-arms once the price falls back
+	above, err := backtestCondition(types.BacktestRequest{Currency: string(types.BTC), Price: 100, Direction: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "btcusdt above 100", above.desc)
+	fires := replay(above, map[types.Currency][]database.Candle{
+		types.BTC: {
+			candle("btcusdt", 0, 95, 90, 92),
+			candle("btcusdt", 1, 101, 91, 95),
+			candle("btcusdt", 2, 102, 99, 101),
+			candle("btcusdt", 3, 99, 90, 91),
+			candle("btcusdt", 4, 105, 95, 104),
+		},
+	})
+	assert.Len(t, fires, 2)
+	assert.Equal(t, start.Add(time.Minute), fires[0].Time)
+	assert.Equal(t, 101.0, fires[0].Prices["btcusdt"])
+	assert.Equal(t, start.Add(4*time.Minute), fires[1].Time)
+
+	// below fires on the candle low, like the watcher fires alerts below the price
+	below, err := backtestCondition(types.BacktestRequest{Currency: string(types.BTC), Price: 90})
+	assert.NoError(t, err)
+	fires = replay(below, map[types.Currency][]database.Candle{
+		types.BTC: {
+			candle("btcusdt", 0, 95, 91, 92),
+			candle("btcusdt", 1, 94, 89, 93),
+			candle("btcusdt", 2, 96, 92, 95),
+		},
+	})
+	assert.Len(t, fires, 1)
+	assert.Equal(t, start.Add(time.Minute), fires[0].Time)
+	assert.Equal(t, 89.0, fires[0].Prices["btcusdt"])
+
+	// combined pairs are evaluated on closes once every pair has a price
+	both, err := backtestCondition(types.BacktestRequest{Expression: "btcusdt > 100 && ethusdt > 10"})
+	assert.NoError(t, err)
+	fires = replay(both, map[types.Currency][]database.Candle{
+		types.BTC: {
+			candle("btcusdt", 0, 110, 100, 105),
+			candle("btcusdt", 1, 110, 100, 105),
+		},
+		types.ETH: {
+			candle("ethusdt", 1, 12, 9, 11),
+		},
+	})
+	assert.Len(t, fires, 1)
+	assert.Equal(t, map[string]float64{"btcusdt": 105, "ethusdt": 11}, fires[0].Prices)
+}
@@ -0,0 +1,284 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	database "alert-service/database/sqlc"
+	"alert-service/internal/cache"
+	"alert-service/internal/types"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var errBatchRolledBack = errors.New("rolled back, another item of the batch failed")
+
+// BatchResult reports every item of a batch in request order. Applied is false when an atomic batch
+// had a failed item, the items that went through are then reported as rolled back.
+type BatchResult struct {
+	Mode      string            `json:"mode"`
+	Applied   bool              `json:"applied"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+	Items     []BatchItemResult `json:"items"`
+}
+
+type BatchItemResult struct {
+	Index int             `json:"index"`
+	Alert *database.Alert `json:"alert,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+// batchItem applies the i-th item of a batch and returns the alert with the index changes it needs
+type batchItem func(ctx context.Context, q database.Querier, i int) (database.Alert, []cache.AlertWrite, error)
+
+func (a *alert) BatchCreate(ctx context.Context, req types.BatchCreateAlertsRequest) (BatchResult, error) {
+	specs := req.Alerts
+	if req.Ladder != nil {
+		if len(specs) > 0 {
+			return BatchResult{}, types.NewErrValidation(errors.New("give either alerts or a ladder"))
+		}
+		specs = priceLadder(*req.Ladder)
+	}
+
+	return a.batch(ctx, req.Mode, len(specs), func(ctx context.Context, q database.Querier, i int) (database.Alert, []cache.AlertWrite, error) {
+		source, err := a.alertSource(specs[i].Source)
+		if err != nil {
+			return database.Alert{}, nil, err
+		}
+		params := database.CreateAlertParams{
+			UserID:    req.UserID,
+			Crypto:    specs[i].Currency,
+			Price:     specs[i].Price,
+			Direction: specs[i].Direction,
+			Source:    source,
+		}
+		err = checkQuota(ctx, q, req.UserID, 0, types.Currency(specs[i].Currency))
+		if err != nil {
+			return database.Alert{}, nil, err
+		}
+
+		res, err := q.CreateAlert(ctx, params)
+		if database.IsUniqueViolation(err) {
+			return database.Alert{}, nil, types.ErrDuplicateAlert
+		}
+		if err != nil {
+			return database.Alert{}, nil, err
+		}
+
+		err = recordEvent(ctx, q, res, types.EventCreated, describeAlert(res))
+		if err != nil {
+			return database.Alert{}, nil, err
+		}
+
+		return res, []cache.AlertWrite{indexWrite(res, false)}, nil
+	})
+}
+
+func (a *alert) BatchUpdate(ctx context.Context, req types.BatchUpdateAlertsRequest) (BatchResult, error) {
+	return a.batch(ctx, req.Mode, len(req.Alerts), func(ctx context.Context, q database.Querier, i int) (database.Alert, []cache.AlertWrite, error) {
+		return a.updateAlert(ctx, q, req.UserID, req.Alerts[i])
+	})
+}
+
+func (a *alert) BatchDelete(ctx context.Context, req types.BatchDeleteAlertsRequest) (BatchResult, error) {
+	return a.batch(ctx, req.Mode, len(req.AlertIDs), func(ctx context.Context, q database.Querier, i int) (database.Alert, []cache.AlertWrite, error) {
+		return a.deleteAlert(ctx, q, req.UserID, req.AlertIDs[i])
+	})
+}
+
+// updateAlert moves the target of a price alert, for a single update and an item of a batch alike
+func (a *alert) updateAlert(ctx context.Context, q database.Querier, userID int64, update types.AlertUpdate) (database.Alert, []cache.AlertWrite, error) {
+	current, err := a.ownedAlert(ctx, q, userID, update.AlertID)
+	if err != nil {
+		return database.Alert{}, nil, err
+	}
+	if current.Expression != "" {
+		return database.Alert{}, nil, types.ErrExpressionAlert
+	}
+	err = checkUpdateQuota(ctx, q, current, update.Currency)
+	if err != nil {
+		return database.Alert{}, nil, err
+	}
+
+	params := database.UpdateAlertParams{
+		ID:        update.AlertID,
+		Crypto:    update.Currency,
+		Price:     update.Price,
+		Direction: update.Direction,
+	}
+	res, err := q.UpdateAlert(ctx, params)
+	if database.IsUniqueViolation(err) {
+		return database.Alert{}, nil, types.ErrDuplicateAlert
+	}
+	if err != nil {
+		return database.Alert{}, nil, err
+	}
+
+	err = recordEvent(ctx, q, res, types.EventUpdated, describeAlert(res))
+	if err != nil {
+		return database.Alert{}, nil, err
+	}
+
+	// the old entry is dropped first, only alerts that can still fire go back into the index
+	writes := []cache.AlertWrite{indexWrite(current, true)}
+	if res.Status == string(types.Created) {
+		writes = append(writes, indexWrite(res, false))
+	}
+	return res, writes, nil
+}
+
+// deleteAlert marks an alert deleted and drops it from the index, for a single delete and an item of a
+// batch alike
+func (a *alert) deleteAlert(ctx context.Context, q database.Querier, userID int64, alertID int64) (database.Alert, []cache.AlertWrite, error) {
+	res, err := a.ownedAlert(ctx, q, userID, alertID)
+	if err != nil {
+		return database.Alert{}, nil, err
+	}
+
+	params := database.UpdateAlertStatusParams{
+		ID:     res.ID,
+		Status: string(types.Deleted),
+	}
+	err = q.UpdateAlertStatus(ctx, params)
+	if err != nil {
+		return database.Alert{}, nil, err
+	}
+
+	err = recordEvent(ctx, q, res, types.EventDeleted, "")
+	if err != nil {
+		return database.Alert{}, nil, err
+	}
+
+	writes := []cache.AlertWrite{indexWrite(res, true)}
+	res.Status = string(types.Deleted)
+	return res, writes, nil
+}
+
+// ownedAlert locks the alert for the rest of the transaction once it is known to belong to the user
+func (a *alert) ownedAlert(ctx context.Context, q database.Querier, userID int64, alertID int64) (database.Alert, error) {
+	res, err := q.GetAlertForUpdate(ctx, alertID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return database.Alert{}, types.ErrAlertNotFound
+	}
+	if err != nil {
+		return database.Alert{}, err
+	}
+
+	if res.UserID != userID {
+		return database.Alert{}, types.ErrNotAuthorized
+	}
+	return res, nil
+}
+
+// batch runs every item in a savepoint of one transaction so a failed item only undoes its own writes,
+// the index changes of the applied items go to redis in one pipeline before the commit. Items keep
+// running after a failure so the caller learns about every bad item at once.
+func (a *alert) batch(ctx context.Context, mode string, n int, item batchItem) (BatchResult, error) {
+	if mode == "" {
+		mode = types.BatchAtomic
+	}
+
+	res := BatchResult{
+		Mode:  mode,
+		Items: make([]BatchItemResult, n),
+	}
+	var applied []database.Alert
+	err := a.db.WithTx(ctx, func(tx database.Tx) error {
+		var writes []cache.AlertWrite
+		for i := 0; i < n; i++ {
+			var alert database.Alert
+			var alertWrites []cache.AlertWrite
+			err := tx.Savepoint(ctx, func(q database.Querier) error {
+				var err error
+				alert, alertWrites, err = item(ctx, q, i)
+				return err
+			})
+
+			res.Items[i].Index = i
+			if isItemError(err) {
+				res.Items[i].Error = err.Error()
+				res.Failed++
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			res.Items[i].Alert = &alert
+			res.Succeeded++
+			applied = append(applied, alert)
+			writes = append(writes, alertWrites...)
+		}
+
+		if mode == types.BatchAtomic && res.Failed > 0 {
+			return errBatchRolledBack
+		}
+		return a.writeIndex(ctx, tx, writes)
+	})
+	if errors.Is(err, errBatchRolledBack) {
+		for i := range res.Items {
+			if res.Items[i].Alert != nil {
+				res.Items[i].Alert = nil
+				res.Items[i].Error = errBatchRolledBack.Error()
+			}
+		}
+		res.Succeeded = 0
+		return res, nil
+	}
+	if err != nil {
+		return BatchResult{}, err
+	}
+
+	res.Applied = true
+	for _, alert := range applied {
+		a.publish(ctx, alert)
+	}
+	return res, nil
+}
+
+// errors caused by the item itself, anything else aborts the whole batch
+func isItemError(err error) bool {
+	var vErr *types.ErrValidation
+	var qErr *types.ErrQuotaExceeded
+	return errors.Is(err, types.ErrDuplicateAlert) ||
+		errors.Is(err, types.ErrAlertNotFound) ||
+		errors.Is(err, types.ErrNotAuthorized) ||
+		errors.Is(err, types.ErrExpressionAlert) ||
+		errors.As(err, &vErr) ||
+		errors.As(err, &qErr)
+}
+
+func indexWrite(res database.Alert, remove bool) cache.AlertWrite {
+	return cache.AlertWrite{
+		Remove:     remove,
+		AlertID:    res.ID,
+		Crypto:     res.Crypto,
+		Source:     res.Source,
+		Price:      res.Price,
+		Direction:  res.Direction,
+		Expression: res.Expression,
+	}
+}
+
+// priceLadder spaces the alerts evenly, prices are rounded to 8 decimals to keep float noise out of
+// the unique constraint
+func priceLadder(l types.PriceLadder) []types.AlertSpec {
+	step := (l.To - l.From) / float64(l.Count-1)
+	specs := make([]types.AlertSpec, l.Count)
+	for i := range specs {
+		price := l.From + step*float64(i)
+		if i == l.Count-1 {
+			price = l.To
+		}
+
+		specs[i] = types.AlertSpec{
+			Currency:  l.Currency,
+			Price:     math.Round(price*1e8) / 1e8,
+			Direction: l.Direction,
+			Source:    l.Source,
+		}
+	}
+	return specs
+}
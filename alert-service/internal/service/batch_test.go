@@ -0,0 +1,34 @@
+package service
+
+import (
+	"testing"
+
+	"alert-service/internal/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPriceLadder(t *testing.T) {
+	specs := priceLadder(types.PriceLadder{
+		Currency: string(types.ETH),
+		From:     0.1,
+		To:       0.3,
+		Count:    3,
+		Source:   types.SourceBinance,
+	})
+
+	prices := make([]float64, len(specs))
+	for i, spec := range specs {
+		prices[i] = spec.Price
+		assert.Equal(t, string(types.ETH), spec.Currency)
+		assert.Equal(t, types.SourceBinance, spec.Source)
+	}
+	assert.Equal(t, []float64{0.1, 0.2, 0.3}, prices)
+
+	// a descending ladder ends exactly on its last price
+	specs = priceLadder(types.PriceLadder{Currency: string(types.BTC), From: 70000, To: 60000, Count: 5})
+	assert.Len(t, specs, 5)
+	assert.Equal(t, 70000.0, specs[0].Price)
+	assert.Equal(t, 67500.0, specs[1].Price)
+	assert.Equal(t, 60000.0, specs[4].Price)
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	database "alert-service/database/sqlc"
+)
+
+var errCursorSignature = errors.New("cursor signature mismatch")
+
+// cursor is the position of the last alert of a page, the next page starts right after it
+type cursor struct {
+	Sort      string    `json:"s"`
+	UserID    int64     `json:"u"`
+	ID        int64     `json:"i"`
+	CreatedAt time.Time `json:"t"`
+	Price     float64   `json:"p,omitempty"`
+	Pair      string    `json:"c,omitempty"`
+}
+
+func cursorAfter(sort string, last database.Alert) cursor {
+	return cursor{
+		Sort:      sort,
+		UserID:    last.UserID,
+		ID:        last.ID,
+		CreatedAt: last.CreatedAt,
+		Price:     last.Price,
+		Pair:      last.Crypto,
+	}
+}
+
+// cursorSigner makes cursors opaque to clients, a cursor that was not handed out by the api is
+// rejected instead of paging from an arbitrary position
+type cursorSigner struct {
+	key []byte
+}
+
+// the signing key is derived so the secret it comes from is never used as is
+func newCursorSigner(secret []byte) *cursorSigner {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("alert list cursor"))
+	return &cursorSigner{
+		key: mac.Sum(nil),
+	}
+}
+
+func (s *cursorSigner) encode(c cursor) (string, error) {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(s.sign(payload)), nil
+}
+
+func (s *cursorSigner) decode(token string) (cursor, error) {
+	enc := base64.RawURLEncoding
+	rawPayload, rawSig, ok := strings.Cut(token, ".")
+	if !ok {
+		return cursor{}, errCursorSignature
+	}
+
+	payload, err := enc.DecodeString(rawPayload)
+	if err != nil {
+		return cursor{}, err
+	}
+	sig, err := enc.DecodeString(rawSig)
+	if err != nil {
+		return cursor{}, err
+	}
+	if !hmac.Equal(sig, s.sign(payload)) {
+		return cursor{}, errCursorSignature
+	}
+
+	var c cursor
+	err = json.Unmarshal(payload, &c)
+	return c, err
+}
+
+func (s *cursorSigner) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
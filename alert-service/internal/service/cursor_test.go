@@ -0,0 +1,45 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	database "alert-service/database/sqlc"
+	"alert-service/internal/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCursor(t *testing.T) {
+	signer := newCursorSigner([]byte("12345678901234567890123456789012"))
+	last := database.Alert{
+		ID:        42,
+		UserID:    7,
+		Crypto:    string(types.BTC),
+		Price:     65000.5,
+		CreatedAt: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+	}
+
+	token, err := signer.encode(cursorAfter(types.SortPrice, last))
+	assert.NoError(t, err)
+
+	c, err := signer.decode(token)
+	assert.NoError(t, err)
+	assert.Equal(t, types.SortPrice, c.Sort)
+	assert.Equal(t, int64(7), c.UserID)
+	assert.Equal(t, int64(42), c.ID)
+	assert.Equal(t, 65000.5, c.Price)
+	assert.True(t, last.CreatedAt.Equal(c.CreatedAt))
+
+	// a changed payload or a cursor of another key is rejected
+	tampered := []byte(token)
+	tampered[3] ^= 1
+	_, err = signer.decode(string(tampered))
+	assert.Error(t, err)
+
+	_, err = newCursorSigner([]byte("another secret")).decode(token)
+	assert.Error(t, err)
+
+	_, err = signer.decode("not-a-cursor")
+	assert.Error(t, err)
+}
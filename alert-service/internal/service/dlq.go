@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	database "alert-service/database/sqlc"
+	"alert-service/internal/types"
+
+	"github.com/IBM/sarama"
+)
+
+// largest replay when no ids are given
+const maxReplay = 100
+
+// Republisher puts a dead letter back on the topic it came from
+type Republisher interface {
+	Republish(topic string, key []byte, value []byte) error
+}
+
+type kafkaRepublisher struct {
+	producer sarama.SyncProducer
+}
+
+func NewKafkaRepublisher(addr []string) (Republisher, error) {
+	config := sarama.NewConfig()
+	config.Producer.Retry.Max = 5
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Return.Successes = true
+
+	producer, err := sarama.NewSyncProducer(addr, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kafkaRepublisher{
+		producer: producer,
+	}, nil
+}
+
+func (k *kafkaRepublisher) Republish(topic string, key []byte, value []byte) error {
+	_, _, err := k.producer.SendMessage(&sarama.ProducerMessage{
+		Topic: topic,
+		Key:   sarama.ByteEncoder(key),
+		Value: sarama.ByteEncoder(value),
+	})
+	return err
+}
+
+func (a *admin) DeadLetters(ctx context.Context, req types.ListPageRequest) ([]database.DeadLetter, error) {
+	err := a.authorize(ctx, a.db, req.AdminID, auditListDeadLetters, "dead_letters", "")
+	if err != nil {
+		return nil, err
+	}
+
+	letters, err := a.db.ListDeadLetters(ctx, database.ListDeadLettersParams{
+		AfterID: req.Cursor,
+		MaxRows: req.Limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if letters == nil {
+		letters = []database.DeadLetter{}
+	}
+	return letters, nil
+}
+
+// ReplayDeadLetters publishes while holding the letters, a failure part way rolls back the marks so
+// the letters already published may be delivered twice, email-service handles them at least once
+// anyway
+func (a *admin) ReplayDeadLetters(ctx context.Context, req types.ReplayDeadLettersRequest) (types.ReplayResult, error) {
+	if a.republisher == nil {
+		return types.ReplayResult{}, types.ErrReplayUnavailable
+	}
+
+	res := types.ReplayResult{Replayed: []int64{}}
+	err := a.db.WithTx(ctx, func(tx database.Tx) error {
+		err := a.authorize(ctx, tx, req.AdminID, auditReplayDeadLetters, "dead_letters", fmt.Sprintf("ids %v", req.IDs))
+		if err != nil {
+			return err
+		}
+
+		ids := req.IDs
+		if ids == nil {
+			ids = []int64{}
+		}
+		letters, err := tx.GetDeadLettersForReplay(ctx, database.GetDeadLettersForReplayParams{
+			Ids:     ids,
+			MaxRows: maxReplay,
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, letter := range letters {
+			err := a.republisher.Republish(letter.Topic, letter.Key, letter.Value)
+			if err != nil {
+				return err
+			}
+
+			err = tx.MarkDeadLetterReplayed(ctx, letter.ID)
+			if err != nil {
+				return err
+			}
+			res.Replayed = append(res.Replayed, letter.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return types.ReplayResult{}, err
+	}
+
+	return res, nil
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	database "alert-service/database/sqlc"
+	"alert-service/internal/cache"
+	"alert-service/internal/types"
+)
+
+// upper bound of candles returned by a single read
+const maxCandles = 1000
+
+type Marketer interface {
+	// Read the last price of every pair as published by the watcher
+	Tickers(ctx context.Context) ([]types.Ticker, error)
+
+	// Read the last price of a single pair
+	Ticker(ctx context.Context, pair string) (types.Ticker, error)
+
+	// Read stored candles of a pair, from and to default to the last 24 hours
+	Candles(ctx context.Context, req types.ReadCandlesRequest) ([]database.Candle, error)
+
+	// Read the watcher health, degraded while alerts of some pairs are held back
+	Health(ctx context.Context) (types.WatcherHealth, error)
+}
+
+type market struct {
+	db    database.Querier
+	cache cache.Cacher
+}
+
+func NewMarketService(db database.Querier, cache cache.Cacher) Marketer {
+	return &market{
+		db:    db,
+		cache: cache,
+	}
+}
+
+// staleness is decided on read, a watcher that died stops refreshing what it published
+func (m *market) Tickers(ctx context.Context) ([]types.Ticker, error) {
+	tickers, err := m.cache.GetTickers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range tickers {
+		tickers[i].Stale = tickers[i].Stale || time.Since(tickers[i].UpdatedAt) > types.MaxTickerAge
+	}
+	return tickers, nil
+}
+
+func (m *market) Ticker(ctx context.Context, pair string) (types.Ticker, error) {
+	curr, ok := types.ParsePair(pair)
+	if !ok {
+		return types.Ticker{}, types.ErrMarketNotFound
+	}
+
+	ticker, err := m.cache.GetTicker(ctx, types.PairName(curr))
+	if err != nil {
+		return types.Ticker{}, err
+	}
+
+	ticker.Stale = ticker.Stale || time.Since(ticker.UpdatedAt) > types.MaxTickerAge
+	return ticker, nil
+}
+
+func (m *market) Candles(ctx context.Context, req types.ReadCandlesRequest) ([]database.Candle, error) {
+	pair, ok := types.ParsePair(req.Pair)
+	if !ok {
+		return nil, types.ErrMarketNotFound
+	}
+
+	if req.To.IsZero() {
+		req.To = time.Now()
+	}
+	if req.From.IsZero() {
+		req.From = req.To.Add(-24 * time.Hour)
+	}
+	if !req.From.Before(req.To) {
+		return nil, types.NewErrValidation(errors.New("from must be before to"))
+	}
+
+	params := database.GetCandlesParams{
+		Pair:     types.PairName(pair),
+		Interval: req.Interval,
+		FromTime: req.From,
+		ToTime:   req.To,
+		MaxRows:  maxCandles,
+	}
+	res, err := m.db.GetCandles(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	// keep the response an array even when there is no history yet
+	if res == nil {
+		res = []database.Candle{}
+	}
+	return res, nil
+}
+
+// Health merges the reports of every live watcher instance, a pair nobody holds the lease of is
+// not watched at all
+func (m *market) Health(ctx context.Context) (types.WatcherHealth, error) {
+	reports, err := m.cache.GetHealth(ctx)
+	if err != nil {
+		return types.WatcherHealth{}, err
+	}
+
+	pairs := types.PairNames(types.SupportedCurrencies)
+	owners, err := m.cache.LeaseOwners(ctx, pairs)
+	if err != nil {
+		return types.WatcherHealth{}, err
+	}
+
+	health := types.WatcherHealth{
+		Status:    types.HealthOK,
+		CheckedAt: time.Now(),
+		Paused:    []types.PausedPair{},
+		Owners:    owners,
+	}
+	if len(reports) == 0 {
+		health.Status = types.HealthUnknown
+		return health, nil
+	}
+
+	for _, report := range reports {
+		if report.Status != types.HealthOK {
+			health.Status = types.HealthDegraded
+		}
+		health.Paused = append(health.Paused, report.Paused...)
+	}
+	for _, pair := range pairs {
+		if owners[pair] == "" {
+			health.Status = types.HealthDegraded
+			health.Paused = append(health.Paused, types.PausedPair{
+				Pair:   pair,
+				Reason: "no watcher owns the pair",
+			})
+		}
+	}
+	types.SortPaused(health.Paused)
+
+	return health, nil
+}
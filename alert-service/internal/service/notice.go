@@ -0,0 +1,70 @@
+package service
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"alert-service/internal/logger"
+	"alert-service/internal/types"
+
+	"github.com/IBM/sarama"
+)
+
+// Notifier hands security notices to email-service
+type Notifier interface {
+	Notify(notice types.SecurityNotice) error
+}
+
+type kafkaNotifier struct {
+	producer sarama.SyncProducer
+	topic    string
+}
+
+func NewKafkaNotifier(addr []string, topic string) (Notifier, error) {
+	config := sarama.NewConfig()
+	config.Producer.Retry.Max = 5
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Return.Successes = true
+
+	producer, err := sarama.NewSyncProducer(addr, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kafkaNotifier{
+		producer: producer,
+		topic:    topic,
+	}, nil
+}
+
+// notices of a user are keyed by the user so they stay in order
+func (k *kafkaNotifier) Notify(notice types.SecurityNotice) error {
+	b, err := json.Marshal(notice)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = k.producer.SendMessage(&sarama.ProducerMessage{
+		Topic: k.topic,
+		Key:   sarama.StringEncoder(strconv.FormatInt(notice.UserID, 10)),
+		Value: sarama.ByteEncoder(b),
+	})
+	return err
+}
+
+// logNotifier stands in when no kafka is configured, notices are only logged
+type logNotifier struct{}
+
+func NewLogNotifier() Notifier {
+	return logNotifier{}
+}
+
+func (logNotifier) Notify(notice types.SecurityNotice) error {
+	logger.Info().
+		Int64("user_id", notice.UserID).
+		Str("kind", notice.Kind).
+		Str("ip", notice.IP).
+		Str("msg", "security notice").
+		Send()
+	return nil
+}
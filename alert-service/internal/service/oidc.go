@@ -0,0 +1,309 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	database "alert-service/database/sqlc"
+	"alert-service/internal/logger"
+	"alert-service/internal/types"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/oauth2"
+)
+
+// OIDCConfig sets up single sign-on with an OpenID Connect provider, it is off without an issuer
+type OIDCConfig struct {
+	// the provider is set up from the discovery document under this url
+	Issuer       string `env:"OIDC_ISSUER"`
+	ClientID     string `env:"OIDC_CLIENT_ID"`
+	ClientSecret string `env:"OIDC_CLIENT_SECRET" secret:"true"`
+	// where the provider sends the user back to, the /v1/auth/oidc/callback route of this api
+	RedirectURL string `env:"OIDC_REDIRECT_URL"`
+	// asked for besides openid, accounts are linked by their email
+	Scopes []string `env:"OIDC_SCOPES" default:"email,profile"`
+	// how long a user has to log in at the provider
+	LoginTimeout time.Duration `env:"OIDC_LOGIN_TIMEOUT" default:"10m"`
+}
+
+func (c *OIDCConfig) Validate() error {
+	if c.Issuer == "" {
+		return nil
+	}
+
+	for _, u := range []struct {
+		env string
+		raw string
+	}{
+		{"OIDC_ISSUER", c.Issuer},
+		{"OIDC_REDIRECT_URL", c.RedirectURL},
+	} {
+		parsed, err := url.Parse(u.raw)
+		if err != nil || parsed.Host == "" || (parsed.Scheme != "https" && parsed.Scheme != "http") {
+			return fmt.Errorf("invalid %s %q", u.env, u.raw)
+		}
+	}
+	switch {
+	case c.ClientID == "":
+		return errors.New("OIDC_CLIENT_ID is required with OIDC_ISSUER")
+	case c.LoginTimeout <= 0:
+		return fmt.Errorf("invalid OIDC_LOGIN_TIMEOUT %s", c.LoginTimeout)
+	}
+	return nil
+}
+
+// oidcState is kept from the start of a login until the provider sends the user back
+type oidcState struct {
+	State string `json:"state"`
+	// the PKCE verifier, only its hash goes to the provider with the user
+	Verifier string `json:"verifier"`
+	// the provider puts it in the id token, a token of another login does not pass
+	Nonce string `json:"nonce"`
+	// the logged in user that links the identity, zero for a login
+	UserID int64 `json:"user_id,omitempty"`
+}
+
+// oidcClaims are what the provider says about the user
+type oidcClaims struct {
+	Issuer        string `json:"iss"`
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+// oidcClient talks to the provider, its discovery document is fetched by the first login so the api
+// starts while the provider is down
+type oidcClient struct {
+	cfg    OIDCConfig
+	client *http.Client
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+func newOIDCClient(cfg OIDCConfig) *oidcClient {
+	if cfg.Issuer == "" {
+		return nil
+	}
+	return &oidcClient{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// discover fetches the discovery document once, a failure is tried again by the next login. Keys of
+// the provider are fetched when a token names one not seen yet.
+func (c *oidcClient) discover() (*oidc.Provider, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.provider != nil {
+		return c.provider, nil
+	}
+	provider, err := oidc.NewProvider(oidc.ClientContext(context.Background(), c.client), c.cfg.Issuer)
+	if err != nil {
+		return nil, err
+	}
+	c.provider = provider
+	return provider, nil
+}
+
+func (c *oidcClient) oauthConfig(provider *oidc.Provider) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     c.cfg.ClientID,
+		ClientSecret: c.cfg.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  c.cfg.RedirectURL,
+		Scopes:       append([]string{oidc.ScopeOpenID}, c.cfg.Scopes...),
+	}
+}
+
+// authCodeURL is where the user logs in with the authorization code flow
+func (c *oidcClient) authCodeURL(state oidcState) (string, error) {
+	provider, err := c.discover()
+	if err != nil {
+		return "", err
+	}
+	return c.oauthConfig(provider).AuthCodeURL(state.State, oauth2.S256ChallengeOption(state.Verifier), oidc.Nonce(state.Nonce)), nil
+}
+
+// exchange trades the code for an id token and checks it came from the provider for this login
+func (c *oidcClient) exchange(ctx context.Context, code string, state oidcState) (oidcClaims, error) {
+	provider, err := c.discover()
+	if err != nil {
+		return oidcClaims{}, err
+	}
+
+	ctx = oidc.ClientContext(ctx, c.client)
+	token, err := c.oauthConfig(provider).Exchange(ctx, code, oauth2.VerifierOption(state.Verifier))
+	if err != nil {
+		return oidcClaims{}, err
+	}
+	raw, ok := token.Extra("id_token").(string)
+	if !ok {
+		return oidcClaims{}, errors.New("no id token in the token response")
+	}
+
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: c.cfg.ClientID}).Verify(ctx, raw)
+	if err != nil {
+		return oidcClaims{}, err
+	}
+	if idToken.Nonce != state.Nonce {
+		return oidcClaims{}, errors.New("id token nonce does not match")
+	}
+
+	var claims oidcClaims
+	err = idToken.Claims(&claims)
+	if err != nil {
+		return oidcClaims{}, err
+	}
+	return claims, nil
+}
+
+func newOIDCState() (oidcState, error) {
+	state, nonce := make([]byte, 32), make([]byte, 32)
+	for _, b := range [][]byte{state, nonce} {
+		_, err := rand.Read(b)
+		if err != nil {
+			return oidcState{}, err
+		}
+	}
+	return oidcState{
+		State:    base64.RawURLEncoding.EncodeToString(state),
+		Verifier: oauth2.GenerateVerifier(),
+		Nonce:    base64.RawURLEncoding.EncodeToString(nonce),
+	}, nil
+}
+
+func (a *auther) StartOIDC(ctx context.Context) (types.OIDCStart, error) {
+	return a.startOIDC(ctx, 0)
+}
+
+// LinkOIDC is how an account with a password gets single sign-on, its owner proved it by logging in
+func (a *auther) LinkOIDC(ctx context.Context, userID int64) (types.OIDCStart, error) {
+	return a.startOIDC(ctx, userID)
+}
+
+func (a *auther) startOIDC(ctx context.Context, userID int64) (types.OIDCStart, error) {
+	if a.oidc == nil {
+		return types.OIDCStart{}, types.ErrOIDCUnavailable
+	}
+
+	state, err := newOIDCState()
+	if err != nil {
+		return types.OIDCStart{}, err
+	}
+	state.UserID = userID
+	authURL, err := a.oidc.authCodeURL(state)
+	if err != nil {
+		return types.OIDCStart{}, err
+	}
+
+	err = a.cache.PutOnce(ctx, oidcStateKey(state.State), state, a.oidc.cfg.LoginTimeout)
+	if err != nil {
+		return types.OIDCStart{}, err
+	}
+
+	return types.OIDCStart{
+		URL:       authURL,
+		State:     state.State,
+		ExpiresAt: time.Now().Add(a.oidc.cfg.LoginTimeout),
+	}, nil
+}
+
+// FinishOIDC logs the user in like a password would, users with two-factor authentication still get
+// only an mfa token
+func (a *auther) FinishOIDC(ctx context.Context, req types.OIDCCallbackRequest) (types.LoginUserResponse, error) {
+	if a.oidc == nil {
+		return types.LoginUserResponse{}, types.ErrOIDCUnavailable
+	}
+
+	var state oidcState
+	ok, err := a.cache.TakeOnce(ctx, oidcStateKey(req.State), &state)
+	if err != nil {
+		return types.LoginUserResponse{}, err
+	}
+	if !ok {
+		return types.LoginUserResponse{}, types.ErrInvalidOIDCState
+	}
+
+	claims, err := a.oidc.exchange(ctx, req.Code, state)
+	if err != nil {
+		logger.Error().Str("err", err.Error()).Str("msg", "oidc exchange").Send()
+		return types.LoginUserResponse{}, types.ErrOIDCLoginFailed
+	}
+
+	user, err := a.oidcUser(ctx, claims, state.UserID)
+	if err != nil {
+		return types.LoginUserResponse{}, err
+	}
+
+	return a.firstFactorPassed(ctx, user, req.IP, req.UserAgent)
+}
+
+// oidcUser finds the user an identity is linked to. An identity seen the first time is linked to the
+// user linkUserID that started the login, otherwise to the user with its email, or to a new user without
+// a password. Emails only count when the provider verified them since anyone could claim any address
+// otherwise. Signing up does not verify them either, so an account with a password is never linked by
+// its email: whoever signed up with someone else's address would share their account once they used
+// single sign-on. Its owner logs in with the password and links the identity instead.
+func (a *auther) oidcUser(ctx context.Context, claims oidcClaims, linkUserID int64) (database.User, error) {
+	var user database.User
+	err := a.db.WithTx(ctx, func(tx database.Tx) error {
+		identity, err := tx.GetOidcIdentity(ctx, database.GetOidcIdentityParams{
+			Issuer:  claims.Issuer,
+			Subject: claims.Subject,
+		})
+		if err == nil {
+			if linkUserID != 0 && identity.UserID != linkUserID {
+				return types.ErrOIDCIdentityLinked
+			}
+			user, err = tx.GetUserById(ctx, identity.UserID)
+			return err
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+
+		email := normalizeEmail(claims.Email)
+		if linkUserID != 0 {
+			user, err = tx.GetUserById(ctx, linkUserID)
+		} else {
+			if email == "" || !claims.EmailVerified {
+				return types.ErrOIDCEmailUnverified
+			}
+			user, err = tx.GetUserByEmail(ctx, email)
+			if err == nil && user.HashedPassword != "" {
+				return types.ErrOIDCLinkRequired
+			}
+			if errors.Is(err, pgx.ErrNoRows) {
+				// an empty hash matches no password, the user can only sign in through the provider
+				user, err = tx.CreateUser(ctx, database.CreateUserParams{Email: email})
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.CreateOidcIdentity(ctx, database.CreateOidcIdentityParams{
+			UserID:  user.ID,
+			Issuer:  claims.Issuer,
+			Subject: claims.Subject,
+			Email:   email,
+		})
+		return err
+	})
+	return user, err
+}
+
+func oidcStateKey(state string) string {
+	return "oidc:state:" + state
+}
@@ -0,0 +1,254 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	database "alert-service/database/sqlc"
+	"alert-service/internal/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockProvider is an OpenID Connect provider that logs in whoever is sent to it
+type mockProvider struct {
+	*httptest.Server
+	key       *rsa.PrivateKey
+	challenge string
+	nonce     string
+	// who logs in
+	subject       string
+	email         string
+	emailVerified bool
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	p := &mockProvider{key: key, subject: "user-1", email: "user@example.com", emailVerified: true}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                p.URL,
+			"authorization_endpoint":                p.URL + "/authorize",
+			"token_endpoint":                        p.URL + "/token",
+			"jwks_uri":                              p.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if r.FormValue("code") != "code" || base64.RawURLEncoding.EncodeToString(sum[:]) != p.challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   60,
+			"id_token":     p.idToken(),
+		})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+// authorize is the user logging in at the provider
+func (p *mockProvider) authorize(t *testing.T, authURL string) {
+	u, err := url.Parse(authURL)
+	require.NoError(t, err)
+	assert.Equal(t, "S256", u.Query().Get("code_challenge_method"))
+	p.challenge = u.Query().Get("code_challenge")
+	p.nonce = u.Query().Get("nonce")
+}
+
+func (p *mockProvider) idToken() string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]any{
+		"iss":            p.URL,
+		"sub":            p.subject,
+		"aud":            "alerts",
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Minute).Unix(),
+		"nonce":          p.nonce,
+		"email":          p.email,
+		"email_verified": p.emailVerified,
+	})
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(signed))
+	sig, _ := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, sum[:])
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestOIDCClient(t *testing.T) {
+	provider := newMockProvider(t)
+	client := newOIDCClient(OIDCConfig{
+		Issuer:      provider.URL,
+		ClientID:    "alerts",
+		RedirectURL: "http://localhost:3000/v1/auth/oidc/callback",
+		Scopes:      []string{"email"},
+	})
+
+	state, err := newOIDCState()
+	require.NoError(t, err)
+	authURL, err := client.authCodeURL(state)
+	require.NoError(t, err)
+	provider.authorize(t, authURL)
+
+	claims, err := client.exchange(context.Background(), "code", state)
+	require.NoError(t, err)
+	assert.Equal(t, oidcClaims{
+		Issuer:        provider.URL,
+		Subject:       "user-1",
+		Email:         "user@example.com",
+		EmailVerified: true,
+	}, claims)
+
+	// the code is only good with the verifier of the login that asked for it
+	other, err := newOIDCState()
+	require.NoError(t, err)
+	_, err = client.exchange(context.Background(), "code", other)
+	assert.Error(t, err)
+
+	// nor is an id token of another login
+	mixed := state
+	mixed.Nonce = other.Nonce
+	_, err = client.exchange(context.Background(), "code", mixed)
+	assert.Error(t, err)
+}
+
+func TestOIDCUser(t *testing.T) {
+	store := &memStore{}
+	a := &auther{db: store}
+	ctx := context.Background()
+	existing, err := store.CreateUser(ctx, database.CreateUserParams{Email: "user@example.com", HashedPassword: "hash"})
+	require.NoError(t, err)
+
+	// anyone can claim an address the provider did not verify
+	_, err = a.oidcUser(ctx, oidcClaims{Issuer: "idp", Subject: "1", Email: "user@example.com"}, 0)
+	assert.ErrorIs(t, err, types.ErrOIDCEmailUnverified)
+	_, err = a.oidcUser(ctx, oidcClaims{Issuer: "idp", Subject: "1", EmailVerified: true}, 0)
+	assert.ErrorIs(t, err, types.ErrOIDCEmailUnverified)
+
+	// nor does signing up verify it, an account with a password is not linked by its email
+	_, err = a.oidcUser(ctx, oidcClaims{Issuer: "idp", Subject: "1", Email: " User@Example.COM", EmailVerified: true}, 0)
+	assert.ErrorIs(t, err, types.ErrOIDCLinkRequired)
+	assert.Empty(t, store.identities)
+
+	// its owner links it after logging in, whatever email the provider has
+	user, err := a.oidcUser(ctx, oidcClaims{Issuer: "idp", Subject: "1", Email: "Owner@Example.com"}, existing.ID)
+	require.NoError(t, err)
+	assert.Equal(t, existing.ID, user.ID)
+	require.Len(t, store.identities, 1)
+	assert.Equal(t, "owner@example.com", store.identities[0].Email)
+
+	// once linked the identity finds its user, even after the email changed at the provider
+	user, err = a.oidcUser(ctx, oidcClaims{Issuer: "idp", Subject: "1", Email: "new@example.com"}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, existing.ID, user.ID)
+
+	// subjects are only unique per issuer, an unknown email gets an account without a password
+	user, err = a.oidcUser(ctx, oidcClaims{Issuer: "other", Subject: "1", Email: "New@Example.com", EmailVerified: true}, 0)
+	require.NoError(t, err)
+	assert.NotEqual(t, existing.ID, user.ID)
+	assert.Equal(t, "new@example.com", user.Email)
+	assert.Empty(t, user.HashedPassword)
+	assert.Len(t, store.users, 2)
+	assert.Len(t, store.identities, 2)
+
+	// which is linked by its email since nobody could have signed up with a password for it
+	linked, err := a.oidcUser(ctx, oidcClaims{Issuer: "third", Subject: "1", Email: "new@example.com", EmailVerified: true}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, linked.ID)
+
+	// an identity stays with the user it is linked to
+	_, err = a.oidcUser(ctx, oidcClaims{Issuer: "other", Subject: "1"}, existing.ID)
+	assert.ErrorIs(t, err, types.ErrOIDCIdentityLinked)
+	assert.Len(t, store.identities, 3)
+}
+
+func TestFinishOIDC(t *testing.T) {
+	provider := newMockProvider(t)
+	provider.email = "User@Example.com"
+	store := &memStore{}
+	ctx := context.Background()
+	existing, err := store.CreateUser(ctx, database.CreateUserParams{Email: "user@example.com", HashedPassword: "hash"})
+	require.NoError(t, err)
+
+	maker, err := NewPasetoMaker("01234567890123456789012345678901")
+	require.NoError(t, err)
+	a := NewAuthSvc(store, &memCache{}, nil, maker, time.Minute, LoginConfig{}, TOTPConfig{}, OIDCConfig{
+		Issuer:       provider.URL,
+		ClientID:     "alerts",
+		RedirectURL:  "http://localhost:3000/v1/auth/oidc/callback",
+		Scopes:       []string{"email"},
+		LoginTimeout: time.Minute,
+	}, make([]byte, 32))
+
+	login := func() (types.OIDCCallbackRequest, types.LoginUserResponse, error) {
+		start, err := a.StartOIDC(ctx)
+		require.NoError(t, err)
+		provider.authorize(t, start.URL)
+
+		req := types.OIDCCallbackRequest{Code: "code", State: start.State, IP: "192.0.2.1", UserAgent: "test"}
+		resp, err := a.FinishOIDC(ctx, req)
+		return req, resp, err
+	}
+
+	// the account has a password, only its owner links it
+	_, _, err = login()
+	assert.ErrorIs(t, err, types.ErrOIDCLinkRequired)
+	assert.Empty(t, store.identities)
+
+	start, err := a.LinkOIDC(ctx, existing.ID)
+	require.NoError(t, err)
+	provider.authorize(t, start.URL)
+	resp, err := a.FinishOIDC(ctx, types.OIDCCallbackRequest{Code: "code", State: start.State, IP: "192.0.2.1", UserAgent: "test"})
+	require.NoError(t, err)
+	assert.Equal(t, existing.ID, resp.User.UserID)
+	require.Len(t, store.identities, 1)
+
+	req, resp, err := login()
+	require.NoError(t, err)
+	assert.Equal(t, existing.ID, resp.User.UserID)
+	payload, err := maker.Verify(resp.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, existing.ID, payload.UserID)
+
+	// the state of a login is used up by it
+	_, err = a.FinishOIDC(ctx, req)
+	assert.ErrorIs(t, err, types.ErrInvalidOIDCState)
+
+	// another account at the provider claiming the address without verifying it is not let in
+	provider.subject = "user-2"
+	provider.emailVerified = false
+	_, _, err = login()
+	assert.ErrorIs(t, err, types.ErrOIDCEmailUnverified)
+	assert.Len(t, store.users, 1)
+	assert.Len(t, store.identities, 1)
+}
@@ -0,0 +1,316 @@
+package service
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"alert-service/internal/types"
+)
+
+// token formats of TOKEN_FORMAT
+const (
+	TokenFormatLocal  = "v2.local"
+	TokenFormatPublic = "v4.public"
+)
+
+const v4PublicHeader = "v4.public."
+
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+var (
+	errMalformedToken = errors.New("token is malformed")
+	errUnknownKey     = errors.New("token is signed with an unknown key")
+	errBadSignature   = errors.New("token signature does not match")
+)
+
+// TokenConfig picks how access tokens are made. v2.local tokens are sealed with TOKEN_SYMMETRIC_KEY
+// so only holders of that key can check them, v4.public tokens are signed with a ring of ed25519
+// keys whose public halves anyone can fetch from /.well-known/jwks.json.
+type TokenConfig struct {
+	Format string `env:"TOKEN_FORMAT" default:"v2.local"`
+	// ed25519 keys as "<kid>=<base64url seed of 32 bytes>@<RFC 3339 time it starts signing>", the
+	// time is optional for the first key. The key that started last signs, keys that start later are
+	// already published so verifiers have them by then.
+	SigningKeys []string `env:"TOKEN_SIGNING_KEYS" secret:"true"`
+	// how long tokens of a key are still accepted after the next one starts signing, at least
+	// TOKEN_DURATION so none is cut short. Keys past it are no longer published.
+	RotationOverlap time.Duration `env:"TOKEN_ROTATION_OVERLAP" default:"1h"`
+
+	ring *KeyRing
+}
+
+func (c *TokenConfig) Validate() error {
+	switch c.Format {
+	case TokenFormatLocal:
+		return nil
+	case TokenFormatPublic:
+	default:
+		return fmt.Errorf("invalid TOKEN_FORMAT %q", c.Format)
+	}
+
+	if c.RotationOverlap <= 0 {
+		return fmt.Errorf("invalid TOKEN_ROTATION_OVERLAP %s", c.RotationOverlap)
+	}
+	var err error
+	c.ring, err = NewKeyRing(c.SigningKeys, c.RotationOverlap, time.Now())
+	if err != nil {
+		return fmt.Errorf("TOKEN_SIGNING_KEYS: %w", err)
+	}
+	return nil
+}
+
+// NewTokenMaker makes the maker of the configured format. The public maker still accepts v2.local
+// tokens sealed with symmetricKey, those issued before a switch of formats stay valid until they
+// expire.
+func NewTokenMaker(cfg TokenConfig, symmetricKey string) (Maker, error) {
+	local, err := NewPasetoMaker(symmetricKey)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Format != TokenFormatPublic {
+		return local, nil
+	}
+	if cfg.ring == nil {
+		return nil, errors.New("token key ring is not configured")
+	}
+	return NewPublicMaker(cfg.ring, local), nil
+}
+
+// signingKey is a key of the ring, it signs from activeFrom until the next key starts
+type signingKey struct {
+	id         string
+	private    ed25519.PrivateKey
+	public     ed25519.PublicKey
+	activeFrom time.Time
+}
+
+// KeyRing holds the keys v4.public tokens are signed with, in the order they start signing
+type KeyRing struct {
+	keys    []signingKey
+	overlap time.Duration
+}
+
+// NewKeyRing parses the entries of TOKEN_SIGNING_KEYS, some key has to be signing at now
+func NewKeyRing(entries []string, overlap time.Duration, now time.Time) (*KeyRing, error) {
+	ring := &KeyRing{overlap: overlap}
+	for _, entry := range entries {
+		id, rest, ok := strings.Cut(entry, "=")
+		if !ok || !keyIDPattern.MatchString(id) {
+			return nil, fmt.Errorf("invalid key id in %q", id)
+		}
+
+		encoded, start, _ := strings.Cut(rest, "@")
+		seed, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("key %s is not a base64url seed of %d bytes", id, ed25519.SeedSize)
+		}
+
+		var activeFrom time.Time
+		if start != "" {
+			activeFrom, err = time.Parse(time.RFC3339, start)
+			if err != nil {
+				return nil, fmt.Errorf("key %s has an invalid start %q", id, start)
+			}
+		}
+
+		if slices.ContainsFunc(ring.keys, func(k signingKey) bool { return k.id == id }) {
+			return nil, fmt.Errorf("key %s is listed twice", id)
+		}
+		private := ed25519.NewKeyFromSeed(seed)
+		ring.keys = append(ring.keys, signingKey{
+			id:         id,
+			private:    private,
+			public:     private.Public().(ed25519.PublicKey),
+			activeFrom: activeFrom,
+		})
+	}
+
+	slices.SortStableFunc(ring.keys, func(a, b signingKey) int {
+		return a.activeFrom.Compare(b.activeFrom)
+	})
+	if len(ring.keys) == 0 || ring.keys[0].activeFrom.After(now) {
+		return nil, errors.New("no key is signing yet")
+	}
+	return ring, nil
+}
+
+// signer is the key that started last
+func (r *KeyRing) signer(now time.Time) signingKey {
+	i := 0
+	for i+1 < len(r.keys) && !r.keys[i+1].activeFrom.After(now) {
+		i++
+	}
+	return r.keys[i]
+}
+
+// retired reports whether the overlap of the key at i has run out
+func (r *KeyRing) retired(i int, now time.Time) bool {
+	return i+1 < len(r.keys) && !r.keys[i+1].activeFrom.Add(r.overlap).After(now)
+}
+
+// verifier finds the public key of id, keys that did not start yet are accepted for instances whose
+// clocks are ahead
+func (r *KeyRing) verifier(id string, now time.Time) (ed25519.PublicKey, bool) {
+	for i, key := range r.keys {
+		if key.id == id {
+			return key.public, !r.retired(i, now)
+		}
+	}
+	return nil, false
+}
+
+// published lists the keys tokens may be verified with at now
+func (r *KeyRing) published(now time.Time) []types.PublicKey {
+	keys := []types.PublicKey{}
+	for i, key := range r.keys {
+		if r.retired(i, now) {
+			continue
+		}
+		keys = append(keys, types.PublicKey{
+			KeyID:     key.id,
+			KeyType:   "OKP",
+			Curve:     "Ed25519",
+			X:         base64.RawURLEncoding.EncodeToString(key.public),
+			Algorithm: "EdDSA",
+			Use:       "sig",
+		})
+	}
+	return keys
+}
+
+// keyFooter is the footer of v4.public tokens, it names the key that signed them
+type keyFooter struct {
+	KeyID string `json:"kid"`
+}
+
+// publicMaker signs v4.public tokens with the current key of its ring
+type publicMaker struct {
+	ring *KeyRing
+	// verifies tokens of other formats, may be nil
+	legacy Maker
+}
+
+// NewPublicMaker creates a maker of v4.public tokens, legacy verifies tokens that are not v4.public
+// and may be nil
+func NewPublicMaker(ring *KeyRing, legacy Maker) Maker {
+	return &publicMaker{
+		ring:   ring,
+		legacy: legacy,
+	}
+}
+
+func (maker *publicMaker) Create(userID int64, duration time.Duration, claims Claims) (string, *Payload, error) {
+	payload, err := NewPayload(userID, duration, claims)
+	if err != nil {
+		return "", payload, err
+	}
+
+	message, err := json.Marshal(payload)
+	if err != nil {
+		return "", payload, err
+	}
+
+	key := maker.ring.signer(time.Now())
+	footer, err := json.Marshal(keyFooter{KeyID: key.id})
+	if err != nil {
+		return "", payload, err
+	}
+	return signV4Public(key.private, message, footer), payload, nil
+}
+
+func (maker *publicMaker) Verify(token string) (*Payload, error) {
+	if !strings.HasPrefix(token, v4PublicHeader) {
+		if maker.legacy != nil {
+			return maker.legacy.Verify(token)
+		}
+		return nil, types.ErrInvalidToken
+	}
+
+	message, err := openV4Public(token, func(footer []byte) (ed25519.PublicKey, bool) {
+		var f keyFooter
+		if json.Unmarshal(footer, &f) != nil {
+			return nil, false
+		}
+		return maker.ring.verifier(f.KeyID, time.Now())
+	})
+	if err != nil {
+		return nil, types.ErrInvalidToken
+	}
+
+	payload := &Payload{}
+	err = json.Unmarshal(message, payload)
+	if err != nil {
+		return nil, types.ErrInvalidToken
+	}
+
+	err = payload.Valid()
+	if err != nil {
+		return nil, err
+	}
+
+	return payload, nil
+}
+
+func (maker *publicMaker) PublicKeys() []types.PublicKey {
+	return maker.ring.published(time.Now())
+}
+
+// signV4Public signs message as a PASETO v4.public token without an implicit assertion
+func signV4Public(key ed25519.PrivateKey, message []byte, footer []byte) string {
+	sig := ed25519.Sign(key, pae([]byte(v4PublicHeader), message, footer, nil))
+
+	token := v4PublicHeader + base64.RawURLEncoding.EncodeToString(append(slices.Clip(message), sig...))
+	if len(footer) > 0 {
+		token += "." + base64.RawURLEncoding.EncodeToString(footer)
+	}
+	return token
+}
+
+// openV4Public checks the signature of a v4.public token with the key its footer picks and returns
+// the message
+func openV4Public(token string, keyFor func(footer []byte) (ed25519.PublicKey, bool)) ([]byte, error) {
+	body, encodedFooter, _ := strings.Cut(strings.TrimPrefix(token, v4PublicHeader), ".")
+	if strings.Contains(encodedFooter, ".") {
+		return nil, errMalformedToken
+	}
+
+	signed, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil || len(signed) < ed25519.SignatureSize {
+		return nil, errMalformedToken
+	}
+	footer, err := base64.RawURLEncoding.DecodeString(encodedFooter)
+	if err != nil {
+		return nil, errMalformedToken
+	}
+
+	key, ok := keyFor(footer)
+	if !ok {
+		return nil, errUnknownKey
+	}
+
+	message := signed[:len(signed)-ed25519.SignatureSize]
+	sig := signed[len(signed)-ed25519.SignatureSize:]
+	if !ed25519.Verify(key, pae([]byte(v4PublicHeader), message, footer, nil), sig) {
+		return nil, errBadSignature
+	}
+	return message, nil
+}
+
+// pae is the pre-authentication encoding of PASETO, the count and then every piece with its length,
+// lengths as little endian 64 bit numbers with the top bit cleared
+func pae(pieces ...[]byte) []byte {
+	buf := binary.LittleEndian.AppendUint64(nil, uint64(len(pieces))&(1<<63-1))
+	for _, piece := range pieces {
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(len(piece))&(1<<63-1))
+		buf = append(buf, piece...)
+	}
+	return buf
+}
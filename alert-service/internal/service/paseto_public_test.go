@@ -0,0 +1,92 @@
+package service
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"alert-service/internal/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// test vector 4-S-2 of the PASETO specification
+func TestV4PublicVector(t *testing.T) {
+	seed, _ := hex.DecodeString("b4cbfb43df4ce210727d953e4a713307fa19bb7d9f85041438d9e11b942a3774")
+	key := ed25519.NewKeyFromSeed(seed)
+	message := []byte(`{"data":"this is a signed message","exp":"2022-01-01T00:00:00+00:00"}`)
+	footer := []byte(`{"kid":"zVhMiPBP9fRf2snEcT7gFTioeA9COcNy9DfgL1W60haN"}`)
+
+	token := signV4Public(key, message, footer)
+	assert.Equal(t, "v4.public.eyJkYXRhIjoidGhpcyBpcyBhIHNpZ25lZCBtZXNzYWdlIiwiZXhwIjoiMjAyMi0wMS0wMVQwMDowMDowMCswMDowMCJ9v3Jt8mx_TdM2ceTGoqwrh4yDFn0XsHvvV_D0DtwQxVrJEBMl0F2caAdgnpKlt4p7xBnx1HcO-SPo8FPp214HDw.eyJraWQiOiJ6VmhNaVBCUDlmUmYyc25FY1Q3Z0ZUaW9lQTlDT2NOeTlEZmdMMVc2MGhhTiJ9", token)
+
+	got, err := openV4Public(token, func([]byte) (ed25519.PublicKey, bool) { return key.Public().(ed25519.PublicKey), true })
+	require.NoError(t, err)
+	assert.Equal(t, message, got)
+}
+
+func TestKeyRingRotation(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	seed := "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8"
+	ring, err := NewKeyRing([]string{
+		"new=" + seed + "@2026-01-02T00:00:00Z",
+		"old=AQECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8",
+	}, time.Hour, start)
+	require.NoError(t, err)
+
+	// the next key is published a day before it signs
+	assert.Equal(t, "old", ring.signer(start).id)
+	assert.Len(t, ring.published(start), 2)
+
+	rotated := start.Add(24 * time.Hour)
+	assert.Equal(t, "new", ring.signer(rotated).id)
+	_, ok := ring.verifier("old", rotated.Add(59*time.Minute))
+	assert.True(t, ok)
+
+	// the old key is dropped once its overlap ran out
+	_, ok = ring.verifier("old", rotated.Add(time.Hour))
+	assert.False(t, ok)
+	assert.Equal(t, []string{"new"}, keyIDs(ring.published(rotated.Add(time.Hour))))
+
+	_, err = NewKeyRing([]string{"only=" + seed + "@2026-01-02T00:00:00Z"}, time.Hour, start)
+	assert.Error(t, err)
+}
+
+func TestPublicMaker(t *testing.T) {
+	ring, err := NewKeyRing([]string{"k1=AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8"}, time.Hour, time.Now())
+	require.NoError(t, err)
+	local, err := NewPasetoMaker("12345678901234567890123456789012")
+	require.NoError(t, err)
+	maker := NewPublicMaker(ring, local)
+
+	token, _, err := maker.Create(7, time.Minute, Claims{Role: types.RoleAdmin})
+	require.NoError(t, err)
+	payload, err := maker.Verify(token)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), payload.UserID)
+	assert.Equal(t, types.RoleAdmin, payload.Role)
+
+	_, err = maker.Verify(token[:len(token)-60] + "A" + token[len(token)-59:])
+	assert.ErrorIs(t, err, types.ErrInvalidToken)
+
+	// tokens sealed before the switch still pass
+	sealed, _, err := local.Create(7, time.Minute, Claims{})
+	require.NoError(t, err)
+	_, err = maker.Verify(sealed)
+	assert.NoError(t, err)
+
+	expired, _, err := maker.Create(7, -time.Minute, Claims{})
+	require.NoError(t, err)
+	_, err = maker.Verify(expired)
+	assert.ErrorIs(t, err, types.ErrTokenExpired)
+}
+
+func keyIDs(keys []types.PublicKey) []string {
+	ids := make([]string, len(keys))
+	for i, key := range keys {
+		ids[i] = key.KeyID
+	}
+	return ids
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"slices"
+	"time"
+
+	"alert-service/internal/types"
+
+	"github.com/aead/chacha20poly1305"
+	"github.com/google/uuid"
+	"github.com/o1egl/paseto"
+)
+
+// Different types of error returned by the Verify function
+
+// scopes routes ask callers for
+const (
+	// the token handed out between the password and the second factor of a login
+	ScopeMFA = "mfa"
+	// managing the account itself, only a full login may
+	ScopeAccount = "account"
+	// the admin routes, a full login of an admin
+	ScopeAdmin = "admin"
+	// api keys are given some of these
+	ScopeAlertsRead  = "alerts:read"
+	ScopeAlertsWrite = "alerts:write"
+)
+
+// Claims are what a token says about its user beyond who they are
+type Claims struct {
+	// a token with a scope only opens the routes of that scope
+	Scope string `json:"scope,omitempty"`
+	// the user has two-factor authentication, MFAVerifiedAt is when they last proved it
+	MFA           bool      `json:"mfa,omitempty"`
+	MFAVerifiedAt time.Time `json:"mfa_verified_at,omitempty"`
+	// a role taken away stays in tokens issued before until they expire, admin actions check it again
+	Role string `json:"role,omitempty"`
+	// set when the caller used an api key instead of a token, Scopes are what the key was given
+	APIKeyID int64    `json:"api_key_id,omitempty"`
+	Scopes   []string `json:"scopes,omitempty"`
+}
+
+type Payload struct {
+	ID     uuid.UUID `json:"id"`
+	UserID int64     `json:"user_id"`
+	Claims
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiredAt time.Time `json:"expired_at"`
+}
+
+// NewPayload creates a new token payload with a specific user_id and duration
+func NewPayload(userID int64, duration time.Duration, claims Claims) (*Payload, error) {
+	tokenID, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+
+	payload := &Payload{
+		ID:        tokenID,
+		UserID:    userID,
+		Claims:    claims,
+		IssuedAt:  time.Now(),
+		ExpiredAt: time.Now().Add(duration),
+	}
+	return payload, nil
+}
+
+// Valid checks if the token payload is valid or not
+func (payload *Payload) Valid() error {
+	if time.Now().After(payload.ExpiredAt) {
+		return types.ErrTokenExpired
+	}
+
+	return nil
+}
+
+// Allows reports whether the caller may use a route that asks for scope, a full login may use every
+// route but the second step of a login and, unless it is an admin's, the admin routes
+func (payload *Payload) Allows(scope string) bool {
+	switch {
+	case payload.Scope != "":
+		return payload.Scope == scope
+	case payload.APIKeyID != 0:
+		return slices.Contains(payload.Scopes, scope)
+	case scope == ScopeAdmin:
+		return payload.Role == types.RoleAdmin
+	default:
+		return scope != ScopeMFA
+	}
+}
+
+type Maker interface {
+	Create(userID int64, duration time.Duration, claims Claims) (string, *Payload, error)
+	Verify(token string) (*Payload, error)
+	// PublicKeys are the keys others may verify tokens with, none when tokens are sealed
+	PublicKeys() []types.PublicKey
+}
+
+// pasetoMaker is a PASETO token maker
+type pasetoMaker struct {
+	paseto       *paseto.V2
+	symmetricKey []byte
+}
+
+// NewPasetoMaker creates a new pasetoMaker
+func NewPasetoMaker(symmetricKey string) (Maker, error) {
+	if len(symmetricKey) != chacha20poly1305.KeySize {
+		return nil, types.ErrInvalidKeySize
+	}
+
+	return &pasetoMaker{
+		paseto:       paseto.NewV2(),
+		symmetricKey: []byte(symmetricKey),
+	}, nil
+}
+
+// Create creates a new token for a specific username and duration
+func (maker *pasetoMaker) Create(userID int64, duration time.Duration, claims Claims) (string, *Payload, error) {
+	payload, err := NewPayload(userID, duration, claims)
+	if err != nil {
+		return "", payload, err
+	}
+
+	token, err := maker.paseto.Encrypt(maker.symmetricKey, payload, nil)
+	return token, payload, err
+}
+
+// Verify checks if the token is valid or not
+func (maker *pasetoMaker) Verify(token string) (*Payload, error) {
+	payload := &Payload{}
+
+	err := maker.paseto.Decrypt(token, maker.symmetricKey, payload, nil)
+	if err != nil {
+		return nil, types.ErrInvalidToken
+	}
+
+	err = payload.Valid()
+	if err != nil {
+		return nil, err
+	}
+
+	return payload, nil
+}
+
+// PublicKeys is empty, only holders of the symmetric key can verify the tokens
+func (maker *pasetoMaker) PublicKeys() []types.PublicKey {
+	return []types.PublicKey{}
+}
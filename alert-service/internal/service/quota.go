@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	database "alert-service/database/sqlc"
+	"alert-service/internal/expression"
+	"alert-service/internal/types"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Usage is what a user has of their plan, limits of 0 are unlimited
+type Usage struct {
+	Plan         string   `json:"plan"`
+	Limits       Limits   `json:"limits"`
+	ActiveAlerts int64    `json:"active_alerts"`
+	Pairs        []string `json:"pairs"`
+}
+
+type Limits struct {
+	MaxActiveAlerts    int32    `json:"max_active_alerts"`
+	MaxPairs           int32    `json:"max_pairs"`
+	Channels           []string `json:"channels"`
+	MinCooldownSeconds int32    `json:"min_cooldown_seconds"`
+}
+
+// Allows reports whether alert transitions may reach the user through channel
+func (l Limits) Allows(channel string) bool {
+	for _, c := range l.Channels {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *alert) Usage(ctx context.Context, userID int64) (Usage, error) {
+	plan, err := a.db.GetUserPlan(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Usage{}, types.ErrNotAuthorized
+	}
+	if err != nil {
+		return Usage{}, err
+	}
+
+	usage, err := a.db.GetAlertUsage(ctx, database.GetAlertUsageParams{UserID: userID})
+	if err != nil {
+		return Usage{}, err
+	}
+
+	pairs := usagePairs(usage)
+	names := make([]string, 0, len(pairs))
+	for pair := range pairs {
+		names = append(names, types.PairName(pair))
+	}
+	sort.Strings(names)
+
+	return Usage{
+		Plan: plan.Name,
+		Limits: Limits{
+			MaxActiveAlerts:    plan.MaxActiveAlerts,
+			MaxPairs:           plan.MaxPairs,
+			Channels:           plan.Channels,
+			MinCooldownSeconds: plan.MinCooldownSeconds,
+		},
+		ActiveAlerts: usage.ActiveAlerts,
+		Pairs:        names,
+	}, nil
+}
+
+// checkQuota is called in the transaction that creates an alert watching pairs, the user stays locked
+// until it commits so concurrent creates cannot both take the last free slot. exceptID is an alert that
+// is updated to watch pairs instead, it is left out of the usage so it is not counted twice.
+func checkQuota(ctx context.Context, q database.Querier, userID int64, exceptID int64, pairs ...types.Currency) error {
+	plan, err := q.GetUserPlanForUpdate(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.ErrNotAuthorized
+	}
+	if err != nil {
+		return err
+	}
+
+	usage, err := q.GetAlertUsage(ctx, database.GetAlertUsageParams{
+		UserID:   userID,
+		ExceptID: exceptID,
+	})
+	if err != nil {
+		return err
+	}
+	return exceedsQuota(plan, usage, pairs)
+}
+
+// checkUpdateQuota is called before current is moved to pair, only an alert that still counts against
+// the plan can take it past a limit
+func checkUpdateQuota(ctx context.Context, q database.Querier, current database.Alert, pair string) error {
+	if current.Crypto == pair || (current.Status != string(types.Created) && current.Status != string(types.Triggered)) {
+		return nil
+	}
+	return checkQuota(ctx, q, current.UserID, current.ID, types.Currency(pair))
+}
+
+func exceedsQuota(plan database.Plan, usage database.GetAlertUsageRow, pairs []types.Currency) error {
+	if plan.MaxActiveAlerts > 0 && usage.ActiveAlerts >= int64(plan.MaxActiveAlerts) {
+		return &types.ErrQuotaExceeded{Plan: plan.Name, Limit: "active alerts", Max: plan.MaxActiveAlerts}
+	}
+
+	if plan.MaxPairs > 0 {
+		watched := usagePairs(usage)
+		for _, pair := range pairs {
+			watched[pair] = true
+		}
+		if len(watched) > int(plan.MaxPairs) {
+			return &types.ErrQuotaExceeded{Plan: plan.Name, Limit: "pairs", Max: plan.MaxPairs}
+		}
+	}
+	return nil
+}
+
+// usagePairs are the pairs watched by price alerts and the pairs referenced in expressions
+func usagePairs(usage database.GetAlertUsageRow) map[types.Currency]bool {
+	pairs := make(map[types.Currency]bool, len(usage.Pairs))
+	for _, pair := range usage.Pairs {
+		pairs[types.Currency(pair)] = true
+	}
+	for _, src := range usage.Expressions {
+		// stored expressions were type checked on create
+		expr, err := expression.ParseExpr(src)
+		if err != nil {
+			continue
+		}
+		for _, pair := range expr.Pairs() {
+			pairs[pair] = true
+		}
+	}
+	return pairs
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	database "alert-service/database/sqlc"
+	"alert-service/internal/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExceedsQuota(t *testing.T) {
+	free := database.Plan{Name: types.PlanFree, MaxActiveAlerts: 3, MaxPairs: 2}
+	usage := database.GetAlertUsageRow{
+		ActiveAlerts: 2,
+		Pairs:        []string{string(types.BTC)},
+		Expressions:  []string{"btcusdt > 2 * ethusdt"},
+	}
+
+	// btc and eth are watched already, the expression counts for both
+	assert.NoError(t, exceedsQuota(free, usage, []types.Currency{types.ETH}))
+
+	var qErr *types.ErrQuotaExceeded
+	err := exceedsQuota(free, usage, []types.Currency{types.SOL})
+	assert.True(t, errors.As(err, &qErr))
+	assert.Equal(t, "pairs", qErr.Limit)
+
+	usage.ActiveAlerts = 3
+	err = exceedsQuota(free, usage, []types.Currency{types.BTC})
+	assert.True(t, errors.As(err, &qErr))
+	assert.Equal(t, "active alerts", qErr.Limit)
+
+	// limits of 0 are unlimited
+	admin := database.Plan{Name: types.PlanAdmin}
+	assert.NoError(t, exceedsQuota(admin, usage, []types.Currency{types.SOL}))
+}
+
+func TestUpdateQuota(t *testing.T) {
+	db := &memStore{plan: database.Plan{Name: types.PlanFree, MaxActiveAlerts: 2, MaxPairs: 1}}
+	first := db.addAlert(database.Alert{UserID: 1, Crypto: string(types.BTC), Price: 70000, Status: string(types.Created)})
+	svc := NewAlertService(&memCache{}, db, []byte("secret"), []string{types.SourceBinance})
+
+	// the only alert of a pair takes its slot along
+	_, err := svc.Update(context.Background(), types.UpdateAlertRequest{UserID: 1, AlertID: first.ID, Currency: string(types.ETH), Price: 4000})
+	assert.NoError(t, err)
+
+	second := db.addAlert(database.Alert{UserID: 1, Crypto: string(types.ETH), Price: 3000, Status: string(types.Created)})
+	var qErr *types.ErrQuotaExceeded
+	_, err = svc.Update(context.Background(), types.UpdateAlertRequest{UserID: 1, AlertID: second.ID, Currency: string(types.SOL), Price: 150})
+	assert.True(t, errors.As(err, &qErr))
+	assert.Equal(t, "pairs", qErr.Limit)
+
+	// a full plan still lets alerts change their price
+	_, err = svc.Update(context.Background(), types.UpdateAlertRequest{UserID: 1, AlertID: second.ID, Currency: string(types.ETH), Price: 3500})
+	assert.NoError(t, err)
+
+	res, err := svc.BatchUpdate(context.Background(), types.BatchUpdateAlertsRequest{
+		UserID: 1,
+		Mode:   types.BatchBestEffort,
+		Alerts: []types.AlertUpdate{{AlertID: second.ID, Currency: string(types.SOL), Price: 150}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, res.Failed)
+	assert.Contains(t, res.Items[0].Error, "pairs")
+}
@@ -0,0 +1,328 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	database "alert-service/database/sqlc"
+	"alert-service/internal/cache"
+	"alert-service/internal/types"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// memStore keeps the rows a test needs in memory, a query it does not implement panics on the nil
+// Store it embeds. WithTx does not roll anything back.
+type memStore struct {
+	database.Store
+	plan       database.Plan
+	alerts     []database.Alert
+	events     []database.AlertEvent
+	users      []database.User
+	identities []database.OidcIdentity
+}
+
+func (s *memStore) WithTx(ctx context.Context, fn func(tx database.Tx) error) error {
+	return fn(memTx{s})
+}
+
+type memTx struct {
+	*memStore
+}
+
+func (t memTx) Savepoint(ctx context.Context, fn func(q database.Querier) error) error {
+	return fn(t.memStore)
+}
+
+func (s *memStore) ShareAlertIndex(ctx context.Context) error {
+	return nil
+}
+
+func (s *memStore) addAlert(alert database.Alert) database.Alert {
+	alert.ID = int64(len(s.alerts) + 1)
+	alert.CreatedAt = time.Now()
+	s.alerts = append(s.alerts, alert)
+	return alert
+}
+
+func (s *memStore) GetUserPlanForUpdate(ctx context.Context, userID int64) (database.Plan, error) {
+	return s.plan, nil
+}
+
+func (s *memStore) GetAlertUsage(ctx context.Context, arg database.GetAlertUsageParams) (database.GetAlertUsageRow, error) {
+	var usage database.GetAlertUsageRow
+	for _, alert := range s.alerts {
+		active := alert.Status == string(types.Created) || alert.Status == string(types.Triggered)
+		if alert.UserID != arg.UserID || alert.ID == arg.ExceptID || !active {
+			continue
+		}
+		usage.ActiveAlerts++
+		if alert.Crypto != "" {
+			usage.Pairs = append(usage.Pairs, alert.Crypto)
+		}
+		if alert.Expression != "" {
+			usage.Expressions = append(usage.Expressions, alert.Expression)
+		}
+	}
+	return usage, nil
+}
+
+func (s *memStore) ExportAlerts(ctx context.Context, arg database.ExportAlertsParams) ([]database.Alert, error) {
+	var page []database.Alert
+	for _, alert := range s.alerts {
+		if alert.UserID == arg.UserID && alert.ID > arg.AfterID && len(page) < int(arg.MaxRows) {
+			page = append(page, alert)
+		}
+	}
+	return page, nil
+}
+
+func (s *memStore) CreateAlert(ctx context.Context, arg database.CreateAlertParams) (database.Alert, error) {
+	return s.addAlert(database.Alert{
+		UserID:    arg.UserID,
+		Crypto:    arg.Crypto,
+		Price:     arg.Price,
+		Direction: arg.Direction,
+		Status:    string(types.Created),
+		Source:    arg.Source,
+	}), nil
+}
+
+func (s *memStore) GetAlertByID(ctx context.Context, id int64) (database.Alert, error) {
+	return s.GetAlertForUpdate(ctx, id)
+}
+
+func (s *memStore) GetAlertForUpdate(ctx context.Context, id int64) (database.Alert, error) {
+	for _, alert := range s.alerts {
+		if alert.ID == id {
+			return alert, nil
+		}
+	}
+	return database.Alert{}, pgx.ErrNoRows
+}
+
+func (s *memStore) UpdateAlert(ctx context.Context, arg database.UpdateAlertParams) (database.Alert, error) {
+	for i, alert := range s.alerts {
+		if alert.ID == arg.ID {
+			s.alerts[i].Crypto = arg.Crypto
+			s.alerts[i].Price = arg.Price
+			s.alerts[i].Direction = arg.Direction
+			return s.alerts[i], nil
+		}
+	}
+	return database.Alert{}, pgx.ErrNoRows
+}
+
+func (s *memStore) UpdateAlertStatus(ctx context.Context, arg database.UpdateAlertStatusParams) error {
+	for i, alert := range s.alerts {
+		if alert.ID == arg.ID {
+			s.alerts[i].Status = arg.Status
+			return nil
+		}
+	}
+	return pgx.ErrNoRows
+}
+
+func (s *memStore) ImportAlert(ctx context.Context, arg database.ImportAlertParams) (database.Alert, error) {
+	return s.addAlert(database.Alert{
+		UserID:     arg.UserID,
+		Crypto:     arg.Crypto,
+		Price:      arg.Price,
+		Direction:  arg.Direction,
+		Status:     string(types.Created),
+		Expression: arg.Expression,
+		Source:     arg.Source,
+	}), nil
+}
+
+func (s *memStore) CreateAlertEvent(ctx context.Context, arg database.CreateAlertEventParams) error {
+	s.events = append(s.events, database.AlertEvent{
+		ID:        int64(len(s.events) + 1),
+		AlertID:   arg.AlertID,
+		Type:      arg.Type,
+		Price:     arg.Price,
+		Detail:    arg.Detail,
+		CreatedAt: time.Now(),
+	})
+	return nil
+}
+
+func (s *memStore) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error) {
+	user := database.User{
+		ID:             int64(len(s.users) + 1),
+		Email:          arg.Email,
+		HashedPassword: arg.HashedPassword,
+		CreatedAt:      time.Now(),
+	}
+	s.users = append(s.users, user)
+	return user, nil
+}
+
+func (s *memStore) GetUserById(ctx context.Context, id int64) (database.User, error) {
+	for _, user := range s.users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+	return database.User{}, pgx.ErrNoRows
+}
+
+func (s *memStore) GetUserForUpdate(ctx context.Context, id int64) (database.User, error) {
+	return s.GetUserById(ctx, id)
+}
+
+// updateUser applies fn to the stored user
+func (s *memStore) updateUser(id int64, fn func(user *database.User)) {
+	for i := range s.users {
+		if s.users[i].ID == id {
+			fn(&s.users[i])
+		}
+	}
+}
+
+func (s *memStore) RecordLoginFailure(ctx context.Context, id int64) (int32, error) {
+	var failures int32
+	s.updateUser(id, func(user *database.User) {
+		user.FailedLogins++
+		failures = user.FailedLogins
+	})
+	return failures, nil
+}
+
+func (s *memStore) LockUser(ctx context.Context, arg database.LockUserParams) error {
+	s.updateUser(arg.ID, func(user *database.User) {
+		user.LockedUntil = arg.LockedUntil
+	})
+	return nil
+}
+
+func (s *memStore) ReleaseLoginAttempt(ctx context.Context, id int64) (int32, error) {
+	var failures int32
+	s.updateUser(id, func(user *database.User) {
+		user.FailedLogins = max(user.FailedLogins-1, 0)
+		user.LockedUntil = time.Unix(0, 0)
+		failures = user.FailedLogins
+	})
+	return failures, nil
+}
+
+func (s *memStore) UnlockUser(ctx context.Context, id int64) (int64, error) {
+	s.updateUser(id, func(user *database.User) {
+		user.FailedLogins = 0
+		user.LockedUntil = time.Unix(0, 0)
+	})
+	return 1, nil
+}
+
+// GetUserByEmail ignores case like the unique index on lower(email)
+func (s *memStore) GetUserByEmail(ctx context.Context, email string) (database.User, error) {
+	for _, user := range s.users {
+		if strings.EqualFold(user.Email, email) {
+			return user, nil
+		}
+	}
+	return database.User{}, pgx.ErrNoRows
+}
+
+func (s *memStore) GetOidcIdentity(ctx context.Context, arg database.GetOidcIdentityParams) (database.OidcIdentity, error) {
+	for _, identity := range s.identities {
+		if identity.Issuer == arg.Issuer && identity.Subject == arg.Subject {
+			return identity, nil
+		}
+	}
+	return database.OidcIdentity{}, pgx.ErrNoRows
+}
+
+func (s *memStore) CreateOidcIdentity(ctx context.Context, arg database.CreateOidcIdentityParams) (database.OidcIdentity, error) {
+	identity := database.OidcIdentity{
+		ID:        int64(len(s.identities) + 1),
+		UserID:    arg.UserID,
+		Issuer:    arg.Issuer,
+		Subject:   arg.Subject,
+		Email:     arg.Email,
+		CreatedAt: time.Now(),
+	}
+	s.identities = append(s.identities, identity)
+	return identity, nil
+}
+
+// every login is the first one, so none asks for a security notice
+func (s *memStore) GetKnownLogin(ctx context.Context, arg database.GetKnownLoginParams) (database.GetKnownLoginRow, error) {
+	return database.GetKnownLoginRow{}, nil
+}
+
+func (s *memStore) RecordLogin(ctx context.Context, arg database.RecordLoginParams) error {
+	return nil
+}
+
+func (s *memStore) GetAlertEvents(ctx context.Context, alertID int64) ([]database.AlertEvent, error) {
+	var events []database.AlertEvent
+	for _, event := range s.events {
+		if event.AlertID == alertID {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// memCache records the index writes and messages of a test
+type memCache struct {
+	cache.Cacher
+	writes    []cache.AlertWrite
+	published []any
+	once      map[string][]byte
+	counters  map[string]int
+}
+
+func (c *memCache) WriteAlerts(ctx context.Context, writes []cache.AlertWrite) error {
+	c.writes = append(c.writes, writes...)
+	return nil
+}
+
+func (c *memCache) AddAlert(ctx context.Context, alertID int64, crypto string, source string, price float64, direction bool) error {
+	return nil
+}
+
+func (c *memCache) Publish(ctx context.Context, channel string, v any) error {
+	c.published = append(c.published, v)
+	return nil
+}
+
+// counters never expire
+func (c *memCache) IncrCounter(ctx context.Context, key string, ttl time.Duration) (int, time.Duration, error) {
+	if c.counters == nil {
+		c.counters = make(map[string]int)
+	}
+	c.counters[key]++
+	return c.counters[key], ttl, nil
+}
+
+func (c *memCache) DecrCounter(ctx context.Context, key string) error {
+	if c.counters[key] > 0 {
+		c.counters[key]--
+	}
+	return nil
+}
+
+func (c *memCache) PutOnce(ctx context.Context, key string, v any, ttl time.Duration) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if c.once == nil {
+		c.once = make(map[string][]byte)
+	}
+	c.once[key] = b
+	return nil
+}
+
+func (c *memCache) TakeOnce(ctx context.Context, key string, v any) (bool, error) {
+	b, ok := c.once[key]
+	if !ok {
+		return false, nil
+	}
+	delete(c.once, key)
+	return true, json.Unmarshal(b, v)
+}
@@ -0,0 +1,385 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	database "alert-service/database/sqlc"
+	"alert-service/internal/types"
+
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// codes as authenticator apps show them by default, RFC 6238 with HMAC-SHA1
+const (
+	totpDigits = 6
+	totpPeriod = 30
+	// steps either side of now that are accepted, for clocks that drift
+	totpSkew = 1
+
+	recoveryCodeCount = 10
+)
+
+var errSealedSecret = errors.New("sealed totp secret is malformed")
+
+// TOTPConfig sets up two-factor authentication with authenticator apps
+type TOTPConfig struct {
+	// name the account is listed under in the authenticator app
+	Issuer string `env:"TOTP_ISSUER" default:"Crypto Alerts"`
+	// lifetime of the token between the password and the code of a login
+	MFATokenDuration time.Duration `env:"TOTP_MFA_TOKEN_DURATION" default:"5m"`
+	// sensitive operations of users with two-factor authentication want a code at most this old, 0
+	// turns the step-up off
+	StepUpWindow time.Duration `env:"TOTP_STEP_UP_WINDOW" default:"10m"`
+}
+
+func (c *TOTPConfig) Validate() error {
+	switch {
+	case c.Issuer == "" || strings.Contains(c.Issuer, ":"):
+		return fmt.Errorf("invalid TOTP_ISSUER %q", c.Issuer)
+	case c.MFATokenDuration <= 0:
+		return fmt.Errorf("invalid TOTP_MFA_TOKEN_DURATION %s", c.MFATokenDuration)
+	case c.StepUpWindow < 0:
+		return fmt.Errorf("invalid TOTP_STEP_UP_WINDOW %s", c.StepUpWindow)
+	}
+	return nil
+}
+
+// EnrollTOTP stores a new secret that stays unused until ConfirmTOTP, enrolling again before that
+// replaces it
+func (a *auther) EnrollTOTP(ctx context.Context, userID int64) (types.TOTPEnrollment, error) {
+	user, err := a.user(ctx, userID)
+	if err != nil {
+		return types.TOTPEnrollment{}, err
+	}
+	if user.TotpEnabled {
+		return types.TOTPEnrollment{}, types.ErrTOTPEnabled
+	}
+
+	secret := make([]byte, 20)
+	_, err = rand.Read(secret)
+	if err != nil {
+		return types.TOTPEnrollment{}, err
+	}
+	sealed, err := a.secrets.seal(secret)
+	if err != nil {
+		return types.TOTPEnrollment{}, err
+	}
+
+	n, err := a.db.SetTOTPSecret(ctx, database.SetTOTPSecretParams{
+		ID:         user.ID,
+		TotpSecret: sealed,
+	})
+	if err != nil {
+		return types.TOTPEnrollment{}, err
+	}
+	if n == 0 {
+		return types.TOTPEnrollment{}, types.ErrTOTPEnabled
+	}
+
+	encoded := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret)
+	return types.TOTPEnrollment{
+		Secret:          encoded,
+		ProvisioningURI: provisioningURI(a.totp.Issuer, user.Email, encoded),
+	}, nil
+}
+
+// ConfirmTOTP turns two-factor authentication on once a code of the enrolled secret is valid and
+// hands out a fresh set of recovery codes
+func (a *auther) ConfirmTOTP(ctx context.Context, req types.TOTPRequest) (types.RecoveryCodes, error) {
+	user, err := a.user(ctx, req.UserID)
+	if err != nil {
+		return types.RecoveryCodes{}, err
+	}
+	if user.TotpEnabled {
+		return types.RecoveryCodes{}, types.ErrTOTPEnabled
+	}
+	if user.TotpSecret == "" {
+		return types.RecoveryCodes{}, types.ErrTOTPNotEnrolled
+	}
+
+	secret, err := a.secrets.open(user.TotpSecret)
+	if err != nil {
+		return types.RecoveryCodes{}, err
+	}
+	step := matchTOTP(secret, req.Code, time.Now())
+	if step == 0 {
+		return types.RecoveryCodes{}, types.ErrInvalidTOTPCode
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		codes[i], err = newRecoveryCode()
+		if err != nil {
+			return types.RecoveryCodes{}, err
+		}
+	}
+
+	err = a.db.WithTx(ctx, func(tx database.Tx) error {
+		err := tx.EnableTOTP(ctx, database.EnableTOTPParams{
+			ID:           user.ID,
+			TotpLastStep: step,
+		})
+		if err != nil {
+			return err
+		}
+
+		err = tx.DeleteRecoveryCodes(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		for _, code := range codes {
+			err := tx.CreateRecoveryCode(ctx, database.CreateRecoveryCodeParams{
+				UserID:   user.ID,
+				CodeHash: hashRecoveryCode(code),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return types.RecoveryCodes{}, err
+	}
+
+	return types.RecoveryCodes{RecoveryCodes: codes}, nil
+}
+
+// LoginTOTP is the second step of a login, a wrong code counts as a failed login like a wrong password
+func (a *auther) LoginTOTP(ctx context.Context, req types.LoginTOTPRequest) (types.LoginUserResponse, error) {
+	user, err := a.totpUser(ctx, req.UserID, req.IP)
+	if err != nil {
+		return types.LoginUserResponse{}, err
+	}
+
+	if req.RecoveryCode != "" {
+		n, err := a.db.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+			UserID:   user.ID,
+			CodeHash: hashRecoveryCode(req.RecoveryCode),
+		})
+		if err != nil {
+			return types.LoginUserResponse{}, err
+		}
+		if n == 0 {
+			return types.LoginUserResponse{}, a.loginFailed(user, req.IP, req.UserAgent)
+		}
+	} else {
+		err := a.useTOTP(ctx, user, req.Code)
+		if errors.Is(err, types.ErrInvalidTOTPCode) {
+			return types.LoginUserResponse{}, a.loginFailed(user, req.IP, req.UserAgent)
+		}
+		if err != nil {
+			return types.LoginUserResponse{}, err
+		}
+	}
+	user, err = a.loginPassed(ctx, user, req.IP)
+	if err != nil {
+		return types.LoginUserResponse{}, err
+	}
+
+	return a.finishLogin(ctx, user, req.IP, req.UserAgent)
+}
+
+// StepUp issues a new access token that proves a second factor just now. A wrong code counts as a
+// failed login so a stolen session cannot guess codes, the account is locked out of logins and step
+// ups alike.
+func (a *auther) StepUp(ctx context.Context, req types.TOTPRequest) (types.LoginUserResponse, error) {
+	user, err := a.totpUser(ctx, req.UserID, req.IP)
+	if err != nil {
+		return types.LoginUserResponse{}, err
+	}
+
+	err = a.useTOTP(ctx, user, req.Code)
+	if errors.Is(err, types.ErrInvalidTOTPCode) {
+		err = a.loginFailed(user, req.IP, req.UserAgent)
+		// the session itself is still good
+		if errors.Is(err, types.ErrNotAuthorized) {
+			err = types.ErrInvalidTOTPCode
+		}
+		return types.LoginUserResponse{}, err
+	}
+	if err != nil {
+		return types.LoginUserResponse{}, err
+	}
+	user, err = a.loginPassed(ctx, user, req.IP)
+	if err != nil {
+		return types.LoginUserResponse{}, err
+	}
+
+	if user.FailedLogins > 0 {
+		_, err = a.db.UnlockUser(ctx, user.ID)
+		if err != nil {
+			return types.LoginUserResponse{}, err
+		}
+	}
+	return a.accessToken(user)
+}
+
+// CheckStepUp lets users without two-factor authentication through, they have nothing to step up with
+func (a *auther) CheckStepUp(payload *Payload) error {
+	if a.totp.StepUpWindow == 0 || !payload.MFA {
+		return nil
+	}
+	if time.Since(payload.MFAVerifiedAt) > a.totp.StepUpWindow {
+		return types.ErrStepUpRequired
+	}
+	return nil
+}
+
+// useTOTP accepts a code once, the step it belongs to is taken so the code cannot be replayed
+func (a *auther) useTOTP(ctx context.Context, user database.User, code string) error {
+	secret, err := a.secrets.open(user.TotpSecret)
+	if err != nil {
+		return err
+	}
+
+	step := matchTOTP(secret, code, time.Now())
+	if step == 0 {
+		return types.ErrInvalidTOTPCode
+	}
+
+	n, err := a.db.UseTOTPStep(ctx, database.UseTOTPStepParams{
+		ID:           user.ID,
+		TotpLastStep: step,
+	})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return types.ErrInvalidTOTPCode
+	}
+	return nil
+}
+
+// totpUser starts an attempt at a code, users without two-factor authentication have no code to guess
+// and are refused before it is counted
+func (a *auther) totpUser(ctx context.Context, userID int64, ip string) (database.User, error) {
+	user, err := a.user(ctx, userID)
+	if err != nil {
+		return database.User{}, err
+	}
+	if !user.TotpEnabled {
+		return database.User{}, types.ErrTOTPNotEnrolled
+	}
+	return a.startLoginAttempt(ctx, userID, ip)
+}
+
+func (a *auther) user(ctx context.Context, userID int64) (database.User, error) {
+	user, err := a.db.GetUserById(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return database.User{}, types.ErrNotAuthorized
+	}
+	return user, err
+}
+
+// totpCode is the code of a time step, RFC 4226 dynamic truncation
+func totpCode(secret []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	bin := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, bin%1000000)
+}
+
+// matchTOTP returns the step near now the code belongs to, 0 when there is none
+func matchTOTP(secret []byte, code string, now time.Time) int64 {
+	step := now.Unix() / totpPeriod
+	for i := step - totpSkew; i <= step+totpSkew; i++ {
+		if hmac.Equal([]byte(totpCode(secret, i)), []byte(code)) {
+			return i
+		}
+	}
+	return 0
+}
+
+// provisioningURI is the otpauth uri authenticator apps read from a qr code
+func provisioningURI(issuer string, account string, secret string) string {
+	params := url.Values{
+		"secret":    {secret},
+		"issuer":    {issuer},
+		"algorithm": {"SHA1"},
+		"digits":    {strconv.Itoa(totpDigits)},
+		"period":    {strconv.Itoa(totpPeriod)},
+	}
+	return "otpauth://totp/" + url.PathEscape(issuer+":"+account) + "?" + params.Encode()
+}
+
+// recovery codes carry 50 random bits, enough that a plain sha-256 of them cannot be reversed
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	code := strings.ToLower(base32.StdEncoding.EncodeToString(b))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+// codes are compared without case, dashes and spaces
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// secretBox seals totp secrets before they go to postgres
+type secretBox struct {
+	key []byte
+}
+
+// the sealing key is derived so the secret it comes from is never used as is
+func newSecretBox(secret []byte) *secretBox {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("totp secret"))
+	return &secretBox{
+		key: mac.Sum(nil),
+	}
+}
+
+func (b *secretBox) seal(plain []byte) (string, error) {
+	aead, err := chacha20poly1305.NewX(b.key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plain)+aead.Overhead())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, plain, nil)), nil
+}
+
+func (b *secretBox) open(sealed string) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(b.key)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(sealed)
+	if err != nil || len(raw) < aead.NonceSize() {
+		return nil, errSealedSecret
+	}
+	return aead.Open(nil, raw[:aead.NonceSize()], raw[aead.NonceSize():], nil)
+}
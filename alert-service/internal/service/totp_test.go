@@ -0,0 +1,44 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTOTP(t *testing.T) {
+	// RFC 6238 appendix B with the SHA1 secret, cut to the last 6 digits
+	secret := []byte("12345678901234567890")
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, code := range vectors {
+		assert.Equal(t, code, totpCode(secret, unix/totpPeriod), unix)
+	}
+
+	// a step of drift either way is accepted, more is not
+	now := time.Unix(1111111109, 0)
+	step := now.Unix() / totpPeriod
+	assert.Equal(t, step, matchTOTP(secret, "081804", now))
+	assert.Equal(t, step, matchTOTP(secret, "081804", now.Add(totpPeriod*time.Second)))
+	assert.Equal(t, int64(0), matchTOTP(secret, "081804", now.Add(2*totpPeriod*time.Second)))
+	assert.Equal(t, int64(0), matchTOTP(secret, "000000", now))
+
+	box := newSecretBox([]byte("01234567890123456789012345678901"))
+	sealed, err := box.seal(secret)
+	assert.NoError(t, err)
+	opened, err := box.open(sealed)
+	assert.NoError(t, err)
+	assert.Equal(t, secret, opened)
+
+	code, err := newRecoveryCode()
+	assert.NoError(t, err)
+	assert.Len(t, code, 11)
+	assert.Equal(t, hashRecoveryCode(code), hashRecoveryCode(" "+code[:5]+code[6:]+" "))
+}
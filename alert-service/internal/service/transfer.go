@@ -0,0 +1,452 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	database "alert-service/database/sqlc"
+	"alert-service/internal/cache"
+	"alert-service/internal/expression"
+	"alert-service/internal/types"
+
+	"github.com/go-playground/validator"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// alerts read per query while exporting
+	exportPage = 500
+	// rows a single import may hold
+	maxImportRows = 1000
+)
+
+// columns of a csv export, an import needs the header and may leave out status and created_at
+var csvHeader = []string{"pair", "price", "direction", "source", "expression", "status", "created_at"}
+
+var (
+	errDryRun = errors.New("dry run")
+	// rows are checked against the struct tags of types.AlertRecord
+	recordValidator = validator.New()
+)
+
+// ImportResult reports what happened to every row, nothing is stored on a dry run. Rejected rows
+// would have taken the user past a limit of their plan.
+type ImportResult struct {
+	DryRun   bool              `json:"dry_run"`
+	Created  int               `json:"created"`
+	Skipped  int               `json:"skipped"`
+	Invalid  int               `json:"invalid"`
+	Rejected int               `json:"rejected"`
+	Rows     []ImportRowResult `json:"rows"`
+}
+
+// ImportRowResult is the outcome of a row, row is the line of a csv file and the position of a json
+// array element, both counted from 1
+type ImportRowResult struct {
+	Row     int    `json:"row"`
+	Action  string `json:"action"`
+	AlertID int64  `json:"alert_id,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// importRow is a decoded row, err is set when it could not be read
+type importRow struct {
+	row    int
+	record types.AlertRecord
+	err    error
+}
+
+// Export writes every alert of the user that is not deleted, a page at a time
+func (a *alert) Export(ctx context.Context, req types.ExportAlertsRequest, w io.Writer) error {
+	enc := newRecordEncoder(req.Format, w)
+	err := enc.begin()
+	if err != nil {
+		return err
+	}
+
+	params := database.ExportAlertsParams{
+		UserID:  req.UserID,
+		MaxRows: exportPage,
+	}
+	for {
+		page, err := a.db.ExportAlerts(ctx, params)
+		if err != nil {
+			return err
+		}
+
+		for _, res := range page {
+			err := enc.encode(types.AlertRecord{
+				Pair:       res.Crypto,
+				Price:      res.Price,
+				Direction:  res.Direction,
+				Source:     res.Source,
+				Expression: res.Expression,
+				Status:     res.Status,
+				CreatedAt:  res.CreatedAt,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(page) < exportPage {
+			return enc.end()
+		}
+		params.AfterID = page[len(page)-1].ID
+	}
+}
+
+// Import stores the rows of an export in one transaction, a row that fails only fails itself. A dry
+// run goes through the same statements and rolls them back.
+func (a *alert) Import(ctx context.Context, req types.ImportAlertsRequest, r io.Reader) (ImportResult, error) {
+	var rows []importRow
+	var err error
+	if req.Format == types.FormatCSV {
+		rows, err = decodeCSV(r)
+	} else {
+		rows, err = decodeJSON(r)
+	}
+	if err != nil {
+		return ImportResult{}, types.NewErrValidation(err)
+	}
+
+	res := ImportResult{
+		DryRun: req.DryRun,
+		Rows:   make([]ImportRowResult, len(rows)),
+	}
+	var stored []database.Alert
+	err = a.db.WithTx(ctx, func(tx database.Tx) error {
+		var writes []cache.AlertWrite
+		for i, row := range rows {
+			res.Rows[i].Row = row.row
+			if row.err == nil {
+				row.record, row.err = checkRecord(row.record)
+			}
+			if row.err == nil {
+				row.record.Source, row.err = a.alertSource(row.record.Source)
+			}
+			if row.err != nil {
+				res.Rows[i].Action = "invalid"
+				res.Rows[i].Error = row.err.Error()
+				res.Invalid++
+				continue
+			}
+
+			// an alert that fired or was disabled would fire again, its row is reported instead
+			if row.record.Status != "" && row.record.Status != string(types.Created) {
+				res.Rows[i].Action = "skipped"
+				res.Rows[i].Error = fmt.Sprintf("only alerts still waiting to fire are imported, this one is %s", row.record.Status)
+				res.Skipped++
+				continue
+			}
+
+			// every row is counted as a new alert, a row that only matches an existing one is rejected
+			// too once the plan is full
+			err := checkQuota(ctx, tx, req.UserID, 0, recordPairs(row.record)...)
+			var qErr *types.ErrQuotaExceeded
+			if errors.As(err, &qErr) {
+				res.Rows[i].Action = "rejected"
+				res.Rows[i].Error = err.Error()
+				res.Rejected++
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			// conflicts are settled by the statement itself, any error left is not the row's fault
+			alert, action, err := importRecord(ctx, tx, req, row.record)
+			if err != nil {
+				return err
+			}
+
+			res.Rows[i].Action = action
+			res.Rows[i].AlertID = alert.ID
+			if action == "skipped" {
+				res.Skipped++
+				continue
+			}
+			res.Created++
+
+			err = recordEvent(ctx, tx, alert, types.EventCreated, "imported: "+describeAlert(alert))
+			if err != nil {
+				return err
+			}
+			stored = append(stored, alert)
+			writes = append(writes, indexWrite(alert, false))
+		}
+
+		if req.DryRun {
+			return errDryRun
+		}
+		err := tx.ShareAlertIndex(ctx)
+		if err != nil {
+			return err
+		}
+		return a.cache.WriteAlerts(ctx, writes)
+	})
+	if errors.Is(err, errDryRun) {
+		return res, nil
+	}
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	for _, alert := range stored {
+		a.publish(ctx, alert)
+	}
+	return res, nil
+}
+
+// importRecord inserts the alert of a row and reports whether it was created or skipped, a skipped
+// row of an upsert reports the alert it matched
+func importRecord(ctx context.Context, q database.Querier, req types.ImportAlertsRequest, rec types.AlertRecord) (database.Alert, string, error) {
+	params := database.ImportAlertParams{
+		UserID:     req.UserID,
+		Crypto:     rec.Pair,
+		Price:      rec.Price,
+		Direction:  rec.Direction,
+		Expression: rec.Expression,
+		Source:     rec.Source,
+	}
+
+	if req.OnConflict == types.ConflictUpsert {
+		row, err := q.UpsertAlert(ctx, database.UpsertAlertParams(params))
+		if err != nil {
+			return database.Alert{}, "", err
+		}
+
+		action := "skipped"
+		if row.Inserted {
+			action = "created"
+		}
+		return database.Alert{
+			ID:         row.ID,
+			UserID:     row.UserID,
+			Crypto:     row.Crypto,
+			Price:      row.Price,
+			Direction:  row.Direction,
+			Status:     row.Status,
+			CreatedAt:  row.CreatedAt,
+			Expression: row.Expression,
+			Source:     row.Source,
+		}, action, nil
+	}
+
+	alert, err := q.ImportAlert(ctx, params)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return database.Alert{}, "skipped", nil
+	}
+	if err != nil {
+		return database.Alert{}, "", err
+	}
+	return alert, "created", nil
+}
+
+// checkRecord validates a row like the create endpoints do and normalizes it to what they store
+func checkRecord(rec types.AlertRecord) (types.AlertRecord, error) {
+	err := recordValidator.Struct(rec)
+	if err != nil {
+		return rec, types.NewErrValidation(err)
+	}
+
+	if rec.Expression != "" {
+		if rec.Pair != "" {
+			return rec, types.NewErrValidation(errors.New("a row has either a pair or an expression"))
+		}
+		expr, err := expression.ParseExpr(rec.Expression)
+		if err != nil {
+			return rec, types.NewErrValidation(err)
+		}
+
+		rec.Expression = expr.String()
+		rec.Price = 0
+		rec.Direction = false
+		return rec, nil
+	}
+
+	pair, ok := types.ParsePair(rec.Pair)
+	if !ok {
+		return rec, types.NewErrValidation(fmt.Errorf("unknown pair %q", rec.Pair))
+	}
+	rec.Pair = string(pair)
+	return rec, nil
+}
+
+// recordPairs are the pairs a checked record watches
+func recordPairs(rec types.AlertRecord) []types.Currency {
+	if rec.Expression == "" {
+		return []types.Currency{types.Currency(rec.Pair)}
+	}
+
+	expr, err := expression.ParseExpr(rec.Expression)
+	if err != nil {
+		return nil
+	}
+	return expr.Pairs()
+}
+
+func decodeJSON(r io.Reader) ([]importRow, error) {
+	dec := json.NewDecoder(r)
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if tok != json.Delim('[') {
+		return nil, errors.New("expected a json array of alerts")
+	}
+
+	var rows []importRow
+	for dec.More() {
+		if len(rows) == maxImportRows {
+			return nil, fmt.Errorf("an import holds at most %d rows", maxImportRows)
+		}
+
+		row := importRow{row: len(rows) + 1}
+		err := dec.Decode(&row.record)
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			row.err = types.NewErrValidation(fmt.Errorf("%s must be a %s", typeErr.Field, typeErr.Type))
+		} else if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func decodeCSV(r io.Reader) ([]importRow, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(strings.ToLower(name))] = i
+	}
+	if _, ok := columns["pair"]; !ok {
+		if _, ok := columns["expression"]; !ok {
+			return nil, errors.New("csv header needs a pair or an expression column")
+		}
+	}
+
+	var rows []importRow
+	for {
+		fields, err := cr.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) == maxImportRows {
+			return nil, fmt.Errorf("an import holds at most %d rows", maxImportRows)
+		}
+
+		line, _ := cr.FieldPos(0)
+		row := importRow{row: line}
+		row.record, row.err = csvRecord(columns, fields)
+		rows = append(rows, row)
+	}
+}
+
+func csvRecord(columns map[string]int, fields []string) (types.AlertRecord, error) {
+	field := func(name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(fields) {
+			return ""
+		}
+		return strings.TrimSpace(fields[i])
+	}
+
+	rec := types.AlertRecord{
+		Pair:       field("pair"),
+		Source:     field("source"),
+		Expression: field("expression"),
+		Status:     field("status"),
+	}
+
+	var err error
+	if s := field("price"); s != "" {
+		rec.Price, err = strconv.ParseFloat(s, 64)
+		if err != nil {
+			return rec, types.NewErrValidation(fmt.Errorf("price %q is not a number", s))
+		}
+	}
+	if s := field("direction"); s != "" {
+		rec.Direction, err = strconv.ParseBool(s)
+		if err != nil {
+			return rec, types.NewErrValidation(fmt.Errorf("direction %q is not a boolean", s))
+		}
+	}
+	return rec, nil
+}
+
+// recordEncoder streams records as a csv file or a json array
+type recordEncoder struct {
+	format string
+	w      io.Writer
+	csv    *csv.Writer
+	n      int
+}
+
+func newRecordEncoder(format string, w io.Writer) *recordEncoder {
+	return &recordEncoder{
+		format: format,
+		w:      w,
+		csv:    csv.NewWriter(w),
+	}
+}
+
+func (e *recordEncoder) begin() error {
+	if e.format == types.FormatCSV {
+		return e.csv.Write(csvHeader)
+	}
+	_, err := io.WriteString(e.w, "[")
+	return err
+}
+
+func (e *recordEncoder) encode(rec types.AlertRecord) error {
+	defer func() { e.n++ }()
+
+	if e.format == types.FormatCSV {
+		return e.csv.Write([]string{
+			rec.Pair,
+			strconv.FormatFloat(rec.Price, 'f', -1, 64),
+			strconv.FormatBool(rec.Direction),
+			rec.Source,
+			rec.Expression,
+			rec.Status,
+			rec.CreatedAt.UTC().Format(time.RFC3339),
+		})
+	}
+
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if e.n > 0 {
+		b = append([]byte(","), b...)
+	}
+	_, err = e.w.Write(b)
+	return err
+}
+
+func (e *recordEncoder) end() error {
+	if e.format == types.FormatCSV {
+		e.csv.Flush()
+		return e.csv.Error()
+	}
+	_, err := io.WriteString(e.w, "]\n")
+	return err
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	database "alert-service/database/sqlc"
+	"alert-service/internal/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransferRoundTrip(t *testing.T) {
+	records := []types.AlertRecord{
+		{Pair: string(types.BTC), Price: 70000.5, Direction: true, Source: types.SourceConsensus, Status: "created"},
+		{Expression: "btcusdt > 70000 && ethusdt > 4000", Source: types.SourceBinance, Status: "triggered"},
+	}
+
+	for _, format := range []string{types.FormatCSV, types.FormatJSON} {
+		var buf bytes.Buffer
+		enc := newRecordEncoder(format, &buf)
+		assert.NoError(t, enc.begin())
+		for _, rec := range records {
+			rec.CreatedAt = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			assert.NoError(t, enc.encode(rec))
+		}
+		assert.NoError(t, enc.end())
+
+		var rows []importRow
+		var err error
+		if format == types.FormatCSV {
+			rows, err = decodeCSV(&buf)
+		} else {
+			rows, err = decodeJSON(&buf)
+		}
+		assert.NoError(t, err, format)
+		assert.Len(t, rows, 2, format)
+
+		for i, row := range rows {
+			assert.NoError(t, row.err, format)
+			rec, err := checkRecord(row.record)
+			assert.NoError(t, err, format)
+			assert.Equal(t, records[i].Pair, rec.Pair, format)
+			assert.Equal(t, records[i].Price, rec.Price, format)
+			assert.Equal(t, records[i].Direction, rec.Direction, format)
+			assert.Equal(t, records[i].Source, rec.Source, format)
+		}
+	}
+}
+
+func TestImportRowErrors(t *testing.T) {
+	csv := "pair,price,direction\nbtcusdt,abc,true\ndogeusdt,1,false\nethusdt,4000,false\n"
+	rows, err := decodeCSV(strings.NewReader(csv))
+	assert.NoError(t, err)
+	assert.Len(t, rows, 3)
+
+	// rows are numbered by their line, a bad value only fails its row
+	assert.Equal(t, 2, rows[0].row)
+	var vErr *types.ErrValidation
+	assert.ErrorAs(t, rows[0].err, &vErr)
+
+	_, err = checkRecord(rows[1].record)
+	assert.ErrorAs(t, err, &vErr)
+
+	rec, err := checkRecord(rows[2].record)
+	assert.NoError(t, err)
+	assert.Equal(t, string(types.ETH), rec.Pair)
+
+	rows, err = decodeJSON(strings.NewReader(`[{"pair": "btcusdt", "price": "high"}, {"pair": "solusdt", "price": 150}]`))
+	assert.NoError(t, err)
+	assert.ErrorAs(t, rows[0].err, &vErr)
+	assert.NoError(t, rows[1].err)
+}
+
+func TestImportSkipsFiredAlerts(t *testing.T) {
+	db := &memStore{}
+	db.addAlert(database.Alert{UserID: 1, Crypto: string(types.BTC), Price: 70000, Direction: true, Status: string(types.Triggered), Source: types.SourceConsensus})
+	db.addAlert(database.Alert{UserID: 1, Crypto: string(types.ETH), Price: 4000, Status: string(types.Created), Source: types.SourceConsensus})
+	c := &memCache{}
+	svc := NewAlertService(c, db, []byte("secret"), []string{types.SourceBinance})
+
+	for _, format := range []string{types.FormatCSV, types.FormatJSON} {
+		var buf bytes.Buffer
+		err := svc.Export(context.Background(), types.ExportAlertsRequest{UserID: 1, Format: format}, &buf)
+		require.NoError(t, err, format)
+
+		// imported by another user so the waiting alert does not match one they already have
+		res, err := svc.Import(context.Background(), types.ImportAlertsRequest{UserID: 2, Format: format, OnConflict: types.ConflictSkip}, &buf)
+		require.NoError(t, err, format)
+		assert.Equal(t, 1, res.Created, format)
+		assert.Equal(t, 1, res.Skipped, format)
+		assert.Equal(t, "skipped", res.Rows[0].Action, format)
+		assert.Contains(t, res.Rows[0].Error, "triggered", format)
+		assert.Equal(t, "created", res.Rows[1].Action, format)
+	}
+
+	// only the waiting alert was armed again, once per import
+	assert.Len(t, c.writes, 2)
+	for _, alert := range db.alerts[2:] {
+		assert.Equal(t, string(types.ETH), alert.Crypto)
+		assert.Equal(t, string(types.Created), alert.Status)
+	}
+}
@@ -0,0 +1,680 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aead/chacha20poly1305"
+)
+
+type Currency string
+
+const (
+	BTC Currency = "btcusdt@trade"
+	ETH Currency = "ethusdt@trade"
+	SOL Currency = "solusdt@trade"
+)
+
+// currencies the watcher subscribes to
+var SupportedCurrencies = []Currency{BTC, ETH, SOL}
+
+// price sources an alert can fire on, a single exchange or the consensus of every enabled one
+const (
+	SourceConsensus = "consensus"
+	SourceBinance   = "binance"
+	SourceCoinbase  = "coinbase"
+)
+
+// exchanges the watcher can read trades from
+var SupportedSources = []string{SourceBinance, SourceCoinbase}
+
+// ParseSources lowercases and dedups a list of exchanges, rejecting those the watcher cannot read
+func ParseSources(list []string) ([]string, error) {
+	var sources []string
+	for _, source := range list {
+		source = strings.ToLower(source)
+		if !slices.Contains(SupportedSources, source) {
+			return nil, fmt.Errorf("unknown feed source %q", source)
+		}
+		if !slices.Contains(sources, source) {
+			sources = append(sources, source)
+		}
+	}
+	if len(sources) == 0 {
+		return nil, errors.New("no feed sources")
+	}
+	return sources, nil
+}
+
+// ParsePair accepts a pair as "btcusdt", "BTCUSDT" or the raw stream name "btcusdt@trade"
+func ParsePair(s string) (Currency, bool) {
+	s = strings.ToLower(s)
+	if !strings.Contains(s, "@") {
+		s += "@trade"
+	}
+
+	for _, curr := range SupportedCurrencies {
+		if curr == Currency(s) {
+			return curr, true
+		}
+	}
+	return "", false
+}
+
+// TargetRange is the trigger decision of a price alert, shared by the watcher and backtests: at this
+// price the alerts whose target lies within [min, max] fire. Alerts with direction true fire once the
+// price is at or above their target, the others once it is at or below it.
+func TargetRange(direction bool, price float64) (min, max float64) {
+	if direction {
+		return 0, price
+	}
+	return price, math.Inf(1)
+}
+
+// PairName strips the stream suffix, "btcusdt@trade" becomes "btcusdt"
+func PairName(curr Currency) string {
+	name, _, _ := strings.Cut(string(curr), "@")
+	return name
+}
+
+func PairNames(currencies []Currency) []string {
+	names := make([]string, len(currencies))
+	for i, curr := range currencies {
+		names[i] = PairName(curr)
+	}
+	return names
+}
+
+type State string
+
+const (
+	Created   State = "created"
+	Triggered State = "triggered"
+	Deleted   State = "deleted"
+	Completed State = "completed"
+	// taken off the watcher by an admin, it never fires
+	Disabled State = "disabled"
+)
+
+// kinds of entries in the history of an alert
+const (
+	EventCreated      = "created"
+	EventUpdated      = "updated"
+	EventTriggered    = "triggered"
+	EventNotified     = "notified"
+	EventNotifyFailed = "notify_failed"
+	// the notification fell into the cooldown of the user's plan, it is sent once the cooldown is over
+	EventNotifyDelayed = "notify_delayed"
+	EventDeleted       = "deleted"
+	EventDisabled      = "disabled"
+)
+
+// plans a user can be on, their limits are stored with them in postgres
+const (
+	PlanFree  = "free"
+	PlanPro   = "pro"
+	PlanAdmin = "admin"
+)
+
+// roles of users, admins may use the admin routes
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// channels alert transitions reach a user through, a plan allows a subset of them
+const (
+	ChannelEmail  = "email"
+	ChannelStream = "stream"
+)
+
+// for auth service
+type SignUpUserRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required,min=7"`
+}
+
+type SignUpUserResponse struct {
+	UserID    int64     `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type LoginUserRequest struct {
+	UserID   int64  `json:"user_id" validate:"required,number,min=1"`
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required,min=7"`
+	// where the login comes from, set by the api
+	IP        string `json:"-"`
+	UserAgent string `json:"-"`
+}
+
+// UnlockUserRequest clears the failed logins and the lockout of a user, only admins may send it
+type UnlockUserRequest struct {
+	AdminID int64 `validate:"required,number,min=1"`
+	UserID  int64 `validate:"required,number,min=1"`
+}
+
+// kinds of security notices emailed to a user
+const (
+	NoticeLockout  = "lockout"
+	NoticeNewLogin = "new_login"
+)
+
+// SecurityNotice is sent to email-service, which looks the address of the user up
+type SecurityNotice struct {
+	UserID    int64     `json:"user_id"`
+	Kind      string    `json:"kind"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	At        time.Time `json:"at"`
+	// end of a lockout
+	Until time.Time `json:"until,omitempty"`
+}
+
+// LoginUserResponse holds the access token, or only an mfa token when the user has two-factor
+// authentication and the code still has to be sent to /v1/auth/totp/login with it
+type LoginUserResponse struct {
+	AccessToken          string             `json:"access_token,omitempty"`
+	AccessTokenExpiresAt time.Time          `json:"access_token_expires_at"`
+	User                 SignUpUserResponse `json:"user"`
+	MFARequired          bool               `json:"mfa_required,omitempty"`
+	MFAToken             string             `json:"mfa_token,omitempty"`
+}
+
+// PublicKey is a key tokens can be verified with, as a JSON Web Key
+type PublicKey struct {
+	KeyID     string `json:"kid"`
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+}
+
+// PublicKeySet is the document of /.well-known/jwks.json
+type PublicKeySet struct {
+	Keys []PublicKey `json:"keys"`
+}
+
+// TOTPEnrollment is a new authenticator secret, it is used once a code of it was confirmed
+type TOTPEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// TOTPRequest proves the second factor of a user that is logged in, IP and UserAgent are set for a
+// step up whose wrong codes count as failed logins
+type TOTPRequest struct {
+	UserID    int64  `json:"-" validate:"required,number,min=1"`
+	Code      string `json:"code" validate:"required,len=6,numeric"`
+	IP        string `json:"-"`
+	UserAgent string `json:"-"`
+}
+
+// LoginTOTPRequest is the second step of a login, with a code of the authenticator or a recovery code
+type LoginTOTPRequest struct {
+	UserID       int64  `json:"-" validate:"required,number,min=1"`
+	Code         string `json:"code" validate:"required_without=RecoveryCode,omitempty,len=6,numeric"`
+	RecoveryCode string `json:"recovery_code"`
+	IP           string `json:"-"`
+	UserAgent    string `json:"-"`
+}
+
+// OIDCStart is where to send the user to log in at the identity provider, State comes back with
+// them and has to be used before ExpiresAt
+type OIDCStart struct {
+	URL       string    `json:"url"`
+	State     string    `json:"state"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// OIDCCallbackRequest is what the identity provider sent the user back with
+type OIDCCallbackRequest struct {
+	Code      string `validate:"required"`
+	State     string `validate:"required"`
+	IP        string
+	UserAgent string
+}
+
+// RecoveryCodes are shown once, only their hashes are kept
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// CreateAPIKeyRequest asks for a key with some of the scopes alerts:read and alerts:write, it never
+// expires when ExpiresAt is left out
+type CreateAPIKeyRequest struct {
+	UserID    int64     `json:"-" validate:"required,number,min=1"`
+	Name      string    `json:"name" validate:"required,max=64"`
+	Scopes    []string  `json:"scopes" validate:"required,min=1,dive,oneof=alerts:read alerts:write"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CreateAPIKeyResponse holds the key itself, it cannot be shown again
+type CreateAPIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// APIKey is a key without its secret, Prefix is the start of the key to tell keys apart by
+type APIKey struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	Revoked    bool       `json:"revoked"`
+}
+
+type RevokeAPIKeyRequest struct {
+	UserID int64 `json:"-" validate:"required,number,min=1"`
+	ID     int64 `json:"-" validate:"required,number,min=1"`
+}
+
+// for alert service
+type CreateAlertRequest struct {
+	UserID    int64   `json:"user_id" validate:"required,number,min=1"`
+	Currency  string  `json:"currency" validate:"required,oneof=btcusdt@trade ethusdt@trade solusdt@trade"`
+	Price     float64 `json:"price" validate:"required,number,min=0"`
+	Direction bool    `json:"direction" validate:"required"`
+	Source    string  `json:"source" validate:"omitempty,oneof=consensus binance coinbase"`
+}
+
+// orders an alert listing can be sorted in, every one pages by keyset with the alert id as tie breaker
+const (
+	SortCreatedAt = "created_at"
+	SortPrice     = "price"
+	SortPair      = "pair"
+)
+
+// page size of an alert listing when no limit is given
+const DefaultListLimit = 50
+
+// ListAlertsRequest lists the alerts of a user, newest first unless sorted by price or pair (lowest
+// first). Filters are optional, the cursor of a previous page continues it with the same sort.
+type ListAlertsRequest struct {
+	UserID int64     `json:"user_id" validate:"required,number,min=1"`
+	Sort   string    `json:"sort" validate:"omitempty,oneof=created_at price pair"`
+	Pair   string    `json:"pair"`
+	Status []string  `json:"status" validate:"dive,oneof=created triggered deleted completed disabled"`
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	Cursor string    `json:"cursor"`
+	Limit  int32     `json:"limit" validate:"min=0,max=100"`
+}
+
+type CreateExpressionAlertRequest struct {
+	UserID     int64  `json:"user_id" validate:"required,number,min=1"`
+	Expression string `json:"expression" validate:"required,max=512"`
+	Source     string `json:"source" validate:"omitempty,oneof=consensus binance coinbase"`
+}
+
+type UpdateAlertRequest struct {
+	AlertID   int64   `json:"alert_id" validate:"required,number,min=1"`
+	UserID    int64   `json:"user_id" validate:"required,number,min=1"`
+	Currency  string  `json:"currency" validate:"required,oneof=btcusdt@trade ethusdt@trade solusdt@trade"`
+	Price     float64 `json:"price" validate:"required,number,min=0"`
+	Direction bool    `json:"direction"`
+}
+
+type DeleteAlertRequest struct {
+	AlertID int64 `json:"alert_id" validate:"required,number,min=1"`
+	UserID  int64 `json:"user_id" validate:"required,number,min=1"`
+}
+
+// how a batch is applied, atomic rolls every item back once one fails, best effort keeps the others
+const (
+	BatchAtomic     = "atomic"
+	BatchBestEffort = "best_effort"
+)
+
+// AlertSpec is one price alert of a batch
+type AlertSpec struct {
+	Currency  string  `json:"currency" validate:"required,oneof=btcusdt@trade ethusdt@trade solusdt@trade"`
+	Price     float64 `json:"price" validate:"required,number,min=0"`
+	Direction bool    `json:"direction"`
+	Source    string  `json:"source" validate:"omitempty,oneof=consensus binance coinbase"`
+}
+
+// PriceLadder spreads count price alerts evenly from one price to another, both ends included
+type PriceLadder struct {
+	Currency  string  `json:"currency" validate:"required,oneof=btcusdt@trade ethusdt@trade solusdt@trade"`
+	From      float64 `json:"from" validate:"required,gt=0"`
+	To        float64 `json:"to" validate:"required,gt=0,nefield=From"`
+	Count     int     `json:"count" validate:"required,min=2,max=100"`
+	Direction bool    `json:"direction"`
+	Source    string  `json:"source" validate:"omitempty,oneof=consensus binance coinbase"`
+}
+
+// BatchCreateAlertsRequest creates either the listed alerts or the alerts of a ladder
+type BatchCreateAlertsRequest struct {
+	UserID int64        `json:"user_id" validate:"required,number,min=1"`
+	Mode   string       `json:"mode" validate:"omitempty,oneof=atomic best_effort"`
+	Alerts []AlertSpec  `json:"alerts" validate:"required_without=Ladder,max=100,dive"`
+	Ladder *PriceLadder `json:"ladder"`
+}
+
+type AlertUpdate struct {
+	AlertID   int64   `json:"alert_id" validate:"required,number,min=1"`
+	Currency  string  `json:"currency" validate:"required,oneof=btcusdt@trade ethusdt@trade solusdt@trade"`
+	Price     float64 `json:"price" validate:"required,number,min=0"`
+	Direction bool    `json:"direction"`
+}
+
+type BatchUpdateAlertsRequest struct {
+	UserID int64         `json:"user_id" validate:"required,number,min=1"`
+	Mode   string        `json:"mode" validate:"omitempty,oneof=atomic best_effort"`
+	Alerts []AlertUpdate `json:"alerts" validate:"required,min=1,max=100,dive"`
+}
+
+type BatchDeleteAlertsRequest struct {
+	UserID   int64   `json:"user_id" validate:"required,number,min=1"`
+	Mode     string  `json:"mode" validate:"omitempty,oneof=atomic best_effort"`
+	AlertIDs []int64 `json:"alert_ids" validate:"required,min=1,max=100,dive,min=1"`
+}
+
+// file formats of alert imports and exports
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// what an import does with a row that matches an alert the user already has. Neither changes the
+// alert, upsert reports which one matched while skip does not look it up.
+const (
+	ConflictSkip   = "skip"
+	ConflictUpsert = "upsert"
+)
+
+// AlertRecord is one alert of an export and one row of an import. created_at is only exported, rows
+// of an import with a status other than created are skipped so alerts that fired are not armed
+// again. A row is either a price alert or an expression alert.
+type AlertRecord struct {
+	Pair       string    `json:"pair" validate:"required_without=Expression"`
+	Price      float64   `json:"price" validate:"required_without=Expression,min=0"`
+	Direction  bool      `json:"direction"`
+	Source     string    `json:"source" validate:"omitempty,oneof=consensus binance coinbase"`
+	Expression string    `json:"expression" validate:"max=512"`
+	Status     string    `json:"status,omitempty"`
+	CreatedAt  time.Time `json:"created_at,omitempty"`
+}
+
+type ExportAlertsRequest struct {
+	UserID int64  `validate:"required,number,min=1"`
+	Format string `validate:"required,oneof=csv json"`
+}
+
+type ImportAlertsRequest struct {
+	UserID     int64  `validate:"required,number,min=1"`
+	Format     string `validate:"required,oneof=csv json"`
+	DryRun     bool
+	OnConflict string `validate:"required,oneof=skip upsert"`
+}
+
+type AlertHistoryRequest struct {
+	AlertID int64 `validate:"required,number,min=1"`
+	UserID  int64 `validate:"required,number,min=1"`
+}
+
+// for market service
+type ReadCandlesRequest struct {
+	Pair     string    `json:"pair" validate:"required"`
+	Interval string    `json:"interval" validate:"required,oneof=1m 5m 1h"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+}
+
+// ParseTime accepts RFC3339 or unix seconds, an empty value is the zero time
+func ParseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	if sec, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// tickers not refreshed for longer than this are stale on read, the watcher is gone
+const MaxTickerAge = 10 * time.Second
+
+// Ticker is the watcher's view of a pair as published for the api
+type Ticker struct {
+	Pair             string    `json:"pair"`
+	Price            float64   `json:"price"`
+	EventTime        time.Time `json:"event_time"`
+	UpdatedAt        time.Time `json:"updated_at"`
+	Open24h          float64   `json:"open_24h"`
+	Change24h        float64   `json:"change_24h"`
+	ChangePercent24h float64   `json:"change_percent_24h"`
+	Stale            bool      `json:"stale"`
+	// prices of the exchanges that are not paused
+	Sources map[string]float64 `json:"sources,omitempty"`
+}
+
+type HealthStatus string
+
+const (
+	HealthOK       HealthStatus = "ok"
+	HealthDegraded HealthStatus = "degraded"
+	HealthUnknown  HealthStatus = "unknown"
+)
+
+// how often the watcher checks and publishes its health
+const HealthInterval = time.Second
+
+// WatcherHealth is published by the watcher, degraded means alerts of the paused pairs are held back
+type WatcherHealth struct {
+	Status    HealthStatus `json:"status"`
+	CheckedAt time.Time    `json:"checked_at"`
+	Paused    []PausedPair `json:"paused"`
+	// reporting instance and the pairs it owns, the merged view of every instance has owners instead
+	Instance string            `json:"instance,omitempty"`
+	Pairs    []string          `json:"pairs,omitempty"`
+	Owners   map[string]string `json:"owners,omitempty"`
+}
+
+type PausedPair struct {
+	Pair      string    `json:"pair"`
+	Source    string    `json:"source"`
+	Reason    string    `json:"reason"`
+	LastTrade time.Time `json:"last_trade"`
+	EventTime time.Time `json:"event_time"`
+}
+
+// SortPaused orders paused pairs by pair, then source
+func SortPaused(paused []PausedPair) {
+	sort.Slice(paused, func(i, j int) bool {
+		if paused[i].Pair != paused[j].Pair {
+			return paused[i].Pair < paused[j].Pair
+		}
+		return paused[i].Source < paused[j].Source
+	})
+}
+
+// StreamEvent is what a /v1/stream client receives, data is a Ticker for "tick" and an AlertEvent for "alert"
+type StreamEvent struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// AlertEvent is published whenever an alert changes state
+type AlertEvent struct {
+	AlertID int64     `json:"alert_id"`
+	UserID  int64     `json:"user_id"`
+	Status  string    `json:"status"`
+	Price   string    `json:"price,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+// for backtests, either an expression or a single price alert
+type BacktestRequest struct {
+	UserID     int64     `json:"user_id"`
+	Expression string    `json:"expression" validate:"required_without=Currency,max=512"`
+	Currency   string    `json:"currency" validate:"omitempty,oneof=btcusdt@trade ethusdt@trade solusdt@trade"`
+	Price      float64   `json:"price" validate:"required_with=Currency,min=0"`
+	Direction  bool      `json:"direction"`
+	Interval   string    `json:"interval" validate:"omitempty,oneof=1m 5m 1h"`
+	From       time.Time `json:"from"`
+	To         time.Time `json:"to"`
+}
+
+type BacktestFire struct {
+	Time   time.Time          `json:"time"`
+	Prices map[string]float64 `json:"prices"`
+}
+
+type BacktestResponse struct {
+	Expression string         `json:"expression"`
+	Interval   string         `json:"interval"`
+	From       time.Time      `json:"from"`
+	To         time.Time      `json:"to"`
+	Candles    int            `json:"candles"`
+	Fires      []BacktestFire `json:"fires"`
+}
+
+// for admin service
+type SearchUsersRequest struct {
+	AdminID int64  `validate:"required,number,min=1"`
+	Query   string `validate:"max=254"`
+	AfterID int64  `validate:"min=0"`
+	Limit   int32  `validate:"min=1,max=100"`
+}
+
+// AdminUser is a user as admins see them, without any secret
+type AdminUser struct {
+	ID           int64     `json:"id"`
+	Email        string    `json:"email"`
+	Role         string    `json:"role"`
+	Plan         string    `json:"plan"`
+	CreatedAt    time.Time `json:"created_at"`
+	FailedLogins int32     `json:"failed_logins"`
+	LockedUntil  time.Time `json:"locked_until"`
+	TOTPEnabled  bool      `json:"totp_enabled"`
+}
+
+type AdminUserAlertsRequest struct {
+	AdminID int64 `validate:"required,number,min=1"`
+	UserID  int64 `validate:"required,number,min=1"`
+	AfterID int64 `validate:"min=0"`
+	Limit   int32 `validate:"min=1,max=100"`
+}
+
+type DisableAlertRequest struct {
+	AdminID int64  `json:"-" validate:"required,number,min=1"`
+	AlertID int64  `json:"-" validate:"required,number,min=1"`
+	Reason  string `json:"reason" validate:"max=256"`
+}
+
+// PairState is what the watcher does with a pair, from the leases, tickers and health reports in redis
+type PairState struct {
+	Pair      string             `json:"pair"`
+	Owner     string             `json:"owner,omitempty"`
+	Price     float64            `json:"price"`
+	UpdatedAt time.Time          `json:"updated_at"`
+	Stale     bool               `json:"stale"`
+	Sources   map[string]float64 `json:"sources,omitempty"`
+	Paused    []PausedPair       `json:"paused"`
+}
+
+// RebuildResult counts the alerts written back to the redis index
+type RebuildResult struct {
+	PriceAlerts      int `json:"price_alerts"`
+	ExpressionAlerts int `json:"expression_alerts"`
+}
+
+type ListPageRequest struct {
+	AdminID int64 `validate:"required,number,min=1"`
+	// id to continue after, or before for listings newest first
+	Cursor int64 `validate:"min=0"`
+	Limit  int32 `validate:"min=1,max=100"`
+}
+
+// ReplayDeadLettersRequest replays the letters of IDs, or the oldest pending ones when it is empty
+type ReplayDeadLettersRequest struct {
+	AdminID int64   `json:"-" validate:"required,number,min=1"`
+	IDs     []int64 `json:"ids" validate:"max=100,dive,min=1"`
+}
+
+type ReplayResult struct {
+	Replayed []int64 `json:"replayed"`
+}
+
+var (
+	ErrTokenExpired        = errors.New("token has expired")
+	ErrInvalidToken        = errors.New("token is invalid")
+	ErrNoAuthHeader        = errors.New("no authorization header")
+	ErrInvalidAuthHeader   = errors.New("invalid authorization header")
+	ErrUnsupportedAuthType = errors.New("unsupported authorization type")
+	ErrInvalidKeySize      = fmt.Errorf("invalid key size: must be exactly %d characters", chacha20poly1305.KeySize)
+	ErrBadRequest          = errors.New("bad request")
+	ErrNotAuthorized       = errors.New("not authorized")
+	ErrSubscriptionFailed  = errors.New("subscription failed")
+	ErrUserAlreadyExists   = errors.New("user already exists")
+	ErrDuplicateAlert      = errors.New("duplicate alert")
+	ErrAlertNotFound       = errors.New("alert not found")
+	ErrExpressionAlert     = errors.New("expression alerts cannot be updated, delete and recreate them")
+	ErrUnknownPair         = errors.New("unknown pair")
+	ErrTickerNotFound      = errors.New("no price for pair yet")
+	ErrMarketNotFound      = errors.New("unknown market")
+	ErrInvalidCursor       = errors.New("invalid cursor")
+	ErrRateLimited         = errors.New("rate limit exceeded, retry later")
+	ErrForbidden           = errors.New("forbidden")
+	ErrUserNotFound        = errors.New("user not found")
+	ErrTOTPEnabled         = errors.New("two-factor authentication is already enabled")
+	ErrTOTPNotEnrolled     = errors.New("two-factor authentication was not enrolled")
+	ErrStepUpRequired      = errors.New("this operation needs a recent second factor, step up first")
+	ErrInvalidTOTPCode     = errors.New("invalid two-factor code")
+	ErrAPIKeyNotFound      = errors.New("api key not found")
+	ErrInvalidExpiry       = errors.New("expiry must be in the future")
+	ErrAlertNotActive      = errors.New("alert is not active")
+	ErrReplayUnavailable   = errors.New("replay needs kafka, KAFKA_ADDRESS is not set")
+	ErrOIDCUnavailable     = errors.New("single sign-on is not configured")
+	ErrInvalidOIDCState    = errors.New("single sign-on state is invalid or expired, start the login again")
+	ErrOIDCLoginFailed     = errors.New("single sign-on failed")
+	ErrOIDCEmailUnverified = errors.New("the identity provider did not verify the email of the account")
+	ErrOIDCLinkRequired    = errors.New("an account with this email has a password, log in with it and link single sign-on from there")
+	ErrOIDCIdentityLinked  = errors.New("the single sign-on account is linked to another user")
+)
+
+type ErrValidation struct {
+	Err error
+}
+
+func NewErrValidation(err error) *ErrValidation {
+	return &ErrValidation{Err: err}
+}
+
+func (e *ErrValidation) Error() string {
+	return e.Err.Error()
+}
+
+// ErrQuotaExceeded is returned when a write would take a user past a limit of their plan
+type ErrQuotaExceeded struct {
+	Plan  string
+	Limit string
+	Max   int32
+}
+
+func (e *ErrQuotaExceeded) Error() string {
+	return fmt.Sprintf("quota exceeded: the %s plan allows at most %d %s", e.Plan, e.Max, e.Limit)
+}
+
+// ErrLoginLocked is returned while failed logins hold back the next attempt
+type ErrLoginLocked struct {
+	RetryAfter time.Duration
+}
+
+func (e *ErrLoginLocked) Error() string {
+	return fmt.Sprintf("too many failed logins, try again in %s", e.RetryAfter.Round(time.Second))
+}
@@ -0,0 +1,117 @@
+package watcher
+
+import (
+	"sync"
+	"time"
+
+	database "alert-service/database/sqlc"
+	"alert-service/internal/types"
+)
+
+// candle intervals the watcher aggregates trades into
+var candleIntervals = map[string]time.Duration{
+	"1m": time.Minute,
+	"5m": 5 * time.Minute,
+	"1h": time.Hour,
+}
+
+// how often aggregated candles are written to postgres
+const candleFlushInterval = 5 * time.Second
+
+type candleKey struct {
+	pair     string
+	interval string
+	openTime time.Time
+}
+
+// candleAggregator folds trades into OHLCV candles per pair and interval, candles touched since the
+// last drain are kept aside so they can be upserted in one batch. The volume and trades kept aside are
+// the ones since the last drain, the upsert adds them to the stored candle.
+type candleAggregator struct {
+	mu    sync.Mutex
+	open  map[types.Currency]map[string]*database.UpsertCandlesParams
+	dirty map[candleKey]database.UpsertCandlesParams
+}
+
+func newCandleAggregator() *candleAggregator {
+	return &candleAggregator{
+		open:  make(map[types.Currency]map[string]*database.UpsertCandlesParams),
+		dirty: make(map[candleKey]database.UpsertCandlesParams),
+	}
+}
+
+func (a *candleAggregator) Add(pair types.Currency, price float64, quantity float64, at time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.open[pair] == nil {
+		a.open[pair] = make(map[string]*database.UpsertCandlesParams)
+	}
+
+	for name, interval := range candleIntervals {
+		openTime := at.Truncate(interval).UTC()
+
+		c := a.open[pair][name]
+		switch {
+		// late trade for a candle that is already closed, the stored candle wins
+		case c != nil && openTime.Before(c.OpenTime):
+			continue
+
+		case c == nil || openTime.After(c.OpenTime):
+			c = &database.UpsertCandlesParams{
+				Pair:     types.PairName(pair),
+				Interval: name,
+				OpenTime: openTime,
+				Open:     price,
+				High:     price,
+				Low:      price,
+			}
+			a.open[pair][name] = c
+		}
+
+		c.High = max(c.High, price)
+		c.Low = min(c.Low, price)
+		c.Close = price
+
+		key := candleKey{pair: c.Pair, interval: name, openTime: openTime}
+		d, ok := a.dirty[key]
+		if !ok {
+			d = *c
+		}
+		d.High, d.Low, d.Close = c.High, c.Low, c.Close
+		d.Volume += quantity
+		d.Trades++
+		a.dirty[key] = d
+	}
+}
+
+// Drain returns every candle changed since the previous drain, including ones still open
+func (a *candleAggregator) Drain() []database.UpsertCandlesParams {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	candles := make([]database.UpsertCandlesParams, 0, len(a.dirty))
+	for key, c := range a.dirty {
+		candles = append(candles, c)
+		delete(a.dirty, key)
+	}
+	return candles
+}
+
+// Restore puts back drained candles that were not stored, trades added since the drain are kept
+func (a *candleAggregator) Restore(candles []database.UpsertCandlesParams) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, c := range candles {
+		key := candleKey{pair: c.Pair, interval: c.Interval, openTime: c.OpenTime}
+		if d, ok := a.dirty[key]; ok {
+			c.High = max(c.High, d.High)
+			c.Low = min(c.Low, d.Low)
+			c.Close = d.Close
+			c.Volume += d.Volume
+			c.Trades += d.Trades
+		}
+		a.dirty[key] = c
+	}
+}
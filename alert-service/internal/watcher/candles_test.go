@@ -0,0 +1,90 @@
+package watcher
+
+import (
+	"testing"
+	"time"
+
+	database "alert-service/database/sqlc"
+	"alert-service/internal/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCandleAggregator(t *testing.T) {
+	agg := newCandleAggregator()
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	agg.Add(types.BTC, 100, 1, start.Add(10*time.Second))
+	agg.Add(types.BTC, 120, 2, start.Add(20*time.Second))
+	agg.Add(types.BTC, 90, 1, start.Add(30*time.Second))
+	agg.Add(types.BTC, 110, 1, start.Add(70*time.Second))
+
+	candles := agg.Drain()
+	// two 1m candles, one 5m and one 1h
+	assert.Len(t, candles, 4)
+
+	for _, c := range candles {
+		assert.Equal(t, "btcusdt", c.Pair)
+		switch {
+		case c.Interval == "1m" && c.OpenTime.Equal(start):
+			assert.Equal(t, 100.0, c.Open)
+			assert.Equal(t, 120.0, c.High)
+			assert.Equal(t, 90.0, c.Low)
+			assert.Equal(t, 90.0, c.Close)
+			assert.Equal(t, 4.0, c.Volume)
+			assert.Equal(t, int64(3), c.Trades)
+
+		case c.Interval == "1m":
+			assert.Equal(t, start.Add(time.Minute), c.OpenTime)
+			assert.Equal(t, 110.0, c.Open)
+
+		default:
+			assert.Equal(t, start, c.OpenTime)
+			assert.Equal(t, 100.0, c.Open)
+			assert.Equal(t, 110.0, c.Close)
+			assert.Equal(t, int64(4), c.Trades)
+		}
+	}
+
+	// nothing changed since the drain
+	assert.Empty(t, agg.Drain())
+
+	// a late trade for a closed 1m candle only touches the candles still open
+	agg.Add(types.BTC, 1000, 1, start.Add(5*time.Second))
+	assert.Len(t, agg.Drain(), 2)
+}
+
+func TestCandleDeltas(t *testing.T) {
+	agg := newCandleAggregator()
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	agg.Add(types.BTC, 100, 1, start)
+	agg.Drain()
+
+	// a flush only carries what came in since the last one, the upsert adds it up
+	agg.Add(types.BTC, 120, 2, start.Add(time.Second))
+	failed := oneMinute(agg.Drain())
+	assert.Equal(t, 100.0, failed.Open)
+	assert.Equal(t, 120.0, failed.High)
+	assert.Equal(t, 2.0, failed.Volume)
+	assert.Equal(t, int64(1), failed.Trades)
+
+	// a failed flush is put back under the trades that came in meanwhile
+	agg.Add(types.BTC, 90, 1, start.Add(2*time.Second))
+	agg.Restore([]database.UpsertCandlesParams{failed})
+	c := oneMinute(agg.Drain())
+	assert.Equal(t, 120.0, c.High)
+	assert.Equal(t, 90.0, c.Low)
+	assert.Equal(t, 90.0, c.Close)
+	assert.Equal(t, 3.0, c.Volume)
+	assert.Equal(t, int64(2), c.Trades)
+}
+
+func oneMinute(candles []database.UpsertCandlesParams) database.UpsertCandlesParams {
+	for _, c := range candles {
+		if c.Interval == "1m" {
+			return c
+		}
+	}
+	return database.UpsertCandlesParams{}
+}
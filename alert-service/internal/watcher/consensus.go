@@ -0,0 +1,212 @@
+package watcher
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"alert-service/internal/logger"
+	"alert-service/internal/types"
+)
+
+const (
+	ConsensusMedian = "median"
+	ConsensusVWAP   = "vwap"
+)
+
+// ConsensusConfig decides how the prices of several exchanges are combined into one
+type ConsensusConfig struct {
+	// median of the exchange prices or their volume weighted average
+	Method string `env:"CONSENSUS_METHOD" default:"median"`
+	// fresh exchanges a pair needs before its consensus may fire alerts
+	MinSources int `env:"CONSENSUS_MIN_SOURCES" default:"1"`
+	// an exchange further than this percent from the consensus is reported as diverging
+	MaxDivergencePercent float64 `env:"CONSENSUS_MAX_DIVERGENCE_PERCENT" default:"1"`
+	// traded volume weighing an exchange decays over this window
+	VolumeWindow time.Duration `env:"CONSENSUS_VOLUME_WINDOW" default:"1m"`
+}
+
+func (cfg *ConsensusConfig) Validate() error {
+	cfg.Method = strings.ToLower(cfg.Method)
+	switch {
+	case cfg.Method != ConsensusMedian && cfg.Method != ConsensusVWAP:
+		return fmt.Errorf("invalid CONSENSUS_METHOD %q, want median or vwap", cfg.Method)
+	case cfg.MinSources < 1:
+		return fmt.Errorf("invalid CONSENSUS_MIN_SOURCES %d", cfg.MinSources)
+	case cfg.MaxDivergencePercent <= 0:
+		return fmt.Errorf("invalid CONSENSUS_MAX_DIVERGENCE_PERCENT %v", cfg.MaxDivergencePercent)
+	case cfg.VolumeWindow <= 0:
+		return fmt.Errorf("invalid CONSENSUS_VOLUME_WINDOW %s", cfg.VolumeWindow)
+	}
+	return nil
+}
+
+// quote is the last accepted price of a pair on one exchange
+type quote struct {
+	source string
+	price  float64
+	volume float64
+}
+
+// consensusPrice combines the quotes of the fresh exchanges, vwap falls back to the median while
+// no volume has been seen
+func consensusPrice(method string, quotes []quote) float64 {
+	if method == ConsensusVWAP {
+		var notional, volume float64
+		for _, q := range quotes {
+			notional += q.price * q.volume
+			volume += q.volume
+		}
+		if volume > 0 {
+			return notional / volume
+		}
+	}
+
+	prices := make([]float64, len(quotes))
+	for i, q := range quotes {
+		prices[i] = q.price
+	}
+	sort.Float64s(prices)
+
+	mid := len(prices) / 2
+	if len(prices)%2 == 0 {
+		return (prices[mid-1] + prices[mid]) / 2
+	}
+	return prices[mid]
+}
+
+// decayVolume adds qty to the volume of the previous tick, decayed by the time since it
+func decayVolume(prev Tick, qty float64, now time.Time, window time.Duration) float64 {
+	if prev.UpdatedAt.IsZero() {
+		return qty
+	}
+	return prev.Volume*math.Exp(-float64(now.Sub(prev.UpdatedAt))/float64(window)) + qty
+}
+
+// book returns the market alerts of a source are compared against
+func (c *cryptoWatcher) book(source string) (*SafeMap, bool) {
+	if source == types.SourceConsensus {
+		return c.market, true
+	}
+	book, ok := c.sources[source]
+	return book, ok
+}
+
+// alertSources are the consensus and every enabled exchange
+func (c *cryptoWatcher) alertSources() []string {
+	return append([]string{types.SourceConsensus}, c.sourceNames...)
+}
+
+// paused returns why alerts of a pair on a source must not fire at now, or an empty string when they may
+func (c *cryptoWatcher) paused(source string, curr types.Currency, now time.Time) string {
+	if source != types.SourceConsensus {
+		return c.guard.Paused(source, curr, now)
+	}
+
+	fresh := len(c.quotes(curr, now))
+	if fresh < c.consensus.MinSources {
+		return fmt.Sprintf("%d of %d required sources fresh", fresh, c.consensus.MinSources)
+	}
+	return ""
+}
+
+// quotes collects the prices of a pair on every exchange that is not paused
+func (c *cryptoWatcher) quotes(curr types.Currency, now time.Time) []quote {
+	var quotes []quote
+	for _, source := range c.sourceNames {
+		if c.guard.Paused(source, curr, now) != "" {
+			continue
+		}
+		tick, ok := c.sources[source].Get(curr)
+		if !ok {
+			continue
+		}
+		price, err := strconv.ParseFloat(tick.Price, 64)
+		if err != nil {
+			continue
+		}
+		quotes = append(quotes, quote{
+			source: source,
+			price:  price,
+			volume: tick.Volume,
+		})
+	}
+	return quotes
+}
+
+// updateConsensus recomputes the consensus of a pair after a trade and reports exchanges that
+// disagree with it, it returns false while too few exchanges are fresh
+func (c *cryptoWatcher) updateConsensus(trade Trade, now time.Time) (float64, bool) {
+	quotes := c.quotes(trade.Pair, now)
+	if len(quotes) == 0 || len(quotes) < c.consensus.MinSources {
+		return 0, false
+	}
+
+	price := consensusPrice(c.consensus.Method, quotes)
+	c.market.Set(trade.Pair, Tick{
+		Price:     strconv.FormatFloat(price, 'f', -1, 64),
+		EventTime: trade.Time,
+		UpdatedAt: now,
+	})
+
+	pair := types.PairName(trade.Pair)
+	for _, q := range quotes {
+		spread := jumpPercent(price, q.price)
+		metricSourceSpread.Set(pair+"/"+q.source, spread)
+
+		key := quoteKey{q.source, trade.Pair}
+		if spread <= c.consensus.MaxDivergencePercent {
+			if c.diverging[key] {
+				delete(c.diverging, key)
+				logger.Info().
+					Str("pair", pair).
+					Str("source", q.source).
+					Str("msg", "source back in line with consensus").
+					Send()
+			}
+			continue
+		}
+
+		metricSourceDivergence.Add(pair+"/"+q.source, 1)
+		if !c.diverging[key] {
+			c.diverging[key] = true
+			logger.Warn().
+				Str("pair", pair).
+				Str("source", q.source).
+				Float64("price", q.price).
+				Float64("consensus", price).
+				Float64("spreadPercent", spread).
+				Str("msg", "source diverges from consensus").
+				Send()
+		}
+	}
+
+	return price, true
+}
+
+// health merges the paused exchanges with the pairs whose consensus is held back
+func (c *cryptoWatcher) health(now time.Time) types.WatcherHealth {
+	health := c.guard.Health(now)
+	for _, curr := range c.currencies {
+		reason := c.paused(types.SourceConsensus, curr, now)
+		if reason == "" {
+			continue
+		}
+
+		tick, _ := c.market.Get(curr)
+		health.Status = types.HealthDegraded
+		health.Paused = append(health.Paused, types.PausedPair{
+			Pair:      types.PairName(curr),
+			Source:    types.SourceConsensus,
+			Reason:    reason,
+			LastTrade: tick.UpdatedAt,
+			EventTime: tick.EventTime,
+		})
+	}
+	types.SortPaused(health.Paused)
+
+	return health
+}
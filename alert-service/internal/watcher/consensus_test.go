@@ -0,0 +1,30 @@
+package watcher
+
+import (
+	"testing"
+	"time"
+
+	"alert-service/internal/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsensusPrice(t *testing.T) {
+	quotes := []quote{
+		{source: types.SourceBinance, price: 100, volume: 3},
+		{source: types.SourceCoinbase, price: 104, volume: 1},
+	}
+	assert.Equal(t, 102.0, consensusPrice(ConsensusMedian, quotes))
+	assert.Equal(t, 101.0, consensusPrice(ConsensusVWAP, quotes))
+
+	// one bad print among three exchanges does not move the median
+	quotes = append(quotes, quote{source: "other", price: 1})
+	assert.Equal(t, 100.0, consensusPrice(ConsensusMedian, quotes))
+
+	// without volume vwap is the median
+	assert.Equal(t, 50.5, consensusPrice(ConsensusVWAP, []quote{{price: 1}, {price: 100}}))
+
+	now := time.Now()
+	assert.Equal(t, 2.0, decayVolume(Tick{}, 2, now, time.Minute))
+	assert.InDelta(t, 1+4/2.718281828, decayVolume(Tick{UpdatedAt: now.Add(-time.Minute), Volume: 4}, 1, now, time.Minute), 1e-6)
+}
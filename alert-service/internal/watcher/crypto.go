@@ -0,0 +1,637 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	database "alert-service/database/sqlc"
+	"alert-service/internal/cache"
+	"alert-service/internal/expression"
+	"alert-service/internal/logger"
+	"alert-service/internal/types"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// WatcherConfig is what a watcher instance watches and how far it trusts the prices it reads
+type WatcherConfig struct {
+	// identifies the instance in leases and health reports
+	Instance string
+	// exchanges to read and the pairs this instance owns
+	Sources    []string
+	Currencies []types.Currency
+
+	Guard     GuardConfig
+	Consensus ConsensusConfig
+
+	// how often alerts are compared against the market and tickers are published for the api
+	CompareInterval time.Duration
+	TickerInterval  time.Duration
+	// alerts are checked after every trade instead of on the compare interval, so a replay fires the
+	// same alerts at whatever speed it is played
+	PerTrade bool
+}
+
+type cryptoWatcher struct {
+	instance string
+
+	// consensus of every enabled exchange, what tickers and candles are built from
+	market     *SafeMap
+	currencies []types.Currency
+	feed       Feed
+	errch      chan error
+
+	// pairs owned by other instances, expression alerts read them from redis
+	foreign []types.Currency
+	// expression alerts whose first pair another instance owns, that instance evaluates them
+	foreignExprs map[int64]struct{}
+
+	// last accepted price of every exchange
+	sources     map[string]*SafeMap
+	sourceNames []string
+
+	// how exchanges are combined and which of them currently disagree with the rest
+	consensus ConsensusConfig
+	diverging map[quoteKey]bool
+
+	// throttling my market readers for demo purposes
+	ticker          *time.Ticker
+	compareInterval time.Duration
+	tickerInterval  time.Duration
+	perTrade        bool
+
+	// expression alerts by price source, synced from redis and evaluated only when a pair they reference moves
+	exprs map[string]*exprIndex
+
+	// trades folded into candles and flushed to postgres in batches
+	candles *candleAggregator
+
+	// drops garbage prices and holds back alerts of pairs whose price cannot be trusted
+	guard *priceGuard
+
+	cache    cache.Cacher
+	db       database.Store
+	producer Producer
+}
+
+func NewCryptoWatcher(feed Feed, cfg WatcherConfig, cache cache.Cacher, db database.Store, producer Producer) (*cryptoWatcher, error) {
+	sources, currencies := cfg.Sources, cfg.Currencies
+	if len(sources) == 0 {
+		return nil, errors.New("no price sources")
+	}
+	if cfg.Consensus.MinSources > len(sources) {
+		return nil, fmt.Errorf("consensus needs %d sources but only %d are enabled", cfg.Consensus.MinSources, len(sources))
+	}
+
+	var foreign []types.Currency
+	for _, curr := range types.SupportedCurrencies {
+		if !slices.Contains(currencies, curr) {
+			foreign = append(foreign, curr)
+		}
+	}
+
+	safemap := NewSafeMap()
+
+	// map init
+	for _, curr := range currencies {
+		safemap.Set(curr, Tick{Price: "0"})
+	}
+
+	books := make(map[string]*SafeMap, len(sources))
+	exprs := map[string]*exprIndex{types.SourceConsensus: newExprIndex()}
+	for _, source := range sources {
+		books[source] = NewSafeMap()
+		for _, curr := range currencies {
+			books[source].Set(curr, Tick{Price: "0"})
+		}
+		exprs[source] = newExprIndex()
+	}
+
+	return &cryptoWatcher{
+		instance:        cfg.Instance,
+		market:          safemap,
+		currencies:      currencies,
+		feed:            feed,
+		errch:           make(chan error),
+		foreign:         foreign,
+		foreignExprs:    make(map[int64]struct{}),
+		sources:         books,
+		sourceNames:     sources,
+		consensus:       cfg.Consensus,
+		diverging:       make(map[quoteKey]bool),
+		ticker:          time.NewTicker(cfg.CompareInterval),
+		compareInterval: cfg.CompareInterval,
+		tickerInterval:  cfg.TickerInterval,
+		perTrade:        cfg.PerTrade,
+		exprs:           exprs,
+		candles:         newCandleAggregator(),
+		guard:           newPriceGuard(cfg.Guard, sources, currencies),
+		cache:           cache,
+		db:              db,
+		producer:        producer,
+	}, nil
+}
+
+func (c *cryptoWatcher) Close() error {
+	c.ticker.Stop()
+	return c.feed.Close()
+}
+
+// Run watches until ctx is done and returns once every loop has stopped, so a watcher for another
+// set of pairs can take over right after
+func (c *cryptoWatcher) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	start := func(loop func(ctx context.Context)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			loop(ctx)
+		}()
+	}
+
+	// todo unmarshall and fill the market
+	start(c.fillMarket)
+
+	// start comparing with target price of users, per trade ones are compared by fillMarket
+	if !c.perTrade {
+		for _, curr := range c.currencies {
+			curr := curr
+			start(func(ctx context.Context) { c.startComparing(ctx, curr) })
+		}
+	}
+
+	// expression alerts span several pairs so they are evaluated on their own loop
+	start(c.startEvaluating)
+
+	// persist candles for history
+	start(c.persistCandles)
+
+	// share the market with the api
+	start(c.publishTickers)
+
+	// tell operators when alerts are held back
+	start(c.watchHealth)
+
+	stopped := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		wg.Wait()
+		close(stopped)
+	}()
+
+	// handles errors, can be a potential centalized thingy
+	// loops that are still stopping may report errors too, so errch is read until all of them are done
+	for {
+		select {
+		case <-stopped:
+			return ctx.Err()
+
+		case err := <-c.errch:
+			logger.Error().Str("err", err.Error()).Send()
+		}
+	}
+}
+
+func (c *cryptoWatcher) fillMarket(ctx context.Context) {
+	// a feed that keeps failing is read again after a growing pause instead of in a busy loop
+	var backoff time.Duration
+	for {
+		trade, err := c.feed.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			logger.Info().Str("msg", "feed has no more trades").Send()
+			return
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			c.errch <- err
+
+			backoff = min(max(2*backoff, minFeedBackoff), maxFeedBackoff)
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			continue
+		}
+		backoff = 0
+
+		// messages without a trade time are not trades
+		if trade.Time.IsZero() {
+			continue
+		}
+		// recordings carry pairs other instances own
+		if _, ok := c.market.Get(trade.Pair); !ok {
+			continue
+		}
+
+		now := time.Now()
+		_, err = c.guard.Accept(trade, now)
+		if err != nil {
+			if errors.Is(err, ErrPriceOutlier) {
+				metricTradesRejected.Add("outlier", 1)
+			} else {
+				metricTradesRejected.Add("invalid", 1)
+			}
+			logger.Warn().Str("err", err.Error()).Str("msg", "trade rejected").Send()
+			continue
+		}
+
+		book := c.sources[trade.Source]
+		prev, _ := book.Get(trade.Pair)
+		quantity, err := strconv.ParseFloat(trade.Quantity, 64)
+		if err != nil {
+			c.errch <- err
+			continue
+		}
+		book.Set(trade.Pair, Tick{
+			Price:     trade.Price,
+			EventTime: trade.Time,
+			UpdatedAt: now,
+			Volume:    decayVolume(prev, quantity, now, c.consensus.VolumeWindow),
+		})
+
+		// candles follow the consensus, their volume adds up every exchange
+		price, ok := c.updateConsensus(trade, now)
+		if ok {
+			c.candles.Add(trade.Pair, price, quantity, trade.Time)
+		}
+
+		if c.perTrade {
+			sources := []string{trade.Source}
+			if ok {
+				sources = append(sources, types.SourceConsensus)
+			}
+			c.checkTrade(ctx, trade.Pair, sources)
+		}
+		// logger.Info().
+		// 	Str("currency", string(trade.Pair)).
+		// 	Str("price", trade.Price).
+		// 	Send()
+	}
+}
+
+func (c *cryptoWatcher) persistCandles(ctx context.Context) {
+	ticker := time.NewTicker(candleFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// last flush on shutdown, nobody reads errch anymore
+			if err := c.flushCandles(context.Background()); err != nil {
+				logger.Error().Str("err", err.Error()).Send()
+			}
+			return
+
+		case <-ticker.C:
+			if err := c.flushCandles(ctx); err != nil {
+				c.errch <- err
+			}
+		}
+	}
+}
+
+// flushCandles upserts every candle touched since the last flush in a single batch, the batch runs in
+// one implicit transaction so a failed one is put back whole for the next flush
+func (c *cryptoWatcher) flushCandles(ctx context.Context) error {
+	candles := c.candles.Drain()
+	if len(candles) == 0 {
+		return nil
+	}
+
+	var batchErr error
+	c.db.UpsertCandles(ctx, candles).Exec(func(_ int, err error) {
+		if err != nil && batchErr == nil {
+			batchErr = err
+		}
+	})
+	if batchErr != nil {
+		c.candles.Restore(candles)
+	}
+	return batchErr
+}
+
+func (c *cryptoWatcher) startComparing(ctx context.Context, curr types.Currency) {
+	// reaading market price after tick time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-c.ticker.C:
+			for _, source := range c.alertSources() {
+				c.compare(ctx, curr, source)
+			}
+		}
+	}
+}
+
+// checkTrade compares and evaluates the alerts of a pair on the sources a trade just moved
+func (c *cryptoWatcher) checkTrade(ctx context.Context, curr types.Currency, sources []string) {
+	for _, source := range sources {
+		c.compare(ctx, curr, source)
+		c.evaluate(ctx, source, c.exprs[source].Referencing([]types.Currency{curr}))
+	}
+}
+
+// compare fires the price alerts of a pair on a single price source
+func (c *cryptoWatcher) compare(ctx context.Context, curr types.Currency, source string) {
+	book, _ := c.book(source)
+	tick, ok := book.Get(curr)
+	if !ok {
+		logger.Error().
+			Str("msg", "unknown currency").
+			Send()
+		return
+	}
+
+	price := tick.Price
+	// stale or unconfirmed prices must not fire alerts
+	if c.paused(source, curr, time.Now()) != "" {
+		return
+	}
+
+	switch price {
+	// skips when in memory market is not filled yet
+	case "0":
+		return
+
+	default:
+		p, err := strconv.ParseFloat(price, 64)
+		if err != nil {
+			c.errch <- err
+			return
+		}
+
+		// alerts above and below the price fire on the same decision backtests replay
+		var targets []string
+		for _, direction := range []bool{true, false} {
+			min, max := types.TargetRange(direction, p)
+			reached, err := c.cache.GetTargets(ctx, curr, source, direction, min, max)
+			if err != nil {
+				c.errch <- err
+			}
+			targets = append(targets, reached...)
+		}
+
+		for _, ID := range targets {
+			logger.Info().
+				Str("currency", string(curr)).
+				Str("source", source).
+				Str("price", price).
+				Str("alertID", ID).
+				Send()
+
+			id, err := strconv.ParseInt(ID, 10, 64)
+			if err != nil {
+				c.errch <- err
+				continue
+			}
+			err = c.trigger(ctx, id, price)
+			if err != nil {
+				c.errch <- err
+			}
+		}
+	}
+}
+
+// startEvaluating re-checks expression alerts whenever a pair they reference changes price on their source
+func (c *cryptoWatcher) startEvaluating(ctx context.Context) {
+	// per trade alerts are evaluated by fillMarket, only the sync is left for this loop
+	var tick <-chan time.Time
+	if !c.perTrade {
+		ticker := time.NewTicker(c.compareInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	// new expression alerts are picked up from redis on a slower cadence
+	sync := time.NewTicker(time.Second)
+	defer sync.Stop()
+
+	last := make(map[string]map[types.Currency]Tick)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-sync.C:
+			added, err := c.syncExpressions(ctx)
+			if err != nil {
+				c.errch <- err
+				continue
+			}
+			// freshly added alerts have not seen the current prices yet, and prices of pairs
+			// owned by other instances only arrive through redis
+			for source, index := range c.exprs {
+				c.evaluate(ctx, source, index.Referencing(append(added[source], c.foreign...)))
+			}
+
+		case <-tick:
+			for _, source := range c.alertSources() {
+				book, _ := c.book(source)
+				snapshot := book.Snapshot()
+
+				var changed []types.Currency
+				for curr, tick := range snapshot {
+					if last[source][curr].Price != tick.Price {
+						changed = append(changed, curr)
+					}
+				}
+				last[source] = snapshot
+
+				if len(changed) > 0 {
+					c.evaluate(ctx, source, c.exprs[source].Referencing(changed))
+				}
+			}
+		}
+	}
+}
+
+// syncExpressions mirrors the redis hash into the indexes and returns the pairs of newly added alerts by source
+func (c *cryptoWatcher) syncExpressions(ctx context.Context) (map[string][]types.Currency, error) {
+	stored, err := c.cache.GetExpressions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// dropped from redis means deleted or already triggered
+	for source, index := range c.exprs {
+		for _, id := range index.IDs() {
+			if alert, ok := stored[id]; !ok || alert.Source != source {
+				index.Remove(id)
+			}
+		}
+	}
+	for id := range c.foreignExprs {
+		if _, ok := stored[id]; !ok {
+			delete(c.foreignExprs, id)
+		}
+	}
+
+	added := make(map[string][]types.Currency)
+	for id, alert := range stored {
+		index, ok := c.exprs[alert.Source]
+		// alerts on an exchange this watcher does not read wait for one that does
+		if !ok || index.Has(id) {
+			continue
+		}
+		if _, ok := c.foreignExprs[id]; ok {
+			continue
+		}
+
+		expr, err := expression.ParseExpr(alert.Expression)
+		if err != nil {
+			c.errch <- fmt.Errorf("alert %d has an invalid expression: %w", id, err)
+			continue
+		}
+		// the owner of the first pair evaluates an alert, so exactly one instance does
+		if _, ok := c.market.Get(expr.Pairs()[0]); !ok {
+			c.foreignExprs[id] = struct{}{}
+			continue
+		}
+		index.Add(id, expr)
+		added[alert.Source] = append(added[alert.Source], expr.Pairs()...)
+	}
+
+	return added, nil
+}
+
+func (c *cryptoWatcher) evaluate(ctx context.Context, source string, candidates map[int64]*expression.Expr) {
+	if len(candidates) == 0 {
+		return
+	}
+
+	// paused pairs are left out, expressions referencing them cannot hold
+	now := time.Now()
+	book, _ := c.book(source)
+	prices := make(map[types.Currency]float64)
+	for curr, tick := range book.Snapshot() {
+		if c.paused(source, curr, now) != "" {
+			continue
+		}
+		p, err := strconv.ParseFloat(tick.Price, 64)
+		if err != nil {
+			continue
+		}
+		prices[curr] = p
+	}
+
+	if len(c.foreign) > 0 {
+		err := c.foreignPrices(ctx, source, prices)
+		if err != nil {
+			c.errch <- err
+			return
+		}
+	}
+
+	for id, expr := range candidates {
+		ok, err := expr.Eval(prices)
+		if err != nil || !ok {
+			// missing prices and division by zero just mean the condition does not hold yet
+			continue
+		}
+
+		// removing from redis is the claim, whoever removes it fires it
+		claimed, err := c.cache.RemoveExpression(ctx, id)
+		if err != nil {
+			c.errch <- err
+			continue
+		}
+		c.exprs[source].Remove(id)
+		if !claimed {
+			continue
+		}
+
+		description := expr.Describe(prices)
+		logger.Info().
+			Str("expression", expr.String()).
+			Str("source", source).
+			Str("prices", description).
+			Int64("alertID", id).
+			Send()
+
+		err = c.trigger(ctx, id, description)
+		if err != nil {
+			c.errch <- err
+		}
+	}
+}
+
+// foreignPrices adds the prices of pairs owned by other instances as they published them,
+// stale tickers are left out like paused pairs
+func (c *cryptoWatcher) foreignPrices(ctx context.Context, source string, prices map[types.Currency]float64) error {
+	tickers, err := c.cache.GetTickers(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range tickers {
+		curr, ok := types.ParsePair(t.Pair)
+		if !ok || !slices.Contains(c.foreign, curr) {
+			continue
+		}
+		if time.Since(t.UpdatedAt) > types.MaxTickerAge {
+			continue
+		}
+
+		// exchange prices are only published while they are not paused
+		price, ok := t.Price, !t.Stale
+		if source != types.SourceConsensus {
+			price, ok = t.Sources[source]
+		}
+		if ok {
+			prices[curr] = price
+		}
+	}
+	return nil
+}
+
+// trigger marks a created alert as triggered, hands it to email-service and tells the owner's streams,
+// an alert that was deleted in the meantime is skipped
+func (c *cryptoWatcher) trigger(ctx context.Context, id int64, price string) error {
+	var alert database.Alert
+	err := c.db.WithTx(ctx, func(tx database.Tx) error {
+		var err error
+		alert, err = tx.TriggerAlert(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		return tx.CreateAlertEvent(ctx, database.CreateAlertEventParams{
+			AlertID: id,
+			Type:    types.EventTriggered,
+			Price:   price,
+		})
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// send to kafka
+	err = c.producer.Send(fmt.Sprint(id), price)
+	if err != nil {
+		return err
+	}
+
+	return cache.PublishAlertEvent(ctx, c.cache, types.AlertEvent{
+		AlertID: alert.ID,
+		UserID:  alert.UserID,
+		Status:  alert.Status,
+		Price:   price,
+		At:      time.Now(),
+	})
+}
@@ -0,0 +1,71 @@
+package watcher
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"alert-service/internal/cache"
+	"alert-service/internal/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memTargets records the prices alerts were compared at, by source
+type memTargets struct {
+	cache.Cacher
+
+	mu     sync.Mutex
+	prices map[string][]string
+}
+
+func (m *memTargets) GetTargets(_ context.Context, _ types.Currency, source string, direction bool, _, max float64) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// both directions are asked at every price, the range of the alerts above it ends at the price
+	if direction {
+		m.prices[source] = append(m.prices[source], strconv.FormatFloat(max, 'f', -1, 64))
+	}
+	return nil, nil
+}
+
+func TestPerTradeReplay(t *testing.T) {
+	// the second trade is only the price for a moment, a replay at full speed still compares it
+	start := time.Now()
+	feed := &sliceFeed{trades: []Trade{
+		{Source: types.SourceBinance, Pair: types.BTC, Price: "100", Quantity: "1", Time: start},
+		{Source: types.SourceBinance, Pair: types.BTC, Price: "105", Quantity: "1", Time: start.Add(time.Millisecond)},
+		{Source: types.SourceBinance, Pair: types.BTC, Price: "100", Quantity: "1", Time: start.Add(2 * time.Millisecond)},
+	}}
+	targets := &memTargets{prices: make(map[string][]string)}
+
+	c, err := NewCryptoWatcher(feed, WatcherConfig{
+		Sources:    []string{types.SourceBinance},
+		Currencies: []types.Currency{types.BTC},
+		Guard: GuardConfig{
+			MaxStaleness:      time.Minute,
+			MaxJumpPercent:    10,
+			JumpConfirmations: 3,
+		},
+		Consensus: ConsensusConfig{
+			Method:               ConsensusMedian,
+			MinSources:           1,
+			MaxDivergencePercent: 1,
+			VolumeWindow:         time.Minute,
+		},
+		CompareInterval: time.Hour,
+		TickerInterval:  time.Hour,
+		PerTrade:        true,
+	}, targets, nil, nil)
+	assert.NoError(t, err)
+	defer c.Close()
+
+	c.fillMarket(context.Background())
+
+	want := []string{"100", "105", "100"}
+	assert.Equal(t, want, targets.prices[types.SourceBinance])
+	assert.Len(t, targets.prices[types.SourceConsensus], len(want))
+}
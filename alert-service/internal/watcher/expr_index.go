@@ -0,0 +1,84 @@
+package watcher
+
+import (
+	"alert-service/internal/expression"
+	"alert-service/internal/types"
+)
+
+import "sync"
+
+// exprIndex keeps the compiled expression alerts the watcher evaluates, indexed by
+// the pairs they reference so a price change only re-checks the alerts that depend on it
+type exprIndex struct {
+	mu     sync.RWMutex
+	exprs  map[int64]*expression.Expr
+	byPair map[types.Currency]map[int64]struct{}
+}
+
+func newExprIndex() *exprIndex {
+	return &exprIndex{
+		exprs:  make(map[int64]*expression.Expr),
+		byPair: make(map[types.Currency]map[int64]struct{}),
+	}
+}
+
+func (x *exprIndex) Add(id int64, expr *expression.Expr) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.exprs[id] = expr
+	for _, pair := range expr.Pairs() {
+		if x.byPair[pair] == nil {
+			x.byPair[pair] = make(map[int64]struct{})
+		}
+		x.byPair[pair][id] = struct{}{}
+	}
+}
+
+func (x *exprIndex) Remove(id int64) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	expr, ok := x.exprs[id]
+	if !ok {
+		return
+	}
+
+	delete(x.exprs, id)
+	for _, pair := range expr.Pairs() {
+		delete(x.byPair[pair], id)
+	}
+}
+
+func (x *exprIndex) Has(id int64) bool {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	_, ok := x.exprs[id]
+	return ok
+}
+
+func (x *exprIndex) IDs() []int64 {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	ids := make([]int64, 0, len(x.exprs))
+	for id := range x.exprs {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Referencing returns the alerts that depend on any of the changed pairs, each alert once
+func (x *exprIndex) Referencing(changed []types.Currency) map[int64]*expression.Expr {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	res := make(map[int64]*expression.Expr)
+	for _, pair := range changed {
+		for id := range x.byPair[pair] {
+			res[id] = x.exprs[id]
+		}
+	}
+	return res
+}
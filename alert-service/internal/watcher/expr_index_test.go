@@ -0,0 +1,28 @@
+package watcher
+
+import (
+	"testing"
+
+	"alert-service/internal/expression"
+	"alert-service/internal/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExprIndex(t *testing.T) {
+	index := newExprIndex()
+
+	both, _ := expression.ParseExpr("btcusdt > 1 && ethusdt > 1")
+	sol, _ := expression.ParseExpr("solusdt > 1")
+	index.Add(1, both)
+	index.Add(2, sol)
+
+	assert.Len(t, index.Referencing([]types.Currency{types.BTC}), 1)
+	assert.Len(t, index.Referencing([]types.Currency{types.BTC, types.ETH}), 1)
+	assert.Len(t, index.Referencing([]types.Currency{types.ETH, types.SOL}), 2)
+
+	index.Remove(1)
+	assert.Empty(t, index.Referencing([]types.Currency{types.BTC, types.ETH}))
+	assert.False(t, index.Has(1))
+	assert.True(t, index.Has(2))
+}
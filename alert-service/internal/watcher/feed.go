@@ -0,0 +1,406 @@
+package watcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"alert-service/internal/logger"
+	"alert-service/internal/types"
+
+	"nhooyr.io/websocket"
+)
+
+// Trade is a single print from a market data feed
+type Trade struct {
+	Source   string         `json:"source,omitempty"`
+	Pair     types.Currency `json:"pair"`
+	Price    string         `json:"price"`
+	Quantity string         `json:"quantity"`
+	Time     time.Time      `json:"time"`
+}
+
+// pauses between attempts to read a failing feed or to reconnect to an exchange, doubled after every
+// failure
+const (
+	minFeedBackoff = 100 * time.Millisecond
+	maxFeedBackoff = 30 * time.Second
+)
+
+// errDisconnected wraps the errors of an exchange connection that is gone, the feed is dialed again
+var errDisconnected = errors.New("feed disconnected")
+
+// Feed is a source of trades for the watcher, the live exchange stream or a recording
+type Feed interface {
+	// Next blocks until the next trade, io.EOF means the feed has no more trades
+	Next(ctx context.Context) (Trade, error)
+	Close() error
+}
+
+type SubscribeResponse struct {
+	Result interface{} `json:"result"`
+	Id     int         `json:"id"`
+}
+
+type StreamData struct {
+	Price     string `json:"p"`
+	Quantity  string `json:"q"`
+	TradeTime int64  `json:"T"`
+}
+
+type StreamResponse struct {
+	Stream string     `json:"stream"`
+	Data   StreamData `json:"data"`
+}
+
+// binanceFeed reads trades of the subscribed pairs from the binance combined stream
+type binanceFeed struct {
+	ws *websocket.Conn
+}
+
+func NewBinanceFeed(ctx context.Context, currencies []types.Currency) (Feed, error) {
+	c, _, err := websocket.Dial(ctx, "wss://stream.binance.com/stream", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// prepring subscribe request payload
+	subscribePayload := map[string]interface{}{
+		"method": "SUBSCRIBE",
+		"params": currencies,
+		"id":     1,
+	}
+	payloadBytes, err := json.Marshal(subscribePayload)
+	if err != nil {
+		return nil, err
+	}
+
+	// sending subscribe request
+	err = c.Write(ctx, websocket.MessageText, payloadBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	// reading subscribe response and checking if subscription was successful
+	_, p, err := c.Read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var pubResponse SubscribeResponse
+	err = json.Unmarshal(p, &pubResponse)
+	if err != nil {
+		return nil, err
+	}
+	log.Println(pubResponse)
+	if pubResponse.Result != nil {
+		return nil, types.ErrSubscriptionFailed
+	}
+
+	return &binanceFeed{
+		ws: c,
+	}, nil
+}
+
+func (b *binanceFeed) Next(ctx context.Context) (Trade, error) {
+	_, p, err := b.ws.Read(ctx)
+	if err != nil {
+		return Trade{}, fmt.Errorf("%w: %w", errDisconnected, err)
+	}
+
+	var streamResponse StreamResponse
+	err = json.Unmarshal(p, &streamResponse)
+	if err != nil {
+		return Trade{}, err
+	}
+
+	trade := Trade{
+		Source:   types.SourceBinance,
+		Pair:     types.Currency(streamResponse.Stream),
+		Price:    streamResponse.Data.Price,
+		Quantity: streamResponse.Data.Quantity,
+	}
+	// messages without a trade time are not trades
+	if streamResponse.Data.TradeTime != 0 {
+		trade.Time = time.UnixMilli(streamResponse.Data.TradeTime)
+	}
+	return trade, nil
+}
+
+func (b *binanceFeed) Close() error {
+	return b.ws.Close(websocket.StatusNormalClosure, "")
+}
+
+type coinbaseMatch struct {
+	Type      string    `json:"type"`
+	ProductID string    `json:"product_id"`
+	Price     string    `json:"price"`
+	Size      string    `json:"size"`
+	Time      time.Time `json:"time"`
+	Message   string    `json:"message"`
+}
+
+// coinbaseFeed reads trades of the subscribed pairs from the coinbase matches channel
+type coinbaseFeed struct {
+	ws *websocket.Conn
+}
+
+func NewCoinbaseFeed(ctx context.Context, currencies []types.Currency) (Feed, error) {
+	c, _, err := websocket.Dial(ctx, "wss://ws-feed.exchange.coinbase.com", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	products := make([]string, 0, len(currencies))
+	for _, curr := range currencies {
+		products = append(products, coinbaseProduct(curr))
+	}
+	subscribePayload := map[string]interface{}{
+		"type":        "subscribe",
+		"product_ids": products,
+		"channels":    []string{"matches"},
+	}
+	payloadBytes, err := json.Marshal(subscribePayload)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.Write(ctx, websocket.MessageText, payloadBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &coinbaseFeed{
+		ws: c,
+	}, nil
+}
+
+func (f *coinbaseFeed) Next(ctx context.Context) (Trade, error) {
+	_, p, err := f.ws.Read(ctx)
+	if err != nil {
+		return Trade{}, fmt.Errorf("%w: %w", errDisconnected, err)
+	}
+
+	var match coinbaseMatch
+	err = json.Unmarshal(p, &match)
+	if err != nil {
+		return Trade{}, err
+	}
+
+	switch match.Type {
+	case "match", "last_match":
+		pair, ok := types.ParsePair(strings.ReplaceAll(match.ProductID, "-", ""))
+		if !ok {
+			return Trade{}, fmt.Errorf("coinbase sent unknown product %q", match.ProductID)
+		}
+		return Trade{
+			Source:   types.SourceCoinbase,
+			Pair:     pair,
+			Price:    match.Price,
+			Quantity: match.Size,
+			Time:     match.Time,
+		}, nil
+
+	case "error":
+		return Trade{}, fmt.Errorf("%w: %s", types.ErrSubscriptionFailed, match.Message)
+	}
+
+	// subscription acks and heartbeats are not trades
+	return Trade{Source: types.SourceCoinbase}, nil
+}
+
+func (f *coinbaseFeed) Close() error {
+	return f.ws.Close(websocket.StatusNormalClosure, "")
+}
+
+// coinbaseProduct turns "btcusdt@trade" into "BTC-USDT"
+func coinbaseProduct(curr types.Currency) string {
+	name := strings.ToUpper(types.PairName(curr))
+	return strings.TrimSuffix(name, "USDT") + "-USDT"
+}
+
+// redialFeed connects to an exchange again whenever its connection drops, waiting longer after every
+// attempt that fails
+type redialFeed struct {
+	source string
+	dial   func(ctx context.Context) (Feed, error)
+
+	mu     sync.Mutex
+	feed   Feed
+	closed bool
+}
+
+// NewRedialFeed dials the exchange once, a first connection that fails is returned as an error
+func NewRedialFeed(ctx context.Context, source string, dial func(ctx context.Context) (Feed, error)) (Feed, error) {
+	feed, err := dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &redialFeed{
+		source: source,
+		dial:   dial,
+		feed:   feed,
+	}, nil
+}
+
+func (f *redialFeed) Next(ctx context.Context) (Trade, error) {
+	for {
+		feed, closed := f.current()
+		if closed {
+			return Trade{}, io.EOF
+		}
+
+		trade, err := feed.Next(ctx)
+		if !errors.Is(err, errDisconnected) || ctx.Err() != nil {
+			return trade, err
+		}
+		// closing the feed drops the connection too
+		if _, closed := f.current(); closed {
+			return Trade{}, io.EOF
+		}
+
+		err = f.redial(ctx, feed, err)
+		if err != nil {
+			return Trade{}, err
+		}
+	}
+}
+
+func (f *redialFeed) current() (Feed, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.feed, f.closed
+}
+
+// redial replaces the dropped feed, it gives up only when ctx is done or the feed is closed
+func (f *redialFeed) redial(ctx context.Context, dropped Feed, cause error) error {
+	dropped.Close()
+
+	var backoff time.Duration
+	for {
+		backoff = min(max(2*backoff, minFeedBackoff), maxFeedBackoff)
+		logger.Warn().
+			Str("source", f.source).
+			Str("err", cause.Error()).
+			Str("retry_in", backoff.String()).
+			Str("msg", "reconnecting feed").
+			Send()
+		metricFeedRedials.Add(f.source, 1)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		feed, err := f.dial(ctx)
+		if err != nil {
+			cause = err
+			continue
+		}
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.closed {
+			feed.Close()
+			return io.EOF
+		}
+		f.feed = feed
+		return nil
+	}
+}
+
+func (f *redialFeed) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.closed = true
+	return f.feed.Close()
+}
+
+// multiFeed merges the trades of several exchanges into one feed
+type multiFeed struct {
+	feeds   []Feed
+	results chan feedResult
+	done    chan struct{}
+	closed  chan struct{}
+	once    sync.Once
+}
+
+type feedResult struct {
+	trade Trade
+	err   error
+}
+
+func NewMultiFeed(ctx context.Context, feeds ...Feed) Feed {
+	f := &multiFeed{
+		feeds:   feeds,
+		results: make(chan feedResult),
+		done:    make(chan struct{}),
+		closed:  make(chan struct{}),
+	}
+
+	var wg sync.WaitGroup
+	for _, feed := range feeds {
+		wg.Add(1)
+		go func(feed Feed) {
+			defer wg.Done()
+			f.read(ctx, feed)
+		}(feed)
+	}
+	go func() {
+		wg.Wait()
+		close(f.done)
+	}()
+
+	return f
+}
+
+// read forwards the trades of a single feed until it runs out or the merged feed is closed
+func (f *multiFeed) read(ctx context.Context, feed Feed) {
+	for {
+		trade, err := feed.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			return
+		}
+
+		select {
+		case f.results <- feedResult{trade, err}:
+		case <-f.closed:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (f *multiFeed) Next(ctx context.Context) (Trade, error) {
+	select {
+	case res := <-f.results:
+		return res.trade, res.err
+	case <-f.done:
+		return Trade{}, io.EOF
+	case <-ctx.Done():
+		return Trade{}, ctx.Err()
+	}
+}
+
+func (f *multiFeed) Close() error {
+	var errs []error
+	f.once.Do(func() {
+		close(f.closed)
+		for _, feed := range f.feeds {
+			errs = append(errs, feed.Close())
+		}
+	})
+	return errors.Join(errs...)
+}
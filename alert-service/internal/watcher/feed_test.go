@@ -0,0 +1,50 @@
+package watcher
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"alert-service/internal/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// droppingFeed hands out its trades and then loses its connection
+type droppingFeed struct {
+	sliceFeed
+}
+
+func (f *droppingFeed) Next(ctx context.Context) (Trade, error) {
+	trade, err := f.sliceFeed.Next(ctx)
+	if err == io.EOF {
+		return Trade{}, errDisconnected
+	}
+	return trade, err
+}
+
+func TestRedialFeed(t *testing.T) {
+	dials := 0
+	feed, err := NewRedialFeed(context.Background(), types.SourceBinance, func(ctx context.Context) (Feed, error) {
+		dials++
+		if dials == 2 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return &droppingFeed{sliceFeed{trades: []Trade{{Price: "1"}}}}, nil
+	})
+	assert.NoError(t, err)
+
+	// the dropped connection is dialed again until it comes back, the failed dial in between is retried
+	for i := 0; i < 2; i++ {
+		trade, err := feed.Next(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "1", trade.Price)
+	}
+	assert.Equal(t, 3, dials)
+
+	// a closed feed is not dialed again
+	assert.NoError(t, feed.Close())
+	_, err = feed.Next(context.Background())
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, 3, dials)
+}
@@ -0,0 +1,235 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"alert-service/internal/logger"
+	"alert-service/internal/types"
+)
+
+var (
+	ErrInvalidPrice = errors.New("invalid price")
+	ErrPriceOutlier = errors.New("price outlier")
+)
+
+// GuardConfig decides when a pair is trusted enough to fire alerts
+type GuardConfig struct {
+	// a pair without an accepted trade for longer than this is paused
+	MaxStaleness time.Duration `env:"PRICE_MAX_STALENESS" default:"10s"`
+	// a pair whose exchange event time is further behind the receive time than this is paused,
+	// zero disables the check which replays need since their event times are in the past
+	MaxLag time.Duration `env:"PRICE_MAX_LAG" default:"10s"`
+	// a trade moving the price by more than this percent from the last accepted one is an outlier
+	MaxJumpPercent float64 `env:"PRICE_MAX_JUMP_PERCENT" default:"10"`
+	// consecutive outliers that agree with each other before they are taken as the new price
+	JumpConfirmations int `env:"PRICE_JUMP_CONFIRMATIONS" default:"3"`
+}
+
+func (cfg *GuardConfig) Validate() error {
+	switch {
+	case cfg.MaxStaleness <= 0:
+		return fmt.Errorf("invalid PRICE_MAX_STALENESS %s", cfg.MaxStaleness)
+	case cfg.MaxLag < 0:
+		return fmt.Errorf("invalid PRICE_MAX_LAG %s", cfg.MaxLag)
+	case cfg.MaxJumpPercent <= 0:
+		return fmt.Errorf("invalid PRICE_MAX_JUMP_PERCENT %v", cfg.MaxJumpPercent)
+	case cfg.JumpConfirmations < 1:
+		return fmt.Errorf("invalid PRICE_JUMP_CONFIRMATIONS %d", cfg.JumpConfirmations)
+	}
+	return nil
+}
+
+// priceGuard sits between the feed and the market, it drops garbage prices and tracks per pair
+// whether the last accepted price can still be trusted to fire alerts
+type priceGuard struct {
+	cfg GuardConfig
+
+	mu    sync.Mutex
+	pairs map[quoteKey]*pairState
+}
+
+// quoteKey is a pair as quoted by one exchange
+type quoteKey struct {
+	source string
+	pair   types.Currency
+}
+
+type pairState struct {
+	// last accepted trade
+	price      float64
+	eventTime  time.Time
+	receivedAt time.Time
+
+	// outliers seen in a row and the first of them, a jump that holds becomes the new price
+	outliers     int
+	outlierPrice float64
+}
+
+func newPriceGuard(cfg GuardConfig, sources []string, currencies []types.Currency) *priceGuard {
+	pairs := make(map[quoteKey]*pairState, len(sources)*len(currencies))
+	for _, source := range sources {
+		for _, curr := range currencies {
+			pairs[quoteKey{source, curr}] = &pairState{}
+		}
+	}
+
+	return &priceGuard{
+		cfg:   cfg,
+		pairs: pairs,
+	}
+}
+
+// Accept checks a trade received at now and returns its price when it may enter the market
+func (g *priceGuard) Accept(trade Trade, now time.Time) (float64, error) {
+	price, err := strconv.ParseFloat(trade.Price, 64)
+	if err != nil || price <= 0 || math.IsInf(price, 0) || math.IsNaN(price) {
+		return 0, fmt.Errorf("%w %q for %s on %s", ErrInvalidPrice, trade.Price, types.PairName(trade.Pair), trade.Source)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	state, ok := g.pairs[quoteKey{trade.Source, trade.Pair}]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s is not enabled on %s", ErrInvalidPrice, types.PairName(trade.Pair), trade.Source)
+	}
+
+	if state.price > 0 && jumpPercent(state.price, price) > g.cfg.MaxJumpPercent {
+		// the outliers have to agree with each other, not just differ from the last price
+		if state.outliers == 0 || jumpPercent(state.outlierPrice, price) > g.cfg.MaxJumpPercent {
+			state.outliers = 0
+			state.outlierPrice = price
+		}
+		state.outliers++
+		if state.outliers < g.cfg.JumpConfirmations {
+			return 0, fmt.Errorf("%w %s for %s on %s, last %s", ErrPriceOutlier, trade.Price, types.PairName(trade.Pair),
+				trade.Source, strconv.FormatFloat(state.price, 'f', -1, 64))
+		}
+	}
+
+	state.price = price
+	state.eventTime = trade.Time
+	state.receivedAt = now
+	state.outliers = 0
+	return price, nil
+}
+
+// Paused returns why the price of a pair on an exchange must not fire alerts at now, or an empty
+// string when it may
+func (g *priceGuard) Paused(source string, curr types.Currency, now time.Time) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	state, ok := g.pairs[quoteKey{source, curr}]
+	if !ok {
+		return "source not enabled"
+	}
+	return g.paused(state, now)
+}
+
+func (g *priceGuard) paused(state *pairState, now time.Time) string {
+	switch {
+	case state.receivedAt.IsZero():
+		return "waiting for first trade"
+
+	case state.outliers > 0:
+		return "unconfirmed price jump"
+
+	case now.Sub(state.receivedAt) > g.cfg.MaxStaleness:
+		return fmt.Sprintf("no trade for %s", now.Sub(state.receivedAt).Truncate(time.Second))
+
+	case g.cfg.MaxLag > 0 && !state.eventTime.IsZero() && state.receivedAt.Sub(state.eventTime) > g.cfg.MaxLag:
+		return fmt.Sprintf("exchange lagging by %s", state.receivedAt.Sub(state.eventTime).Truncate(time.Millisecond))
+	}
+	return ""
+}
+
+// Health reports every paused pair at now
+func (g *priceGuard) Health(now time.Time) types.WatcherHealth {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	health := types.WatcherHealth{
+		Status:    types.HealthOK,
+		CheckedAt: now,
+		Paused:    []types.PausedPair{},
+	}
+	for key, state := range g.pairs {
+		reason := g.paused(state, now)
+		if reason == "" {
+			continue
+		}
+
+		health.Status = types.HealthDegraded
+		health.Paused = append(health.Paused, types.PausedPair{
+			Pair:      types.PairName(key.pair),
+			Source:    key.source,
+			Reason:    reason,
+			LastTrade: state.receivedAt,
+			EventTime: state.eventTime,
+		})
+	}
+	types.SortPaused(health.Paused)
+
+	return health
+}
+
+func jumpPercent(from, to float64) float64 {
+	return math.Abs(to-from) / from * 100
+}
+
+// watchHealth publishes the guard state for the api and logs whenever evaluation of a pair is
+// paused or resumed
+func (c *cryptoWatcher) watchHealth(ctx context.Context) {
+	ticker := time.NewTicker(types.HealthInterval)
+	defer ticker.Stop()
+
+	// paused pairs by pair and source only
+	paused := make(map[types.PausedPair]struct{})
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+			health := c.health(time.Now())
+
+			now := make(map[types.PausedPair]struct{}, len(health.Paused))
+			for _, p := range health.Paused {
+				key := types.PausedPair{Pair: p.Pair, Source: p.Source}
+				now[key] = struct{}{}
+				if _, ok := paused[key]; !ok {
+					logger.Warn().
+						Str("pair", p.Pair).
+						Str("source", p.Source).
+						Str("reason", p.Reason).
+						Str("msg", "alert evaluation paused").
+						Send()
+				}
+			}
+			for p := range paused {
+				if _, ok := now[p]; !ok {
+					logger.Info().
+						Str("pair", p.Pair).
+						Str("source", p.Source).
+						Str("msg", "alert evaluation resumed").
+						Send()
+				}
+			}
+			paused = now
+
+			health.Instance = c.instance
+			health.Pairs = types.PairNames(c.currencies)
+			err := c.cache.SetHealth(ctx, c.instance, health)
+			if err != nil {
+				c.errch <- err
+			}
+		}
+	}
+}
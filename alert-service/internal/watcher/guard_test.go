@@ -0,0 +1,68 @@
+package watcher
+
+import (
+	"testing"
+	"time"
+
+	"alert-service/internal/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPriceGuard(t *testing.T) {
+	cfg := GuardConfig{
+		MaxStaleness:      10 * time.Second,
+		MaxLag:            2 * time.Second,
+		MaxJumpPercent:    10,
+		JumpConfirmations: 3,
+	}
+	g := newPriceGuard(cfg, []string{types.SourceBinance}, []types.Currency{types.BTC})
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, "waiting for first trade", g.Paused(types.SourceBinance, types.BTC, now))
+
+	// garbage never enters the market
+	for _, p := range []string{"", "0", "-1", "abc", "NaN"} {
+		_, err := g.Accept(Trade{Source: types.SourceBinance, Pair: types.BTC, Price: p, Time: now}, now)
+		assert.ErrorIs(t, err, ErrInvalidPrice, p)
+	}
+
+	price, err := g.Accept(Trade{Source: types.SourceBinance, Pair: types.BTC, Price: "100", Time: now}, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 100.0, price)
+	assert.Empty(t, g.Paused(types.SourceBinance, types.BTC, now))
+
+	// a single bad print is rejected and pauses the pair until it is confirmed or undone
+	_, err = g.Accept(Trade{Source: types.SourceBinance, Pair: types.BTC, Price: "1", Time: now}, now)
+	assert.ErrorIs(t, err, ErrPriceOutlier)
+	assert.Equal(t, "unconfirmed price jump", g.Paused(types.SourceBinance, types.BTC, now))
+
+	_, err = g.Accept(Trade{Source: types.SourceBinance, Pair: types.BTC, Price: "101", Time: now}, now)
+	assert.NoError(t, err)
+	assert.Empty(t, g.Paused(types.SourceBinance, types.BTC, now))
+
+	// a jump that holds becomes the new price
+	for i := 0; i < 2; i++ {
+		_, err = g.Accept(Trade{Source: types.SourceBinance, Pair: types.BTC, Price: "150", Time: now}, now)
+		assert.ErrorIs(t, err, ErrPriceOutlier)
+	}
+	price, err = g.Accept(Trade{Source: types.SourceBinance, Pair: types.BTC, Price: "151", Time: now}, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 151.0, price)
+
+	assert.Equal(t, "no trade for 11s", g.Paused(types.SourceBinance, types.BTC, now.Add(11*time.Second)))
+
+	_, err = g.Accept(Trade{Source: types.SourceBinance, Pair: types.BTC, Price: "151", Time: now}, now.Add(3*time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, "exchange lagging by 3s", g.Paused(types.SourceBinance, types.BTC, now.Add(3*time.Second)))
+
+	health := g.Health(now.Add(3 * time.Second))
+	assert.Equal(t, types.HealthDegraded, health.Status)
+	assert.Len(t, health.Paused, 1)
+	assert.Equal(t, "btcusdt", health.Paused[0].Pair)
+	assert.Equal(t, types.SourceBinance, health.Paused[0].Source)
+
+	// exchanges that are not enabled never reach the market
+	_, err = g.Accept(Trade{Source: types.SourceCoinbase, Pair: types.BTC, Price: "151", Time: now}, now)
+	assert.ErrorIs(t, err, ErrInvalidPrice)
+}
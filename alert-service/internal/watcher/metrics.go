@@ -0,0 +1,33 @@
+package watcher
+
+import "expvar"
+
+// watcher metrics, served as json at /debug/vars
+var (
+	// trades dropped by the price guard, by reason
+	metricTradesRejected = expvar.NewMap("trades_rejected")
+
+	// times the connection to an exchange was dialed again, by source
+	metricFeedRedials = expvar.NewMap("feed_redials_total")
+
+	// times an exchange was further from the consensus than allowed, by pair/source
+	metricSourceDivergence = expvar.NewMap("consensus_divergence_total")
+
+	// last distance of an exchange from the consensus in percent, by pair/source
+	metricSourceSpread = newGaugeMap("consensus_spread_percent")
+)
+
+// gaugeMap is an expvar map of floats that are overwritten instead of added to
+type gaugeMap struct {
+	*expvar.Map
+}
+
+func newGaugeMap(name string) gaugeMap {
+	return gaugeMap{expvar.NewMap(name)}
+}
+
+func (m gaugeMap) Set(key string, value float64) {
+	f := new(expvar.Float)
+	f.Set(value)
+	m.Map.Set(key, f)
+}
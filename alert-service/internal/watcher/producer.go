@@ -1,6 +1,8 @@
-package main
+package watcher
 
 import (
+	"alert-service/internal/logger"
+
 	"github.com/IBM/sarama"
 )
 
@@ -0,0 +1,297 @@
+package watcher
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"alert-service/internal/logger"
+	"alert-service/internal/types"
+)
+
+// Recordings are either json lines of Trade or csv rows of time,pair,price,quantity[,source] where
+// time is RFC3339 or unix milliseconds. The format is picked from the file extension, ".csv" or
+// anything else for json lines. Trades recorded before sources existed are binance trades.
+
+const maxReplaySpeed = 0
+
+// parseReplaySpeed reads "real" (1x), "max" (no pacing) or an acceleration factor such as "10" or "10x"
+func parseReplaySpeed(s string) (float64, error) {
+	switch strings.ToLower(s) {
+	case "", "max":
+		return maxReplaySpeed, nil
+	case "real":
+		return 1, nil
+	}
+
+	speed, err := strconv.ParseFloat(strings.TrimSuffix(strings.ToLower(s), "x"), 64)
+	if err != nil || speed <= 0 {
+		return 0, fmt.Errorf("invalid replay speed %q", s)
+	}
+	return speed, nil
+}
+
+// replayFeed plays back a recording, paced by the recorded trade times divided by speed
+type replayFeed struct {
+	file  *os.File
+	read  func() (Trade, error)
+	speed float64
+
+	// first trade time and the wall clock time it was replayed at
+	base    time.Time
+	started time.Time
+}
+
+func NewReplayFeed(path string, speed float64) (Feed, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &replayFeed{
+		file:  file,
+		speed: speed,
+	}
+
+	if isCSV(path) {
+		r := csv.NewReader(bufio.NewReader(file))
+		r.FieldsPerRecord = -1
+		r.ReuseRecord = true
+		f.read = func() (Trade, error) {
+			record, err := r.Read()
+			if err != nil {
+				return Trade{}, err
+			}
+			return parseTradeRecord(record)
+		}
+	} else {
+		dec := json.NewDecoder(bufio.NewReader(file))
+		f.read = func() (Trade, error) {
+			var trade Trade
+			err := dec.Decode(&trade)
+			return trade, err
+		}
+	}
+
+	return f, nil
+}
+
+func (f *replayFeed) Next(ctx context.Context) (Trade, error) {
+	trade, err := f.read()
+	if err != nil {
+		return Trade{}, err
+	}
+
+	pair, ok := types.ParsePair(string(trade.Pair))
+	if !ok {
+		return Trade{}, fmt.Errorf("recording has unknown pair %q", trade.Pair)
+	}
+	trade.Pair = pair
+	if trade.Source == "" {
+		trade.Source = types.SourceBinance
+	}
+
+	if f.speed == maxReplaySpeed || trade.Time.IsZero() {
+		return trade, nil
+	}
+
+	if f.base.IsZero() {
+		f.base = trade.Time
+		f.started = time.Now()
+		return trade, nil
+	}
+
+	// wait until the trade is due relative to the first one
+	due := f.started.Add(time.Duration(float64(trade.Time.Sub(f.base)) / f.speed))
+	wait := time.Until(due)
+	if wait <= 0 {
+		return trade, nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return Trade{}, ctx.Err()
+	case <-timer.C:
+		return trade, nil
+	}
+}
+
+func (f *replayFeed) Close() error {
+	return f.file.Close()
+}
+
+// recordingFeed passes trades of another feed through while appending them to a recording
+type recordingFeed struct {
+	Feed
+
+	mu    sync.Mutex
+	file  *os.File
+	buf   *bufio.Writer
+	write func(Trade) error
+}
+
+func NewRecordingFeed(feed Feed, path string) (Feed, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &recordingFeed{
+		Feed: feed,
+		file: file,
+		buf:  bufio.NewWriter(file),
+	}
+
+	if isCSV(path) {
+		w := csv.NewWriter(f.buf)
+		f.write = func(trade Trade) error {
+			err := w.Write([]string{
+				trade.Time.UTC().Format(time.RFC3339Nano),
+				types.PairName(trade.Pair),
+				trade.Price,
+				trade.Quantity,
+				trade.Source,
+			})
+			w.Flush()
+			return err
+		}
+	} else {
+		enc := json.NewEncoder(f.buf)
+		f.write = func(trade Trade) error {
+			trade.Pair = types.Currency(types.PairName(trade.Pair))
+			return enc.Encode(trade)
+		}
+	}
+
+	return f, nil
+}
+
+func (f *recordingFeed) Next(ctx context.Context) (Trade, error) {
+	trade, err := f.Feed.Next(ctx)
+	if err != nil || trade.Time.IsZero() {
+		return trade, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// a failing recording must not hold back the live trade
+	if err := f.write(trade); err != nil {
+		logger.Error().Str("err", err.Error()).Str("msg", "recording trade").Send()
+	}
+	return trade, nil
+}
+
+func (f *recordingFeed) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return errors.Join(f.Feed.Close(), f.buf.Flush(), f.file.Close())
+}
+
+func isCSV(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".csv")
+}
+
+func parseTradeRecord(record []string) (Trade, error) {
+	if len(record) != 4 && len(record) != 5 {
+		return Trade{}, fmt.Errorf("trade record has %d fields, want 4 or 5", len(record))
+	}
+
+	var at time.Time
+	if ms, err := strconv.ParseInt(record[0], 10, 64); err == nil {
+		at = time.UnixMilli(ms)
+	} else {
+		at, err = time.Parse(time.RFC3339Nano, record[0])
+		if err != nil {
+			return Trade{}, fmt.Errorf("invalid trade time %q: %w", record[0], err)
+		}
+	}
+
+	trade := Trade{
+		Time:     at,
+		Pair:     types.Currency(record[1]),
+		Price:    record[2],
+		Quantity: record[3],
+	}
+	if len(record) == 5 {
+		trade.Source = record[4]
+	}
+	return trade, nil
+}
+
+// FeedConfig picks where trades come from, the live streams of exchanges or a recording to replay
+type FeedConfig struct {
+	Sources     []string `env:"FEED_SOURCES" default:"binance"`
+	ReplayFile  string   `env:"FEED_REPLAY_FILE"`
+	ReplaySpeed string   `env:"FEED_REPLAY_SPEED"`
+	// whatever is read is also appended to this recording
+	RecordFile string `env:"FEED_RECORD_FILE"`
+}
+
+func (cfg *FeedConfig) Validate() error {
+	sources, err := types.ParseSources(cfg.Sources)
+	if err != nil {
+		return err
+	}
+	cfg.Sources = sources
+
+	_, err = parseReplaySpeed(cfg.ReplaySpeed)
+	return err
+}
+
+// NewFeed opens the market data source of the config: a recording to replay or the live streams
+// of its exchanges, optionally recording whatever it reads
+func NewFeed(ctx context.Context, cfg FeedConfig, currencies []types.Currency) (Feed, error) {
+	var feed Feed
+	if cfg.ReplayFile != "" {
+		speed, err := parseReplaySpeed(cfg.ReplaySpeed)
+		if err != nil {
+			return nil, err
+		}
+		feed, err = NewReplayFeed(cfg.ReplayFile, speed)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		feeds := make([]Feed, 0, len(cfg.Sources))
+		for _, source := range cfg.Sources {
+			var dial func(ctx context.Context) (Feed, error)
+			switch source {
+			case types.SourceBinance:
+				dial = func(ctx context.Context) (Feed, error) { return NewBinanceFeed(ctx, currencies) }
+			case types.SourceCoinbase:
+				dial = func(ctx context.Context) (Feed, error) { return NewCoinbaseFeed(ctx, currencies) }
+			}
+			f, err := NewRedialFeed(ctx, source, dial)
+			if err != nil {
+				for _, f := range feeds {
+					f.Close()
+				}
+				return nil, fmt.Errorf("connecting to %s: %w", source, err)
+			}
+			feeds = append(feeds, f)
+		}
+
+		feed = feeds[0]
+		if len(feeds) > 1 {
+			feed = NewMultiFeed(ctx, feeds...)
+		}
+	}
+
+	if cfg.RecordFile != "" {
+		return NewRecordingFeed(feed, cfg.RecordFile)
+	}
+	return feed, nil
+}
@@ -0,0 +1,89 @@
+package watcher
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"alert-service/internal/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// sliceFeed hands out a fixed list of trades
+type sliceFeed struct {
+	trades []Trade
+}
+
+func (f *sliceFeed) Next(ctx context.Context) (Trade, error) {
+	if len(f.trades) == 0 {
+		return Trade{}, io.EOF
+	}
+	trade := f.trades[0]
+	f.trades = f.trades[1:]
+	return trade, nil
+}
+
+func (f *sliceFeed) Close() error { return nil }
+
+func TestRecordAndReplay(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	trades := []Trade{
+		{Pair: types.BTC, Price: "70000.1", Quantity: "0.5", Time: start},
+		{Pair: types.ETH, Price: "4000", Quantity: "2", Time: start.Add(time.Second)},
+	}
+
+	for _, name := range []string{"trades.jsonl", "trades.csv"} {
+		path := filepath.Join(t.TempDir(), name)
+
+		recorder, err := NewRecordingFeed(&sliceFeed{trades: append([]Trade(nil), trades...)}, path)
+		assert.NoError(t, err)
+		for range trades {
+			_, err := recorder.Next(context.Background())
+			assert.NoError(t, err)
+		}
+		assert.NoError(t, recorder.Close())
+
+		replay, err := NewReplayFeed(path, maxReplaySpeed)
+		assert.NoError(t, err)
+		for _, want := range trades {
+			got, err := replay.Next(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, want.Pair, got.Pair)
+			assert.Equal(t, want.Price, got.Price)
+			assert.Equal(t, want.Quantity, got.Quantity)
+			assert.True(t, want.Time.Equal(got.Time), name)
+		}
+		_, err = replay.Next(context.Background())
+		assert.ErrorIs(t, err, io.EOF)
+		assert.NoError(t, replay.Close())
+	}
+}
+
+func TestReplayPacing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trades.csv")
+	err := os.WriteFile(path, []byte("1704067200000,btcusdt,1,1\n1704067201000,btcusdt,2,1\n"), 0o644)
+	assert.NoError(t, err)
+
+	// one second of recording at 10x takes about 100ms
+	replay, err := NewReplayFeed(path, 10)
+	assert.NoError(t, err)
+
+	begin := time.Now()
+	_, err = replay.Next(context.Background())
+	assert.NoError(t, err)
+	_, err = replay.Next(context.Background())
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(begin), 90*time.Millisecond)
+
+	for s, want := range map[string]float64{"max": maxReplaySpeed, "real": 1, "10x": 10, "2.5": 2.5} {
+		speed, err := parseReplaySpeed(s)
+		assert.NoError(t, err)
+		assert.Equal(t, want, speed)
+	}
+	_, err = parseReplaySpeed("-1")
+	assert.Error(t, err)
+}
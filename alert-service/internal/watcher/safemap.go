@@ -0,0 +1,57 @@
+package watcher
+
+import (
+	"sync"
+	"time"
+
+	"alert-service/internal/types"
+)
+
+// Tick is the last trade the watcher has seen for a pair
+type Tick struct {
+	Price string
+	// exchange time of the trade
+	EventTime time.Time
+	// when the watcher received it
+	UpdatedAt time.Time
+	// traded quantity, decayed over the consensus volume window
+	Volume float64
+}
+
+type SafeMap struct {
+	mu   sync.RWMutex
+	data map[types.Currency]Tick
+}
+
+func NewSafeMap() *SafeMap {
+	return &SafeMap{
+		data: make(map[types.Currency]Tick),
+	}
+}
+
+func (m *SafeMap) Set(key types.Currency, value Tick) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.data[key] = value
+}
+
+func (m *SafeMap) Get(key types.Currency) (Tick, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	val, ok := m.data[key]
+	return val, ok
+}
+
+// Snapshot copies the whole market so several pairs can be read consistently
+func (m *SafeMap) Snapshot() map[types.Currency]Tick {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	snapshot := make(map[types.Currency]Tick, len(m.data))
+	for key, val := range m.data {
+		snapshot[key] = val
+	}
+	return snapshot
+}
@@ -0,0 +1,232 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"slices"
+	"time"
+
+	"alert-service/internal/cache"
+	"alert-service/internal/logger"
+	"alert-service/internal/types"
+)
+
+// ShardConfig identifies a watcher instance among the others sharing the pairs. A pair lease lives
+// this long without renewal, a dead instance's pairs move after at most the ttl.
+type ShardConfig struct {
+	Instance string        `env:"WATCHER_INSTANCE"`
+	LeaseTTL time.Duration `env:"WATCHER_LEASE_TTL" default:"15s"`
+}
+
+// Validate defaults the instance to the host name and pid so replicas never collide
+func (cfg *ShardConfig) Validate() error {
+	if cfg.LeaseTTL < time.Second {
+		return fmt.Errorf("invalid WATCHER_LEASE_TTL %s, want at least 1s", cfg.LeaseTTL)
+	}
+
+	if cfg.Instance == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			return err
+		}
+		cfg.Instance = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	return nil
+}
+
+// ShardCoordinator spreads the pairs across the live watcher instances through redis leases. Every
+// instance holds about pairs/instances leases, gives back surplus when instances join and picks up
+// the leases of instances that stop renewing them.
+type ShardCoordinator struct {
+	cfg        ShardConfig
+	cache      cache.Cacher
+	currencies []types.Currency
+
+	// pairs whose lease this instance holds and when that was last confirmed
+	owned     []types.Currency
+	renewedAt time.Time
+}
+
+func NewShardCoordinator(cfg ShardConfig, cache cache.Cacher, currencies []types.Currency) *ShardCoordinator {
+	// instances start probing at different pairs so they do not all race for the first one
+	h := fnv.New32a()
+	h.Write([]byte(cfg.Instance))
+	offset := int(h.Sum32() % uint32(len(currencies)))
+
+	return &ShardCoordinator{
+		cfg:        cfg,
+		cache:      cache,
+		currencies: append(slices.Clone(currencies[offset:]), currencies[:offset]...),
+	}
+}
+
+// Run keeps the leases balanced and runs watch for the owned pairs, restarting it whenever they
+// change. watch must return once its context is done.
+func (s *ShardCoordinator) Run(ctx context.Context, watch func(ctx context.Context, pairs []types.Currency) error) error {
+	ticker := time.NewTicker(s.cfg.LeaseTTL / 3)
+	defer ticker.Stop()
+
+	var running []types.Currency
+	var stop context.CancelFunc
+	var done chan error
+
+	stopWatching := func() error {
+		if stop == nil {
+			return nil
+		}
+		stop()
+		err := <-done
+		stop, done, running = nil, nil, nil
+		return err
+	}
+	defer s.leave()
+
+	for {
+		owned, err := s.balance(ctx)
+		if err != nil && ctx.Err() == nil {
+			logger.Error().Str("err", err.Error()).Str("msg", "balancing pair leases").Send()
+		}
+
+		if !slices.Equal(owned, running) {
+			logger.Info().
+				Str("instance", s.cfg.Instance).
+				Strs("pairs", types.PairNames(owned)).
+				Str("msg", "watched pairs changed").
+				Send()
+
+			err := stopWatching()
+			if err != nil && !errors.Is(err, context.Canceled) {
+				return err
+			}
+
+			if len(owned) > 0 {
+				wctx, cancel := context.WithCancel(ctx)
+				stop, done, running = cancel, make(chan error, 1), owned
+				go func(pairs []types.Currency, done chan<- error) {
+					done <- watch(wctx, pairs)
+				}(owned, done)
+			}
+		}
+
+		if len(running) == 0 {
+			// an idle instance is still alive, it just has nothing to watch
+			err := s.cache.SetHealth(ctx, s.cfg.Instance, types.WatcherHealth{
+				Status:    types.HealthOK,
+				CheckedAt: time.Now(),
+				Paused:    []types.PausedPair{},
+				Instance:  s.cfg.Instance,
+			})
+			if err != nil && ctx.Err() == nil {
+				logger.Error().Str("err", err.Error()).Send()
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			err := stopWatching()
+			if err != nil && !errors.Is(err, context.Canceled) {
+				return err
+			}
+			return ctx.Err()
+
+		case err := <-done:
+			// the watcher stopped on its own, the deferred leave hands its pairs to the other instances
+			stop()
+			if err == nil {
+				err = errors.New("watcher stopped")
+			}
+			return err
+
+		case <-ticker.C:
+		}
+	}
+}
+
+// balance renews the held leases, gives back what is above this instance's share and takes free
+// pairs up to it. The owned pairs are returned in a stable order.
+func (s *ShardCoordinator) balance(ctx context.Context) ([]types.Currency, error) {
+	live, err := s.cache.Heartbeat(ctx, s.cfg.Instance, s.cfg.LeaseTTL)
+	if err != nil {
+		return s.unconfirmed(), err
+	}
+	share := (len(s.currencies) + live - 1) / max(live, 1)
+
+	var owned []types.Currency
+	for _, curr := range s.owned {
+		ok, err := s.cache.RenewLease(ctx, types.PairName(curr), s.cfg.Instance, s.cfg.LeaseTTL)
+		if err != nil {
+			return s.unconfirmed(), err
+		}
+		if ok {
+			owned = append(owned, curr)
+		}
+	}
+	s.owned = owned
+	s.renewedAt = time.Now()
+
+	// surplus goes back so instances that just joined can pick it up
+	for len(s.owned) > share {
+		last := s.owned[len(s.owned)-1]
+		err := s.cache.ReleaseLease(ctx, types.PairName(last), s.cfg.Instance)
+		if err != nil {
+			return s.unconfirmed(), err
+		}
+		s.owned = s.owned[:len(s.owned)-1]
+	}
+
+	for _, curr := range s.currencies {
+		if len(s.owned) >= share {
+			break
+		}
+		if slices.Contains(s.owned, curr) {
+			continue
+		}
+
+		ok, err := s.cache.AcquireLease(ctx, types.PairName(curr), s.cfg.Instance, s.cfg.LeaseTTL)
+		if err != nil {
+			return s.unconfirmed(), err
+		}
+		if ok {
+			s.owned = append(s.owned, curr)
+		}
+	}
+
+	owned = slices.Clone(s.owned)
+	slices.Sort(owned)
+	return owned, nil
+}
+
+// unconfirmed is what is still safe to watch while redis cannot be reached, leases that were not
+// renewed within their ttl may already belong to another instance
+func (s *ShardCoordinator) unconfirmed() []types.Currency {
+	if time.Since(s.renewedAt) >= s.cfg.LeaseTTL {
+		s.owned = nil
+		return nil
+	}
+
+	owned := slices.Clone(s.owned)
+	slices.Sort(owned)
+	return owned
+}
+
+// leave gives back every lease so other instances take over right away instead of after the ttl
+func (s *ShardCoordinator) leave() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, curr := range s.owned {
+		err := s.cache.ReleaseLease(ctx, types.PairName(curr), s.cfg.Instance)
+		if err != nil {
+			logger.Error().Str("err", err.Error()).Str("pair", types.PairName(curr)).Send()
+		}
+	}
+	s.owned = nil
+
+	err := s.cache.RemoveInstance(ctx, s.cfg.Instance)
+	if err != nil {
+		logger.Error().Str("err", err.Error()).Send()
+	}
+}
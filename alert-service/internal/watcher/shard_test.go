@@ -0,0 +1,105 @@
+package watcher
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"alert-service/internal/cache"
+	"alert-service/internal/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memLeases keeps leases and heartbeats in memory, leases never expire on their own
+type memLeases struct {
+	cache.Cacher
+
+	mu        sync.Mutex
+	leases    map[string]string
+	instances map[string]bool
+}
+
+func newMemLeases() *memLeases {
+	return &memLeases{
+		leases:    make(map[string]string),
+		instances: make(map[string]bool),
+	}
+}
+
+func (m *memLeases) AcquireLease(_ context.Context, name string, owner string, _ time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.leases[name]; ok {
+		return false, nil
+	}
+	m.leases[name] = owner
+	return true, nil
+}
+
+func (m *memLeases) RenewLease(_ context.Context, name string, owner string, _ time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.leases[name] == owner, nil
+}
+
+func (m *memLeases) ReleaseLease(_ context.Context, name string, owner string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.leases[name] == owner {
+		delete(m.leases, name)
+	}
+	return nil
+}
+
+func (m *memLeases) Heartbeat(_ context.Context, instance string, _ time.Duration) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.instances[instance] = true
+	return len(m.instances), nil
+}
+
+func (m *memLeases) RemoveInstance(_ context.Context, instance string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.instances, instance)
+	return nil
+}
+
+func TestShardCoordinatorBalance(t *testing.T) {
+	ctx := context.Background()
+	cache := newMemLeases()
+	a := NewShardCoordinator(ShardConfig{Instance: "a", LeaseTTL: time.Minute}, cache, types.SupportedCurrencies)
+	b := NewShardCoordinator(ShardConfig{Instance: "b", LeaseTTL: time.Minute}, cache, types.SupportedCurrencies)
+
+	// alone, a takes every pair
+	owned, err := a.balance(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, owned, 3)
+
+	// b joins, a gives back its surplus and b picks it up
+	owned, err = b.balance(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, owned)
+
+	ownedA, err := a.balance(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, ownedA, 2)
+
+	ownedB, err := b.balance(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, ownedB, 1)
+	assert.NotContains(t, ownedA, ownedB[0])
+
+	// a leaves, b takes over everything
+	a.leave()
+	owned, err = b.balance(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, owned, 3)
+}
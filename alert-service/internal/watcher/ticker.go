@@ -0,0 +1,111 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	database "alert-service/database/sqlc"
+	"alert-service/internal/cache"
+	"alert-service/internal/types"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// publishTickers shares the in-memory market through redis, the api never talks to the watcher directly
+func (c *cryptoWatcher) publishTickers(ctx context.Context) {
+	ticker := time.NewTicker(c.tickerInterval)
+	defer ticker.Stop()
+
+	// the 24h reference price moves slowly, it is read from the stored candles once a minute
+	refresh := time.NewTicker(time.Minute)
+	defer refresh.Stop()
+
+	open24h := c.loadOpen24h(ctx)
+	// last trade time pushed to streams per pair, only moved pairs are pushed again
+	pushed := make(map[string]time.Time)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-refresh.C:
+			open24h = c.loadOpen24h(ctx)
+
+		case <-ticker.C:
+			tickers := c.buildTickers(open24h, time.Now())
+			err := c.cache.SetTickers(ctx, tickers)
+			if err != nil {
+				c.errch <- err
+			}
+
+			for _, t := range tickers {
+				if t.UpdatedAt.Equal(pushed[t.Pair]) {
+					continue
+				}
+				pushed[t.Pair] = t.UpdatedAt
+
+				err := cache.PublishTick(ctx, c.cache, t)
+				if err != nil {
+					c.errch <- err
+				}
+			}
+		}
+	}
+}
+
+// loadOpen24h reads the close of the last 1m candle at or before 24 hours ago for every pair
+func (c *cryptoWatcher) loadOpen24h(ctx context.Context) map[types.Currency]float64 {
+	open24h := make(map[types.Currency]float64, len(c.currencies))
+	for _, curr := range c.currencies {
+		params := database.GetCandleBeforeParams{
+			Pair:     types.PairName(curr),
+			Interval: "1m",
+			OpenTime: time.Now().Add(-24 * time.Hour),
+		}
+		candle, err := c.db.GetCandleBefore(ctx, params)
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			c.errch <- err
+			continue
+		}
+		open24h[curr] = candle.Close
+	}
+	return open24h
+}
+
+// buildTickers flags a pair stale while its consensus cannot fire alerts
+func (c *cryptoWatcher) buildTickers(open24h map[types.Currency]float64, now time.Time) []types.Ticker {
+	snapshot := c.market.Snapshot()
+	tickers := make([]types.Ticker, 0, len(snapshot))
+	for curr, tick := range snapshot {
+		price, err := strconv.ParseFloat(tick.Price, 64)
+		// skips pairs the market has not filled yet
+		if err != nil || price == 0 {
+			continue
+		}
+
+		quotes := c.quotes(curr, now)
+		t := types.Ticker{
+			Pair:      types.PairName(curr),
+			Price:     price,
+			EventTime: tick.EventTime,
+			UpdatedAt: tick.UpdatedAt,
+			Open24h:   open24h[curr],
+			Stale:     c.paused(types.SourceConsensus, curr, now) != "",
+			Sources:   make(map[string]float64, len(quotes)),
+		}
+		for _, q := range quotes {
+			t.Sources[q.source] = q.price
+		}
+		if t.Open24h > 0 {
+			t.Change24h = price - t.Open24h
+			t.ChangePercent24h = t.Change24h / t.Open24h * 100
+		}
+		tickers = append(tickers, t)
+	}
+	return tickers
+}
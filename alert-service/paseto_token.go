@@ -1,94 +0,0 @@
-package main
-
-import (
-	"time"
-
-	"github.com/aead/chacha20poly1305"
-	"github.com/google/uuid"
-	"github.com/o1egl/paseto"
-)
-
-// Different types of error returned by the Verify function
-
-type Payload struct {
-	ID        uuid.UUID `json:"id"`
-	UserID    int64     `json:"user_id"`
-	IssuedAt  time.Time `json:"issued_at"`
-	ExpiredAt time.Time `json:"expired_at"`
-}
-
-// NewPayload creates a new token payload with a specific user_id and duration
-func NewPayload(userID int64, duration time.Duration) (*Payload, error) {
-	tokenID, err := uuid.NewRandom()
-	if err != nil {
-		return nil, err
-	}
-
-	payload := &Payload{
-		ID:        tokenID,
-		UserID:    userID,
-		IssuedAt:  time.Now(),
-		ExpiredAt: time.Now().Add(duration),
-	}
-	return payload, nil
-}
-
-// Valid checks if the token payload is valid or not
-func (payload *Payload) Valid() error {
-	if time.Now().After(payload.ExpiredAt) {
-		return ErrTokenExpired
-	}
-
-	return nil
-}
-
-type Maker interface {
-	Create(userID int64, duration time.Duration) (string, *Payload, error)
-	Verify(token string) (*Payload, error)
-}
-
-// pasetoMaker is a PASETO token maker
-type pasetoMaker struct {
-	paseto       *paseto.V2
-	symmetricKey []byte
-}
-
-// NewPasetoMaker creates a new pasetoMaker
-func NewPasetoMaker(symmetricKey string) (Maker, error) {
-	if len(symmetricKey) != chacha20poly1305.KeySize {
-		return nil, ErrInvalidKeySize
-	}
-
-	return &pasetoMaker{
-		paseto:       paseto.NewV2(),
-		symmetricKey: []byte(symmetricKey),
-	}, nil
-}
-
-// Create creates a new token for a specific username and duration
-func (maker *pasetoMaker) Create(userID int64, duration time.Duration) (string, *Payload, error) {
-	payload, err := NewPayload(userID, duration)
-	if err != nil {
-		return "", payload, err
-	}
-
-	token, err := maker.paseto.Encrypt(maker.symmetricKey, payload, nil)
-	return token, payload, err
-}
-
-// Verify checks if the token is valid or not
-func (maker *pasetoMaker) Verify(token string) (*Payload, error) {
-	payload := &Payload{}
-
-	err := maker.paseto.Decrypt(token, maker.symmetricKey, payload, nil)
-	if err != nil {
-		return nil, ErrInvalidToken
-	}
-
-	err = payload.Valid()
-	if err != nil {
-		return nil, err
-	}
-
-	return payload, nil
-}
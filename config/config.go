@@ -0,0 +1,300 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// ErrPrinted is returned once the usage or --print-config output was written, the command should
+// exit without starting
+var ErrPrinted = errors.New("config printed")
+
+// the dotenv file read when neither --config nor CONFIG_FILE name one, it may be missing
+const defaultFile = ".env"
+
+// Validator is implemented by config structs that check more than required values, it runs after
+// every value is loaded and may fill in values derived from others
+type Validator interface {
+	Validate() error
+}
+
+// field is one configurable value, described by the tags of a struct field:
+//
+//	env      variable name, also the key in the file
+//	flag     flag name, the lower-cased variable name with dashes by default
+//	default  value used when no source sets one
+//	required the value may not be empty
+//	secret   the value is redacted when printed
+type field struct {
+	env      string
+	flag     string
+	def      string
+	required bool
+	secret   bool
+	value    reflect.Value
+}
+
+// Load fills cfg, a pointer to a struct, from the field defaults, an optional dotenv file, the
+// environment and the command line flags, each overriding the one before, and then validates it.
+// Structs nested without an env tag are loaded the same way. The arguments left after the flags
+// are returned for subcommands.
+func Load(cfg any, args []string) ([]string, error) {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("config must be a pointer to a struct, got %T", cfg)
+	}
+
+	fields, err := collect(v.Elem())
+	if err != nil {
+		return nil, err
+	}
+
+	fs := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+	file := fs.String("config", "", "dotenv file to read, $CONFIG_FILE or "+defaultFile+" when unset")
+	printConfig := fs.Bool("print-config", false, "print the resolved configuration with secrets redacted and exit")
+	flags := make(map[string]string)
+	for _, f := range fields {
+		f := f
+		fs.Func(f.flag, "overrides $"+f.env, func(s string) error {
+			flags[f.env] = s
+			return nil
+		})
+	}
+
+	err = fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil, ErrPrinted
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := readFile(*file)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for _, f := range fields {
+		raw := f.def
+		if s, ok := values[f.env]; ok {
+			raw = s
+		}
+		if s, ok := os.LookupEnv(f.env); ok {
+			raw = s
+		}
+		if s, ok := flags[f.env]; ok {
+			raw = s
+		}
+
+		err := set(f.value, raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", f.env, raw, err)
+		}
+		if f.required && f.value.IsZero() {
+			missing = append(missing, f.env)
+		}
+	}
+
+	if *printConfig {
+		write(os.Stdout, fields)
+		return nil, ErrPrinted
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing %s", strings.Join(missing, ", "))
+	}
+
+	err = validate(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return fs.Args(), nil
+}
+
+// readFile reads the dotenv file named by the flag or CONFIG_FILE, only the default may be missing
+func readFile(path string) (map[string]string, error) {
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path == "" {
+		values, err := godotenv.Read(defaultFile)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return values, err
+	}
+
+	values, err := godotenv.Read(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	return values, nil
+}
+
+func collect(v reflect.Value) ([]field, error) {
+	var fields []field
+	for i := 0; i < v.NumField(); i++ {
+		sf := v.Type().Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		env, ok := sf.Tag.Lookup("env")
+		if !ok {
+			if sf.Type.Kind() == reflect.Struct {
+				nested, err := collect(v.Field(i))
+				if err != nil {
+					return nil, err
+				}
+				fields = append(fields, nested...)
+			}
+			continue
+		}
+
+		f := field{
+			env:      env,
+			flag:     sf.Tag.Get("flag"),
+			def:      sf.Tag.Get("default"),
+			required: sf.Tag.Get("required") == "true",
+			secret:   sf.Tag.Get("secret") == "true",
+			value:    v.Field(i),
+		}
+		if f.flag == "" {
+			f.flag = strings.ReplaceAll(strings.ToLower(env), "_", "-")
+		}
+		if !supported(sf.Type) {
+			return nil, fmt.Errorf("config field %s has unsupported type %s", sf.Name, sf.Type)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func supported(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int32, reflect.Int64, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.String
+	}
+	return false
+}
+
+// set parses raw into v, lists are comma separated and an empty value is the zero value
+func set(v reflect.Value, raw string) error {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		v.SetZero()
+		return nil
+	}
+
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+
+	case v.Kind() == reflect.String:
+		v.SetString(raw)
+
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+
+	case v.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+
+	case v.Kind() == reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+
+	default:
+		n, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	}
+	return nil
+}
+
+// validate runs the Validate methods of nested structs before the one of the struct holding them
+func validate(v reflect.Value) error {
+	for i := 0; i < v.Elem().NumField(); i++ {
+		sf := v.Elem().Type().Field(i)
+		if !sf.IsExported() || sf.Type.Kind() != reflect.Struct {
+			continue
+		}
+		if _, ok := sf.Tag.Lookup("env"); ok {
+			continue
+		}
+
+		err := validate(v.Elem().Field(i).Addr())
+		if err != nil {
+			return err
+		}
+	}
+
+	if validator, ok := v.Interface().(Validator); ok {
+		return validator.Validate()
+	}
+	return nil
+}
+
+// write prints the values as a dotenv file, secrets and passwords inside urls are redacted
+func write(w io.Writer, fields []field) {
+	for _, f := range fields {
+		fmt.Fprintf(w, "%s=%s\n", f.env, redact(f))
+	}
+}
+
+func redact(f field) string {
+	var s string
+	switch {
+	case f.value.Type() == durationType:
+		s = time.Duration(f.value.Int()).String()
+	case f.value.Kind() == reflect.Slice:
+		s = strings.Join(f.value.Interface().([]string), ",")
+	default:
+		s = fmt.Sprint(f.value.Interface())
+	}
+
+	if f.secret && s != "" {
+		return "[redacted]"
+	}
+	if u, err := url.Parse(s); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			return u.Redacted()
+		}
+	}
+	return s
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testNested struct {
+	Sources []string `env:"TEST_SOURCES" default:"binance"`
+}
+
+func (n *testNested) Validate() error {
+	if len(n.Sources) > 2 {
+		return errors.New("too many sources")
+	}
+	return nil
+}
+
+type testConfig struct {
+	Addr     string        `env:"TEST_ADDR" default:":3000"`
+	Database string        `env:"TEST_DATABASE" required:"true"`
+	Key      string        `env:"TEST_KEY" secret:"true"`
+	Timeout  time.Duration `env:"TEST_TIMEOUT" default:"1s"`
+	Workers  int           `env:"TEST_WORKERS" flag:"workers" default:"2"`
+	Nested   testNested
+}
+
+func TestLoad(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.env")
+	err := os.WriteFile(file, []byte("TEST_DATABASE=postgresql://u:pass@db/x\nTEST_WORKERS=4\n"), 0o600)
+	assert.NoError(t, err)
+	t.Setenv("TEST_TIMEOUT", "5s")
+
+	// defaults, then the file, the environment and flags
+	var cfg testConfig
+	args, err := Load(&cfg, []string{"--config", file, "--workers", "8", "--test-sources", "binance, coinbase", "backtest"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"backtest"}, args)
+	assert.Equal(t, ":3000", cfg.Addr)
+	assert.Equal(t, "postgresql://u:pass@db/x", cfg.Database)
+	assert.Equal(t, 5*time.Second, cfg.Timeout)
+	assert.Equal(t, 8, cfg.Workers)
+	assert.Equal(t, []string{"binance", "coinbase"}, cfg.Nested.Sources)
+
+	_, err = Load(&testConfig{}, []string{"--config", file, "--test-sources", "a,b,c"})
+	assert.EqualError(t, err, "too many sources")
+
+	_, err = Load(&testConfig{}, []string{"--config", filepath.Join(t.TempDir(), "missing.env")})
+	assert.Error(t, err)
+
+	_, err = Load(&testConfig{}, []string{"--test-timeout", "soon"})
+	assert.ErrorContains(t, err, "invalid TEST_TIMEOUT")
+}
+
+func TestRedact(t *testing.T) {
+	var cfg testConfig
+	fields, err := collect(reflect.ValueOf(&cfg).Elem())
+	assert.NoError(t, err)
+
+	cfg.Database = "postgresql://u:pass@db/x"
+	cfg.Key = "secret"
+	assert.Equal(t, "postgresql://u:xxxxx@db/x", redact(fields[1]))
+	assert.Equal(t, "[redacted]", redact(fields[2]))
+}
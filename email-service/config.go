@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	database "email-service/database/sqlc"
+)
+
+// emailConfig is the config of the email service
+type emailConfig struct {
+	// apply pending migrations before starting instead of only checking the schema
+	MigrateOnStart bool   `env:"MIGRATE_ON_START" default:"false"`
+	KafkaAddress   string `env:"KAFKA_ADDRESS" required:"true"`
+	KafkaGroup     string `env:"KAFKA_GROUP" required:"true"`
+	KafkaTopic     string `env:"KAFKA_TOPIC" required:"true"`
+	// lockouts and new logins reported by the api
+	KafkaNoticeTopic string `env:"KAFKA_NOTICE_TOPIC" default:"security-notices"`
+	Postgres         database.PoolConfig
+	// alert transitions are published where the api streams them to users
+	RedisAddress string `env:"REDIS_ADDRESS" required:"true"`
+	// how often emails held back by the cooldown of a plan are looked for
+	DelayedInterval time.Duration `env:"DELAYED_EMAIL_INTERVAL" default:"15s"`
+
+	SMTPHost      string `env:"SMTP_HOST" default:"smtp.gmail.com"`
+	SMTPPort      int    `env:"SMTP_PORT" default:"587"`
+	GmailName     string `env:"GMAIL_NAME" required:"true"`
+	GmailAddress  string `env:"GMAIL_ADDRESS" required:"true"`
+	GmailPassword string `env:"GMAIL_PASSWORD" required:"true" secret:"true"`
+}
+
+func (c *emailConfig) Validate() error {
+	if c.DelayedInterval <= 0 {
+		return fmt.Errorf("invalid DELAYED_EMAIL_INTERVAL %s", c.DelayedInterval)
+	}
+	return nil
+}
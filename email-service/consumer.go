@@ -4,6 +4,7 @@ import (
 	"context"
 	"log"
 	"strconv"
+	"time"
 
 	database "email-service/database/sqlc"
 
@@ -19,19 +20,29 @@ const (
 	Completed state = "completed"
 )
 
+// entries email-service adds to the history of an alert
+const (
+	eventNotified      = "notified"
+	eventNotifyFailed  = "notify_failed"
+	eventNotifyDelayed = "notify_delayed"
+)
+
 // kafka consumer code here
 type Consumer interface {
 	Process(context.Context) error
 }
 
 type kafkaConsumer struct {
-	db     database.Querier
-	email  Emailer
-	cg     sarama.ConsumerGroup
-	topics []string
+	db      database.Store
+	email   Emailer
+	streams Streamer
+	cg      sarama.ConsumerGroup
+	topics  []string
+	// security notices of the api arrive on their own topic, every other topic carries triggered alerts
+	noticeTopic string
 }
 
-func NewKafkaConsumer(db database.Querier, email Emailer, addr []string, group string, topics []string) (Consumer, error) {
+func NewKafkaConsumer(db database.Store, email Emailer, streams Streamer, addr []string, group string, topics []string, noticeTopic string) (Consumer, error) {
 	config := sarama.NewConfig()
 	config.Consumer.Return.Errors = true
 
@@ -41,10 +52,13 @@ func NewKafkaConsumer(db database.Querier, email Emailer, addr []string, group s
 	}
 
 	return &kafkaConsumer{
-		db:     db,
-		email:  email,
-		cg:     consumerGroup,
-		topics: topics,
+		db:      db,
+		email:   email,
+		streams: streams,
+		cg:      consumerGroup,
+		topics:  append(topics, noticeTopic),
+
+		noticeTopic: noticeTopic,
 	}, nil
 }
 
@@ -52,22 +66,71 @@ func (*kafkaConsumer) Setup(sarama.ConsumerGroupSession) error   { return nil }
 func (*kafkaConsumer) Cleanup(sarama.ConsumerGroupSession) error { return nil }
 func (k *kafkaConsumer) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
 	for msg := range claim.Messages() {
+		if msg.Topic == k.noticeTopic {
+			err := k.sendNotice(sess.Context(), msg.Value)
+			if err != nil {
+				log.Println("Error sending security notice:", err)
+				k.deadLetter(sess, msg, err)
+				continue
+			}
+
+			sess.MarkMessage(msg, "")
+			continue
+		}
+
 		alertID := string(msg.Key)
 		price := string(msg.Value)
 
 		alertIDInt64, err := strconv.ParseInt(alertID, 10, 64)
 		if err != nil {
 			log.Println("Error parsing alertID:", err)
+			k.deadLetter(sess, msg, err)
 			continue
 		}
 
 		email, err := k.db.GetUserEmailByAlertID(sess.Context(), alertIDInt64)
 		if err != nil {
 			log.Println("Error getting user email:", err)
+			k.deadLetter(sess, msg, err)
 			continue
 		}
 
-		k.email.send(
+		cooldown, err := k.db.GetNotifyCooldown(sess.Context(), alertIDInt64)
+		if err != nil {
+			log.Println("Error getting notify cooldown:", err)
+			k.deadLetter(sess, msg, err)
+			continue
+		}
+
+		// the plan caps how often a user is emailed, an alert firing within the cooldown is held back and
+		// goes out with the other held back alerts of the user once it is over
+		sendAt := cooldown.LastNotifiedAt.Add(time.Duration(cooldown.MinCooldownSeconds) * time.Second)
+		held := cooldown.HeldUntil.After(time.Unix(0, 0))
+		if held && cooldown.HeldUntil.After(sendAt) {
+			sendAt = cooldown.HeldUntil
+		}
+		if held || time.Now().Before(sendAt) {
+			err = k.hold(sess.Context(), database.CreateDelayedNotificationParams{
+				AlertID: alertIDInt64,
+				UserID:  cooldown.UserID,
+				Price:   price,
+				SendAt:  sendAt,
+			})
+			if err != nil {
+				log.Println("Error holding back email:", err)
+				continue
+			}
+			sess.MarkMessage(msg, "")
+			continue
+		}
+
+		event := database.CreateAlertEventParams{
+			AlertID: alertIDInt64,
+			Type:    eventNotified,
+			Price:   price,
+			Detail:  "email",
+		}
+		sendErr := k.email.send(
 			"Crypto Alert",
 			"Your alert has been triggered! The price is now "+price+".",
 			[]string{email},
@@ -75,24 +138,99 @@ func (k *kafkaConsumer) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sar
 			nil,
 			nil,
 		)
-
-		// Mark message as processed
-		params := database.UpdateAlertStatusParams{
-			ID:     alertIDInt64,
-			Status: string(Completed),
+		if sendErr != nil {
+			log.Println("Error sending email:", sendErr)
+			event.Type = eventNotifyFailed
+			event.Detail = "email: " + sendErr.Error()
 		}
-		err = k.db.UpdateAlertStatus(sess.Context(), params)
+
+		// Mark message as processed, the attempt is recorded with the status change
+		var completed int64
+		err = k.db.WithTx(sess.Context(), func(tx database.Tx) error {
+			err := tx.CreateAlertEvent(sess.Context(), event)
+			if err != nil {
+				return err
+			}
+			completed, err = tx.CompleteAlert(sess.Context(), alertIDInt64)
+			return err
+		})
 		if err != nil {
 			log.Println("Error updating alert status:", err)
 			continue
 		}
-		
+		if completed > 0 {
+			publishCompleted(sess.Context(), k.streams, cooldown.UserID, alertIDInt64, price)
+		}
+
+		// the alert completes either way, a replay of the letter only sends the email again
+		if sendErr != nil {
+			k.deadLetter(sess, msg, sendErr)
+			continue
+		}
 		sess.MarkMessage(msg, "")
 	}
 
 	return nil
 }
 
+// hold keeps the email of a triggered alert until the cooldown of the plan is over, the alert stays
+// triggered until it is sent
+func (k *kafkaConsumer) hold(ctx context.Context, params database.CreateDelayedNotificationParams) error {
+	return k.db.WithTx(ctx, func(tx database.Tx) error {
+		err := tx.CreateAlertEvent(ctx, database.CreateAlertEventParams{
+			AlertID: params.AlertID,
+			Type:    eventNotifyDelayed,
+			Price:   params.Price,
+			Detail:  "email: held back by the cooldown of the plan until " + params.SendAt.UTC().Format(time.RFC3339),
+		})
+		if err != nil {
+			return err
+		}
+		return tx.CreateDelayedNotification(ctx, params)
+	})
+}
+
+// publishCompleted tells the streams of the owner that the alert completed, a stream that misses it
+// only shows the alert as triggered until it reloads
+func publishCompleted(ctx context.Context, streams Streamer, userID int64, alertID int64, price string) {
+	err := streams.publishAlert(ctx, alertEvent{
+		AlertID: alertID,
+		UserID:  userID,
+		Status:  string(Completed),
+		Price:   price,
+		At:      time.Now(),
+	})
+	if err != nil {
+		log.Println("Error publishing alert event:", err)
+	}
+}
+
+// deadLetter keeps a message that could not be handled for an admin to replay, it is only marked
+// once it is stored
+func (k *kafkaConsumer) deadLetter(sess sarama.ConsumerGroupSession, msg *sarama.ConsumerMessage, cause error) {
+	// key and value are not null in postgres, a message without a key has an empty one
+	key := msg.Key
+	if key == nil {
+		key = []byte{}
+	}
+	value := msg.Value
+	if value == nil {
+		value = []byte{}
+	}
+
+	err := k.db.CreateDeadLetter(sess.Context(), database.CreateDeadLetterParams{
+		Topic: msg.Topic,
+		Key:   key,
+		Value: value,
+		Error: cause.Error(),
+	})
+	if err != nil {
+		log.Println("Error storing dead letter:", err)
+		return
+	}
+	sess.MarkMessage(msg, "")
+}
+
 func (k *kafkaConsumer) Process(ctx context.Context) error {
 	for {
 		err := k.cg.Consume(ctx, k.topics, k)
@@ -1,2 +0,0 @@
-DROP table "Alerts";
-DROP table "Users";
\ No newline at end of file
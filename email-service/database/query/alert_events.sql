@@ -0,0 +1,22 @@
+-- name: CreateAlertEvent :exec
+INSERT INTO "AlertEvents" (
+  alert_id, type, price, detail
+) VALUES (
+  $1, $2, $3, $4
+);
+
+-- name: GetNotifyCooldown :one
+-- cooldown of the plan of the alert's owner, the last time they were notified of any of their alerts
+-- and when the emails held back for them go out
+SELECT
+  u.id AS user_id,
+  p.min_cooldown_seconds,
+  COALESCE(max(e.created_at), 'epoch')::timestamptz AS last_notified_at,
+  COALESCE((SELECT max(d.send_at) FROM "DelayedNotifications" d WHERE d.user_id = u.id), 'epoch')::timestamptz AS held_until
+FROM "Alerts" a
+INNER JOIN "Users" u ON u.id = a.user_id
+INNER JOIN "Plans" p ON p.name = u.plan
+LEFT JOIN "Alerts" ua ON ua.user_id = u.id
+LEFT JOIN "AlertEvents" e ON e.alert_id = ua.id AND e.type = 'notified'
+WHERE a.id = $1
+GROUP BY u.id, p.min_cooldown_seconds;
@@ -1,4 +1,5 @@
--- name: UpdateAlertStatus :exec
+-- name: CompleteAlert :execrows
+-- only a triggered alert completes, one an admin disabled or its owner deleted meanwhile stays so
 UPDATE "Alerts" SET
-  status = $2
-WHERE "id" = $1;
\ No newline at end of file
+  status = 'completed'
+WHERE "id" = $1 AND "status" = 'triggered';
\ No newline at end of file
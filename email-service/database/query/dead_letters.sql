@@ -0,0 +1,6 @@
+-- name: CreateDeadLetter :exec
+INSERT INTO "DeadLetters" (
+  topic, key, value, error
+) VALUES (
+  $1, $2, $3, $4
+);
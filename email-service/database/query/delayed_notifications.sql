@@ -0,0 +1,21 @@
+-- name: CreateDelayedNotification :exec
+-- a replayed message finds its alert held back already
+INSERT INTO "DelayedNotifications" (
+  alert_id, user_id, price, send_at
+) VALUES (
+  $1, $2, $3, $4
+) ON CONFLICT ("alert_id") DO NOTHING;
+
+-- name: DeleteDelayedNotifications :exec
+DELETE FROM "DelayedNotifications"
+WHERE "alert_id" = ANY(@alert_ids::bigint[]);
+
+-- name: TakeDueNotifications :many
+-- held back emails whose cooldown is over, they stay locked until the transaction ends so every
+-- instance sends a user's email once
+SELECT d.alert_id, d.user_id, d.price, u.email
+FROM "DelayedNotifications" d
+INNER JOIN "Users" u ON u.id = d.user_id
+WHERE d.send_at <= now()
+ORDER BY d.user_id, d.alert_id
+FOR UPDATE OF d SKIP LOCKED;
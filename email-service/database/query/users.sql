@@ -2,4 +2,8 @@
 SELECT u.email
 FROM "Users" u
 INNER JOIN "Alerts" a ON u.id = a.user_id
-WHERE a.id = $1;
\ No newline at end of file
+WHERE a.id = $1;
+
+-- name: GetUserEmail :one
+SELECT email FROM "Users"
+WHERE id = $1;
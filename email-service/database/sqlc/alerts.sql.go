@@ -9,18 +9,17 @@ import (
 	"context"
 )
 
-const updateAlertStatus = `-- name: UpdateAlertStatus :exec
+const completeAlert = `-- name: CompleteAlert :execrows
 UPDATE "Alerts" SET
-  status = $2
-WHERE "id" = $1
+  status = 'completed'
+WHERE "id" = $1 AND "status" = 'triggered'
 `
 
-type UpdateAlertStatusParams struct {
-	ID     int64  `json:"id"`
-	Status string `json:"status"`
-}
-
-func (q *Queries) UpdateAlertStatus(ctx context.Context, arg UpdateAlertStatusParams) error {
-	_, err := q.db.Exec(ctx, updateAlertStatus, arg.ID, arg.Status)
-	return err
+// only a triggered alert completes, one an admin disabled or its owner deleted meanwhile stays so
+func (q *Queries) CompleteAlert(ctx context.Context, id int64) (int64, error) {
+	result, err := q.db.Exec(ctx, completeAlert, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
 }
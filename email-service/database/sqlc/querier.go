@@ -9,8 +9,21 @@ import (
 )
 
 type Querier interface {
+	// only a triggered alert completes, one an admin disabled or its owner deleted meanwhile stays so
+	CompleteAlert(ctx context.Context, id int64) (int64, error)
+	CreateAlertEvent(ctx context.Context, arg CreateAlertEventParams) error
+	CreateDeadLetter(ctx context.Context, arg CreateDeadLetterParams) error
+	// a replayed message finds its alert held back already
+	CreateDelayedNotification(ctx context.Context, arg CreateDelayedNotificationParams) error
+	DeleteDelayedNotifications(ctx context.Context, alertIds []int64) error
+	// cooldown of the plan of the alert's owner, the last time they were notified of any of their alerts
+	// and when the emails held back for them go out
+	GetNotifyCooldown(ctx context.Context, id int64) (GetNotifyCooldownRow, error)
+	GetUserEmail(ctx context.Context, id int64) (string, error)
 	GetUserEmailByAlertID(ctx context.Context, id int64) (string, error)
-	UpdateAlertStatus(ctx context.Context, arg UpdateAlertStatusParams) error
+	// held back emails whose cooldown is over, they stay locked until the transaction ends so every
+	// instance sends a user's email once
+	TakeDueNotifications(ctx context.Context) ([]TakeDueNotificationsRow, error)
 }
 
 var _ Querier = (*Queries)(nil)
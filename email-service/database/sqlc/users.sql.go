@@ -9,6 +9,18 @@ import (
 	"context"
 )
 
+const getUserEmail = `-- name: GetUserEmail :one
+SELECT email FROM "Users"
+WHERE id = $1
+`
+
+func (q *Queries) GetUserEmail(ctx context.Context, id int64) (string, error) {
+	row := q.db.QueryRow(ctx, getUserEmail, id)
+	var email string
+	err := row.Scan(&email)
+	return email, err
+}
+
 const getUserEmailByAlertID = `-- name: GetUserEmailByAlertID :one
 SELECT u.email
 FROM "Users" u
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	database "email-service/database/sqlc"
+)
+
+// delayedSender sends the emails the cooldown of a plan held back, the held back alerts of a user go
+// out together in one email
+type delayedSender struct {
+	db      database.Store
+	email   Emailer
+	streams Streamer
+	every   time.Duration
+	// an email that could not be sent is kept as a dead letter of this topic, a replay sends it again
+	topic string
+}
+
+func NewDelayedSender(db database.Store, email Emailer, streams Streamer, every time.Duration, topic string) *delayedSender {
+	return &delayedSender{
+		db:      db,
+		email:   email,
+		streams: streams,
+		every:   every,
+		topic:   topic,
+	}
+}
+
+func (d *delayedSender) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := d.sendDue(ctx)
+			if err != nil {
+				log.Println("Error sending delayed emails:", err)
+			}
+		}
+	}
+}
+
+// sendDue sends the emails whose cooldown is over and completes their alerts, like the consumer they
+// complete whether or not the email went out
+func (d *delayedSender) sendDue(ctx context.Context) error {
+	var completed []database.TakeDueNotificationsRow
+	err := d.db.WithTx(ctx, func(tx database.Tx) error {
+		due, err := tx.TakeDueNotifications(ctx)
+		if err != nil {
+			return err
+		}
+
+		for len(due) > 0 {
+			n := 1
+			for n < len(due) && due[n].UserID == due[0].UserID {
+				n++
+			}
+			sent, err := d.send(ctx, tx, due[:n])
+			if err != nil {
+				return err
+			}
+			completed = append(completed, sent...)
+			due = due[n:]
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, alert := range completed {
+		publishCompleted(ctx, d.streams, alert.UserID, alert.AlertID, alert.Price)
+	}
+	return nil
+}
+
+// send emails a user about their held back alerts and returns the ones that completed
+func (d *delayedSender) send(ctx context.Context, tx database.Tx, alerts []database.TakeDueNotificationsRow) ([]database.TakeDueNotificationsRow, error) {
+	lines := make([]string, len(alerts))
+	ids := make([]int64, len(alerts))
+	for i, alert := range alerts {
+		lines[i] = "Alert " + strconv.FormatInt(alert.AlertID, 10) + " was triggered at a price of " + html.EscapeString(alert.Price) + "."
+		ids[i] = alert.AlertID
+	}
+
+	sendErr := d.email.send(
+		"Crypto Alert",
+		"Your alerts have been triggered!<br>"+strings.Join(lines, "<br>"),
+		[]string{alerts[0].Email},
+		nil,
+		nil,
+		nil,
+	)
+	if sendErr != nil {
+		log.Println("Error sending email:", sendErr)
+	}
+
+	var completed []database.TakeDueNotificationsRow
+	for _, alert := range alerts {
+		event := database.CreateAlertEventParams{
+			AlertID: alert.AlertID,
+			Type:    eventNotified,
+			Price:   alert.Price,
+			Detail:  "email",
+		}
+		if sendErr != nil {
+			event.Type = eventNotifyFailed
+			event.Detail = "email: " + sendErr.Error()
+
+			err := tx.CreateDeadLetter(ctx, database.CreateDeadLetterParams{
+				Topic: d.topic,
+				Key:   []byte(strconv.FormatInt(alert.AlertID, 10)),
+				Value: []byte(alert.Price),
+				Error: sendErr.Error(),
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		err := tx.CreateAlertEvent(ctx, event)
+		if err != nil {
+			return nil, err
+		}
+		n, err := tx.CompleteAlert(ctx, alert.AlertID)
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			completed = append(completed, alert)
+		}
+	}
+
+	return completed, tx.DeleteDelayedNotifications(ctx, ids)
+}
@@ -2,16 +2,13 @@ package main
 
 import (
 	"fmt"
+	"net"
 	"net/smtp"
+	"strconv"
 
 	"github.com/jordan-wright/email"
 )
 
-const (
-	smtpAuthAddress   = "smtp.gmail.com"
-	smtpServerAddress = "smtp.gmail.com:587"
-)
-
 type Emailer interface {
 	send(
 		subject string,
@@ -27,13 +24,17 @@ type gmail struct {
 	name     string
 	address  string
 	password string
+	smtpHost string
+	smtpPort int
 }
 
-func NewGmailSender(name string, address string, password string) Emailer {
+func NewGmailSender(name string, address string, password string, smtpHost string, smtpPort int) Emailer {
 	return &gmail{
 		name:     name,
 		address:  address,
 		password: password,
+		smtpHost: smtpHost,
+		smtpPort: smtpPort,
 	}
 }
 
@@ -60,6 +61,6 @@ func (g *gmail) send(
 		}
 	}
 
-	smtpAuth := smtp.PlainAuth("", g.address, g.password, smtpAuthAddress)
-	return e.Send(smtpServerAddress, smtpAuth)
+	smtpAuth := smtp.PlainAuth("", g.address, g.password, g.smtpHost)
+	return e.Send(net.JoinHostPort(g.smtpHost, strconv.Itoa(g.smtpPort)), smtpAuth)
 }
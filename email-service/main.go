@@ -2,42 +2,82 @@ package main
 
 import (
 	"context"
-	database "email-service/database/sqlc"
+	"errors"
 	"log"
 	"os"
 
-	"github.com/joho/godotenv"
+	"config"
+	database "email-service/database/sqlc"
+	"migrations"
 )
 
 func main() {
-	err := godotenv.Load()
+	var cfg emailConfig
+	args, err := config.Load(&cfg, os.Args[1:])
+	if errors.Is(err, config.ErrPrinted) {
+		return
+	}
 	if err != nil {
-		log.Fatal("Error loading .env file:", err)
+		log.Fatal("Error reading config:", err)
 	}
 
 	gmail := NewGmailSender(
-		os.Getenv("GMAIL_NAME"),
-		os.Getenv("GMAIL_ADDRESS"),
-		os.Getenv("GMAIL_PASSWORD"),
+		cfg.GmailName,
+		cfg.GmailAddress,
+		cfg.GmailPassword,
+		cfg.SMTPHost,
+		cfg.SMTPPort,
 	)
 
 	// initializing postgres database
-	postgres, conn, err := database.NewPostresDB(context.TODO(), os.Getenv("POSTGRES_ADDRESS"))
+	postgres, err := database.NewPostresDB(context.TODO(), cfg.Postgres)
 	if err != nil {
 		log.Fatal("Error connecting to database:", err)
 	}
-	defer conn.Close(context.TODO())
+	defer postgres.Close()
+
+	// "email-service migrate up" manages the shared schema instead of starting the consumer
+	if len(args) > 0 && args[0] == "migrate" {
+		embedded, err := migrations.Embedded()
+		if err != nil {
+			log.Fatal("Error loading migrations:", err)
+		}
+		conn, err := postgres.Pool.Acquire(context.TODO())
+		if err != nil {
+			log.Fatal("Error connecting to database:", err)
+		}
+		defer conn.Release()
+
+		err = migrations.Command(context.TODO(), migrations.NewMigrator(conn.Conn(), embedded), args[1:], os.Stdout)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// refuse to run against a schema this build does not know
+	err = migrations.Ensure(context.TODO(), postgres.Pool, cfg.MigrateOnStart)
+	if err != nil {
+		log.Fatal("Error checking database schema:", err)
+	}
+
+	streams, err := NewRedisStreamer(cfg.RedisAddress)
+	if err != nil {
+		log.Fatal("Error connecting to redis:", err)
+	}
 
 	consumer, err := NewKafkaConsumer(
 		postgres,
 		gmail,
+		streams,
 		[]string{
-			os.Getenv("KAFKA_ADDRESS"),
+			cfg.KafkaAddress,
 		},
-		os.Getenv("KAFKA_GROUP"),
+		cfg.KafkaGroup,
 		[]string{
-			os.Getenv("KAFKA_TOPIC"),
+			cfg.KafkaTopic,
 		},
+		cfg.KafkaNoticeTopic,
 	)
 	if err != nil {
 		log.Fatal("Error setting up kafka:", err)
@@ -45,5 +85,6 @@ func main() {
 
 	log.Println("Starting consumer...")
 	ctx := context.Background()
+	go NewDelayedSender(postgres, gmail, streams, cfg.DelayedInterval, cfg.KafkaTopic).Run(ctx)
 	log.Fatal(consumer.Process(ctx))
 }
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"time"
+)
+
+// kinds of security notices the api sends
+const (
+	noticeLockout  = "lockout"
+	noticeNewLogin = "new_login"
+)
+
+// notice is a security notice about the account of a user, as the api sends it
+type notice struct {
+	UserID    int64     `json:"user_id"`
+	Kind      string    `json:"kind"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	At        time.Time `json:"at"`
+	Until     time.Time `json:"until"`
+}
+
+func (k *kafkaConsumer) sendNotice(ctx context.Context, value []byte) error {
+	var n notice
+	err := json.Unmarshal(value, &n)
+	if err != nil {
+		return err
+	}
+
+	var subject, content string
+	origin := fmt.Sprintf("from %s (%s) at %s", html.EscapeString(n.IP), html.EscapeString(n.UserAgent), n.At.UTC().Format(time.RFC1123))
+	switch n.Kind {
+	case noticeLockout:
+		subject = "Your account has been locked"
+		content = "Too many failed logins, the last one " + origin + ". " +
+			"You can log in again after " + n.Until.UTC().Format(time.RFC1123) + "."
+	case noticeNewLogin:
+		subject = "New login to your account"
+		content = "Your account was logged in to " + origin + ". " +
+			"If this was not you, contact us right away."
+	default:
+		return fmt.Errorf("unknown notice kind %q", n.Kind)
+	}
+
+	email, err := k.db.GetUserEmail(ctx, n.UserID)
+	if err != nil {
+		return err
+	}
+
+	return k.email.send(subject, content, []string{email}, nil, nil, nil)
+}
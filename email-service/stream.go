@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// alert transitions go to the same channels and in the same shape as cache.PublishAlertEvent of
+// alert-service publishes them, the api streams them to the owner of the alert
+const alertChannelPrefix = "stream:alerts:"
+
+type Streamer interface {
+	publishAlert(ctx context.Context, e alertEvent) error
+}
+
+type alertEvent struct {
+	AlertID int64     `json:"alert_id"`
+	UserID  int64     `json:"user_id"`
+	Status  string    `json:"status"`
+	Price   string    `json:"price,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+type streamEvent struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+type redisStreamer struct {
+	client *redis.Client
+}
+
+func NewRedisStreamer(addr string) (Streamer, error) {
+	opt, err := redis.ParseURL(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &redisStreamer{
+		client: redis.NewClient(opt),
+	}, nil
+}
+
+func (r *redisStreamer) publishAlert(ctx context.Context, e alertEvent) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(streamEvent{Type: "alert", Data: data})
+	if err != nil {
+		return err
+	}
+
+	return r.client.Publish(ctx, fmt.Sprint(alertChannelPrefix, e.UserID), b).Err()
+}
@@ -0,0 +1,261 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// same bookkeeping as the golang-migrate cli, so databases migrated with it keep their version
+	versionTable = "schema_migrations"
+
+	// session lock held while migrating, services starting together migrate one after the other
+	lockKey = 8413750926
+)
+
+var (
+	ErrDirty        = errors.New("database is dirty, a migration failed halfway and needs a manual fix")
+	ErrSchemaTooOld = errors.New("database schema is older than this build needs, run the migrations")
+)
+
+// files are named <version>_<name>.<up|down>.sql
+var fileName = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Migration is one versioned schema change
+type Migration struct {
+	Version uint64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Load reads the migrations of a directory in version order, every version needs both directions
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[uint64]*Migration)
+	for _, entry := range entries {
+		m := fileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || m == nil {
+			continue
+		}
+
+		version, err := strconv.ParseUint(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", entry.Name(), err)
+		}
+		sql, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has two names, %s and %s", version, migration.Name, m[2])
+		}
+		if m[3] == "up" {
+			migration.Up = string(sql)
+		} else {
+			migration.Down = string(sql)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Migrator applies migrations to postgres, each one in its own transaction together with the version
+type Migrator struct {
+	conn       *pgx.Conn
+	migrations []Migration
+}
+
+func NewMigrator(conn *pgx.Conn, migrations []Migration) *Migrator {
+	return &Migrator{
+		conn:       conn,
+		migrations: migrations,
+	}
+}
+
+// Version returns the applied version, zero when nothing was applied yet
+func (m *Migrator) Version(ctx context.Context) (uint64, bool, error) {
+	err := m.ensureTable(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+
+	var version int64
+	var dirty bool
+	err = m.conn.QueryRow(ctx, `SELECT version, dirty FROM `+versionTable+` LIMIT 1`).Scan(&version, &dirty)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return uint64(version), dirty, nil
+}
+
+// Latest is the version this build was written against
+func (m *Migrator) Latest() uint64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Check refuses a dirty schema or one older than Latest. A newer schema is accepted so instances
+// of the previous build keep running while a deploy migrates ahead of them.
+func (m *Migrator) Check(ctx context.Context) error {
+	current, err := m.clean(ctx)
+	if err != nil {
+		return err
+	}
+	if current < m.Latest() {
+		return fmt.Errorf("version %d, need %d: %w", current, m.Latest(), ErrSchemaTooOld)
+	}
+	return nil
+}
+
+// Up applies every migration above the current version and returns how many ran
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	current, err := m.clean(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	for _, migration := range m.migrations {
+		if migration.Version <= current {
+			continue
+		}
+		err := m.apply(ctx, migration.Up, migration.Version)
+		if err != nil {
+			return applied, fmt.Errorf("migration %d_%s up: %w", migration.Version, migration.Name, err)
+		}
+		current = migration.Version
+		applied++
+	}
+	return applied, nil
+}
+
+// Down reverts the last n applied migrations, every one of them when n is zero
+func (m *Migrator) Down(ctx context.Context, n int) (int, error) {
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	current, err := m.clean(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	reverted := 0
+	for i := len(m.migrations) - 1; i >= 0 && (n <= 0 || reverted < n); i-- {
+		migration := m.migrations[i]
+		if migration.Version > current {
+			continue
+		}
+
+		var previous uint64
+		if i > 0 {
+			previous = m.migrations[i-1].Version
+		}
+		err := m.apply(ctx, migration.Down, previous)
+		if err != nil {
+			return reverted, fmt.Errorf("migration %d_%s down: %w", migration.Version, migration.Name, err)
+		}
+		current = previous
+		reverted++
+	}
+	return reverted, nil
+}
+
+// lock waits for the migration lock, the returned func releases it
+func (m *Migrator) lock(ctx context.Context) (func(), error) {
+	_, err := m.conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, lockKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// released without ctx, a cancelled migration must not leave the session holding the lock
+	return func() {
+		m.conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, lockKey)
+	}, nil
+}
+
+// clean returns the current version, refusing to go on from a dirty one
+func (m *Migrator) clean(ctx context.Context) (uint64, error) {
+	version, dirty, err := m.Version(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if dirty {
+		return 0, fmt.Errorf("version %d: %w", version, ErrDirty)
+	}
+	return version, nil
+}
+
+// apply runs a migration and records version as the current one, zero clears it
+func (m *Migrator) apply(ctx context.Context, sql string, version uint64) error {
+	tx, err := m.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, sql)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `TRUNCATE `+versionTable)
+	if err != nil {
+		return err
+	}
+	if version > 0 {
+		_, err = tx.Exec(ctx, `INSERT INTO `+versionTable+` (version, dirty) VALUES ($1, false)`, int64(version))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	_, err := m.conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS `+versionTable+` (version bigint NOT NULL PRIMARY KEY, dirty boolean NOT NULL)`)
+	return err
+}
@@ -0,0 +1,40 @@
+package migrations
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	migrations, err := Load(fstest.MapFS{
+		"000002_candles.up.sql":       {Data: []byte("CREATE TABLE candles ();")},
+		"000002_candles.down.sql":     {Data: []byte("DROP TABLE candles;")},
+		"000001_init_schema.up.sql":   {Data: []byte("CREATE TABLE users ();")},
+		"000001_init_schema.down.sql": {Data: []byte("DROP TABLE users;")},
+		"README.md":                   {Data: []byte("not a migration")},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, migrations, 2)
+	assert.Equal(t, uint64(1), migrations[0].Version)
+	assert.Equal(t, "init_schema", migrations[0].Name)
+	assert.Equal(t, "DROP TABLE candles;", migrations[1].Down)
+
+	// a version that cannot be reverted is refused
+	_, err = Load(fstest.MapFS{
+		"000001_init_schema.up.sql": {Data: []byte("CREATE TABLE users ();")},
+	})
+	assert.Error(t, err)
+}
+
+func TestEmbedded(t *testing.T) {
+	migrations, err := Embedded()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, migrations)
+
+	// versions are contiguous so a gap from a bad merge is caught before it ships
+	for i, migration := range migrations {
+		assert.Equal(t, uint64(i+1), migration.Version, migration.Name)
+	}
+}
@@ -0,0 +1,104 @@
+package migrations
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io"
+	"io/fs"
+	"strconv"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// the schema shared by every service, sqlc generates the queries of each service from it
+//
+//go:embed sql/*.sql
+var files embed.FS
+
+// Usage describes the commands of Command
+const Usage = `commands:
+  up        apply every pending migration
+  down [n]  revert the last n migrations, all of them without n
+  version   print the applied version
+`
+
+// Embedded returns the migrations built into the binary
+func Embedded() ([]Migration, error) {
+	sub, err := fs.Sub(files, "sql")
+	if err != nil {
+		return nil, err
+	}
+	return Load(sub)
+}
+
+// Ensure migrates to the embedded schema when migrate is set and then checks that the database
+// can be run against, services call it before they start. The migration lock is held by a session
+// so one connection of the pool is kept for the whole run.
+func Ensure(ctx context.Context, pool *pgxpool.Pool, migrate bool) error {
+	migrations, err := Embedded()
+	if err != nil {
+		return err
+	}
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	m := NewMigrator(conn.Conn(), migrations)
+	if migrate {
+		_, err := m.Up(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	return m.Check(ctx)
+}
+
+// Command runs one of the Usage commands and prints the resulting version to w
+func Command(ctx context.Context, m *Migrator, args []string, w io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing command\n%s", Usage)
+	}
+
+	switch args[0] {
+	case "up":
+		n, err := m.Up(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, "applied", n, "migrations")
+
+	case "down":
+		n := 0
+		if len(args) > 1 {
+			var err error
+			n, err = strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of migrations %q", args[1])
+			}
+		}
+		n, err := m.Down(ctx, n)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, "reverted", n, "migrations")
+
+	case "version":
+	default:
+		return fmt.Errorf("unknown command %q\n%s", args[0], Usage)
+	}
+
+	version, dirty, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		fmt.Fprintln(w, "version", version, "(dirty)")
+		return nil
+	}
+	fmt.Fprintln(w, "version", version)
+	return nil
+}
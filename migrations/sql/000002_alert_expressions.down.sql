@@ -0,0 +1,4 @@
+ALTER TABLE "Alerts" DROP CONSTRAINT "Alerts_user_id_crypto_price_direction_expression_key";
+ALTER TABLE "Alerts" ADD UNIQUE ("user_id", "crypto", "price", "direction");
+
+ALTER TABLE "Alerts" DROP COLUMN "expression";
\ No newline at end of file
@@ -0,0 +1,4 @@
+ALTER TABLE "Alerts" ADD COLUMN "expression" varchar NOT NULL DEFAULT '';
+
+ALTER TABLE "Alerts" DROP CONSTRAINT "Alerts_user_id_crypto_price_direction_key";
+ALTER TABLE "Alerts" ADD UNIQUE ("user_id", "crypto", "price", "direction", "expression");
\ No newline at end of file
@@ -0,0 +1 @@
+DROP table "Candles";
\ No newline at end of file
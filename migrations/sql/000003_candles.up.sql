@@ -0,0 +1,13 @@
+CREATE TABLE "Candles" (
+  "pair" varchar NOT NULL,
+  "interval" varchar NOT NULL,
+  "open_time" timestamptz NOT NULL,
+  "open" float NOT NULL,
+  "high" float NOT NULL,
+  "low" float NOT NULL,
+  "close" float NOT NULL,
+  "volume" float NOT NULL,
+  "trades" bigint NOT NULL,
+
+  PRIMARY KEY ("pair", "interval", "open_time")
+);
\ No newline at end of file
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS "Alerts_user_id_crypto_id_idx";
+DROP INDEX IF EXISTS "Alerts_user_id_price_id_idx";
+DROP INDEX IF EXISTS "Alerts_user_id_status_created_at_id_idx";
+DROP INDEX IF EXISTS "Alerts_user_id_created_at_id_idx";
+
+ALTER TABLE "Alerts" ALTER COLUMN "created_at" SET DEFAULT 'now()';
+ALTER TABLE "Users" ALTER COLUMN "created_at" SET DEFAULT 'now()';
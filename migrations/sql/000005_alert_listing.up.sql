@@ -0,0 +1,8 @@
+-- the quoted default was evaluated once when the tables were created
+ALTER TABLE "Users" ALTER COLUMN "created_at" SET DEFAULT now();
+ALTER TABLE "Alerts" ALTER COLUMN "created_at" SET DEFAULT now();
+
+CREATE INDEX "Alerts_user_id_created_at_id_idx" ON "Alerts" ("user_id", "created_at" DESC, "id" DESC);
+CREATE INDEX "Alerts_user_id_status_created_at_id_idx" ON "Alerts" ("user_id", "status", "created_at" DESC, "id" DESC);
+CREATE INDEX "Alerts_user_id_price_id_idx" ON "Alerts" ("user_id", "price", "id");
+CREATE INDEX "Alerts_user_id_crypto_id_idx" ON "Alerts" ("user_id", "crypto", "id");
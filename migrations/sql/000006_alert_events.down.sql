@@ -0,0 +1,2 @@
+DROP TABLE "AlertEvents";
+DROP FUNCTION "alert_events_append_only"();
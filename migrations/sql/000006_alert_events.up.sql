@@ -0,0 +1,23 @@
+CREATE TABLE "AlertEvents" (
+  "id" bigserial PRIMARY KEY,
+  "alert_id" bigint NOT NULL,
+  "type" varchar NOT NULL,
+  "price" varchar NOT NULL DEFAULT '',
+  "detail" varchar NOT NULL DEFAULT '',
+  "created_at" timestamptz NOT NULL DEFAULT now()
+);
+
+ALTER TABLE "AlertEvents" ADD FOREIGN KEY ("alert_id") REFERENCES "Alerts" ("id");
+
+CREATE INDEX "AlertEvents_alert_id_id_idx" ON "AlertEvents" ("alert_id", "id");
+
+-- the history is an audit trail, rows are only ever added
+CREATE FUNCTION "alert_events_append_only"() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'AlertEvents is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER "AlertEvents_append_only"
+  BEFORE UPDATE OR DELETE ON "AlertEvents"
+  FOR EACH ROW EXECUTE FUNCTION "alert_events_append_only"();
@@ -0,0 +1,2 @@
+ALTER TABLE "Users" DROP COLUMN "plan";
+DROP TABLE "Plans";
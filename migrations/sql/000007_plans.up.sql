@@ -0,0 +1,17 @@
+-- limits of a plan, 0 means unlimited
+CREATE TABLE "Plans" (
+  "name" varchar PRIMARY KEY,
+  "max_active_alerts" integer NOT NULL,
+  "max_pairs" integer NOT NULL,
+  "channels" varchar[] NOT NULL,
+  "min_cooldown_seconds" integer NOT NULL
+);
+
+INSERT INTO "Plans" (name, max_active_alerts, max_pairs, channels, min_cooldown_seconds) VALUES
+  ('free', 20, 2, '{email}', 300),
+  ('pro', 500, 0, '{email,stream}', 60),
+  ('admin', 0, 0, '{email,stream}', 0);
+
+ALTER TABLE "Users" ADD COLUMN "plan" varchar NOT NULL DEFAULT 'free';
+
+ALTER TABLE "Users" ADD FOREIGN KEY ("plan") REFERENCES "Plans" ("name");
@@ -0,0 +1,4 @@
+DROP TABLE "UserLogins";
+
+ALTER TABLE "Users" DROP COLUMN "locked_until";
+ALTER TABLE "Users" DROP COLUMN "failed_logins";
@@ -0,0 +1,15 @@
+-- failed logins since the last successful one, the account refuses logins until locked_until
+ALTER TABLE "Users" ADD COLUMN "failed_logins" integer NOT NULL DEFAULT 0;
+ALTER TABLE "Users" ADD COLUMN "locked_until" timestamptz NOT NULL DEFAULT 'epoch';
+
+-- where a user logged in from, a login from an ip or device not seen before is reported to them
+CREATE TABLE "UserLogins" (
+  "user_id" bigint NOT NULL,
+  "ip" varchar NOT NULL,
+  "user_agent" varchar NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT now(),
+  "last_seen_at" timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("user_id", "ip", "user_agent")
+);
+
+ALTER TABLE "UserLogins" ADD FOREIGN KEY ("user_id") REFERENCES "Users" ("id");
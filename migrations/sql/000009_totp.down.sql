@@ -0,0 +1,5 @@
+DROP TABLE "RecoveryCodes";
+
+ALTER TABLE "Users" DROP COLUMN "totp_last_step";
+ALTER TABLE "Users" DROP COLUMN "totp_enabled";
+ALTER TABLE "Users" DROP COLUMN "totp_secret";
@@ -0,0 +1,15 @@
+-- the secret is sealed by the api, it is set on enrollment and used once the user confirmed a code.
+-- totp_last_step is the last time step a code was accepted for, a code is never accepted twice.
+ALTER TABLE "Users" ADD COLUMN "totp_secret" varchar NOT NULL DEFAULT '';
+ALTER TABLE "Users" ADD COLUMN "totp_enabled" boolean NOT NULL DEFAULT false;
+ALTER TABLE "Users" ADD COLUMN "totp_last_step" bigint NOT NULL DEFAULT 0;
+
+-- single use codes for when the authenticator is lost, only their sha-256 is kept
+CREATE TABLE "RecoveryCodes" (
+  "user_id" bigint NOT NULL,
+  "code_hash" varchar NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("user_id", "code_hash")
+);
+
+ALTER TABLE "RecoveryCodes" ADD FOREIGN KEY ("user_id") REFERENCES "Users" ("id");
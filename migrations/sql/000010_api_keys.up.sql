@@ -0,0 +1,18 @@
+-- keys bots use instead of a login, only the sha-256 of a key is kept. expires_at and last_used_at
+-- are 'epoch' for keys that never expire and keys never used.
+CREATE TABLE "ApiKeys" (
+  "id" bigserial PRIMARY KEY,
+  "user_id" bigint NOT NULL,
+  "name" varchar NOT NULL,
+  "prefix" varchar NOT NULL,
+  "key_hash" varchar UNIQUE NOT NULL,
+  "scopes" varchar[] NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT now(),
+  "expires_at" timestamptz NOT NULL DEFAULT 'epoch',
+  "last_used_at" timestamptz NOT NULL DEFAULT 'epoch',
+  "revoked" boolean NOT NULL DEFAULT false
+);
+
+CREATE INDEX ON "ApiKeys" ("user_id");
+
+ALTER TABLE "ApiKeys" ADD FOREIGN KEY ("user_id") REFERENCES "Users" ("id");
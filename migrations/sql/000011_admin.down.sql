@@ -0,0 +1,4 @@
+DROP TABLE "DeadLetters";
+DROP TABLE "AuditLog";
+
+ALTER TABLE "Users" DROP COLUMN "role";
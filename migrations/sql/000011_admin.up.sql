@@ -0,0 +1,29 @@
+-- roles are apart from plans, admins were the users on the admin plan until now
+ALTER TABLE "Users" ADD COLUMN "role" varchar NOT NULL DEFAULT 'user' CHECK ("role" IN ('user', 'admin'));
+
+UPDATE "Users" SET "role" = 'admin' WHERE "plan" = 'admin';
+
+-- every admin action, target is what it was applied to such as user:12 or alert:34
+CREATE TABLE "AuditLog" (
+  "id" bigserial PRIMARY KEY,
+  "admin_id" bigint NOT NULL,
+  "action" varchar NOT NULL,
+  "target" varchar NOT NULL,
+  "detail" varchar NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT now()
+);
+
+ALTER TABLE "AuditLog" ADD FOREIGN KEY ("admin_id") REFERENCES "Users" ("id");
+
+-- kafka messages email-service could not handle, replayed_at is 'epoch' until an admin replays one
+CREATE TABLE "DeadLetters" (
+  "id" bigserial PRIMARY KEY,
+  "topic" varchar NOT NULL,
+  "key" bytea NOT NULL,
+  "value" bytea NOT NULL,
+  "error" varchar NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT now(),
+  "replayed_at" timestamptz NOT NULL DEFAULT 'epoch'
+);
+
+CREATE INDEX ON "DeadLetters" ("id") WHERE "replayed_at" = 'epoch';
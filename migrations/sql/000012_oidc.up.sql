@@ -0,0 +1,15 @@
+-- accounts at OpenID Connect providers users sign in with, a provider names its users by subject and
+-- subjects are only unique per issuer. email is the one the provider vouched for when it was linked.
+CREATE TABLE "OidcIdentities" (
+  "id" bigserial PRIMARY KEY,
+  "user_id" bigint NOT NULL,
+  "issuer" varchar NOT NULL,
+  "subject" varchar NOT NULL,
+  "email" varchar NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT now(),
+  UNIQUE ("issuer", "subject")
+);
+
+CREATE INDEX ON "OidcIdentities" ("user_id");
+
+ALTER TABLE "OidcIdentities" ADD FOREIGN KEY ("user_id") REFERENCES "Users" ("id");
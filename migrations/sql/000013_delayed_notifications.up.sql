@@ -0,0 +1,15 @@
+-- emails the cooldown of a plan held back, the alert stays triggered until send_at when the emails of
+-- a user go out together
+CREATE TABLE "DelayedNotifications" (
+  "alert_id" bigint PRIMARY KEY,
+  "user_id" bigint NOT NULL,
+  "price" varchar NOT NULL,
+  "send_at" timestamptz NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX ON "DelayedNotifications" ("send_at");
+
+ALTER TABLE "DelayedNotifications" ADD FOREIGN KEY ("alert_id") REFERENCES "Alerts" ("id");
+
+ALTER TABLE "DelayedNotifications" ADD FOREIGN KEY ("user_id") REFERENCES "Users" ("id");
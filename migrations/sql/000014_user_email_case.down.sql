@@ -0,0 +1 @@
+DROP INDEX "Users_lower_email_key";
@@ -0,0 +1,4 @@
+-- emails are compared without case, an address cannot sign up again in another case and single sign-on
+-- finds the account whatever case the provider sends. Existing addresses that only differ in case have
+-- to be merged by hand before this runs.
+CREATE UNIQUE INDEX "Users_lower_email_key" ON "Users" (lower("email"));